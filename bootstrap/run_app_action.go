@@ -3,11 +3,11 @@ package bootstrap
 import (
 	"errors"
 	"net/url"
-	"sort"
 	"time"
 
 	ct "github.com/flynn/flynn/controller/types"
 	"github.com/flynn/flynn/controller/utils"
+	"github.com/flynn/flynn/pkg/cluster"
 	"github.com/flynn/flynn/pkg/random"
 	"github.com/flynn/flynn/pkg/resource"
 	"github.com/flynn/flynn/pkg/schedutil"
@@ -105,14 +105,18 @@ func (a *RunAppAction) Run(s *State) error {
 	if err != nil {
 		return err
 	}
+	hosts, err := cc.ListHosts()
+	if err != nil {
+		return err
+	}
 	for typ, count := range a.Processes {
-		hosts, err := cc.ListHosts()
-		if err != nil {
-			return err
-		}
-		sort.Sort(schedutil.HostSlice(hosts))
 		for i := 0; i < count; i++ {
-			job, err := startJob(s, hosts[i%len(hosts)].ID, utils.JobConfig(a.ExpandedFormation, typ))
+			config := utils.JobConfig(a.ExpandedFormation, typ)
+			h := schedutil.Place(schedutil.DefaultPolicy, hosts, config)
+			if h == nil {
+				return cluster.ErrNoServers
+			}
+			job, err := startJob(s, h.ID, config)
 			if err != nil {
 				return err
 			}
@@ -35,7 +35,7 @@ func startJob(s *State, hostID string, job *host.Job) (*Job, error) {
 		return nil, err
 	}
 	if hostID == "" {
-		hostID, err = randomHost(cc)
+		hostID, err = pickHost(cc, job)
 		if err != nil {
 			return nil, err
 		}
@@ -90,13 +90,14 @@ func startJob(s *State, hostID string, job *host.Job) (*Job, error) {
 	return data, <-jobStatus
 }
 
-func randomHost(cc *cluster.Client) (string, error) {
+func pickHost(cc *cluster.Client, job *host.Job) (string, error) {
 	hosts, err := cc.ListHosts()
 	if err != nil {
 		return "", err
 	}
-	if len(hosts) == 0 {
+	h := schedutil.PickHost(hosts, job)
+	if h == nil {
 		return "", cluster.ErrNoServers
 	}
-	return schedutil.PickHost(hosts).ID, nil
+	return h.ID, nil
 }
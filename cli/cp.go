@@ -0,0 +1,218 @@
+package main
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-docopt"
+	"github.com/flynn/flynn/controller/client"
+)
+
+func init() {
+	register("cp", runCp, `
+usage: flynn cp <src> <dst>
+
+Copy files between a running job and the local filesystem.
+
+One of src and dst must be a path inside a job given as <job>:<path>, where
+path is absolute. Directories are copied recursively.
+
+When copying from a job, the file or directory is copied into dst if dst is an
+existing directory, and to dst otherwise. If dst is "-", a tar archive is
+written to stdout.
+
+When copying to a job, the file or directory is copied into the directory dst.
+If src is "-", a tar archive is read from stdin and extracted into dst.
+
+Examples:
+
+	$ flynn cp 1d0b46ad-6ba5-41a0-a0b8-4a4b7d1e3ed6:/tmp/heap.hprof .
+
+	$ flynn cp ./config 1d0b46ad-6ba5-41a0-a0b8-4a4b7d1e3ed6:/app
+`)
+}
+
+func runCp(args *docopt.Args, client *controller.Client) error {
+	src, dst := args.String["<src>"], args.String["<dst>"]
+	srcJob, srcPath := parseJobPath(src)
+	dstJob, dstPath := parseJobPath(dst)
+
+	switch {
+	case srcJob != "" && dstJob == "":
+		archive, err := client.CopyFromJob(mustApp(), srcJob, srcPath)
+		if err != nil {
+			return err
+		}
+		defer archive.Close()
+		if dst == "-" {
+			_, err = io.Copy(os.Stdout, archive)
+			return err
+		}
+		return extractArchive(archive, filepath.Base(srcPath), dst)
+	case srcJob == "" && dstJob != "":
+		if src == "-" {
+			return client.CopyToJob(mustApp(), dstJob, dstPath, os.Stdin)
+		}
+		if _, err := os.Lstat(src); err != nil {
+			return err
+		}
+		r, w := io.Pipe()
+		go func() {
+			w.CloseWithError(writeArchive(w, src))
+		}()
+		err := client.CopyToJob(mustApp(), dstJob, dstPath, r)
+		r.Close()
+		return err
+	default:
+		return errors.New("one of <src> and <dst> must be a job path, given as <job>:<path>")
+	}
+}
+
+// parseJobPath splits a <job>:<path> argument, returning an empty job ID for
+// local paths.
+func parseJobPath(s string) (string, string) {
+	i := strings.Index(s, ":")
+	if i <= 0 || strings.Contains(s[:i], "/") {
+		return "", s
+	}
+	return s[:i], s[i+1:]
+}
+
+// writeArchive writes a tar archive of the file or directory at path, with
+// entries named relative to the parent directory of path.
+func writeArchive(w io.Writer, path string) error {
+	tw := tar.NewWriter(w)
+	dir := filepath.Dir(filepath.Clean(path))
+	err := filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		var link string
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		if hdr.Name, err = filepath.Rel(dir, p); err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(hdr.Name)
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// extractArchive extracts an archive containing the entry base into dst. The
+// entry is extracted into dst if it is an existing directory, and is renamed
+// to dst otherwise. Entries are never written through symlinks, and symlinks
+// must point inside the extracted entry, so that an archive cannot write files
+// outside dst.
+func extractArchive(r io.Reader, base, dst string) error {
+	if info, err := os.Stat(dst); err == nil && info.IsDir() {
+		dst = filepath.Join(dst, base)
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		name := filepath.Clean(filepath.FromSlash(hdr.Name))
+		rel, err := filepath.Rel(base, name)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("unexpected path in archive: %s", hdr.Name)
+		}
+		path := filepath.Join(dst, rel)
+		mode := os.FileMode(hdr.Mode).Perm()
+		if err := checkNoSymlinks(dst, rel); err != nil {
+			return err
+		}
+		isLink := false
+		if info, err := os.Lstat(path); err == nil && rel != "." {
+			isLink = info.Mode()&os.ModeSymlink != 0
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if isLink {
+				return fmt.Errorf("refusing to write through symlink: %s", path)
+			}
+			if err := os.MkdirAll(path, mode); err != nil {
+				return err
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			if isLink {
+				os.Remove(path)
+			}
+			f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr)
+			f.Close()
+			if err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			target := filepath.Join(filepath.Dir(rel), filepath.FromSlash(hdr.Linkname))
+			if filepath.IsAbs(hdr.Linkname) || target == ".." || strings.HasPrefix(target, ".."+string(filepath.Separator)) {
+				return fmt.Errorf("unexpected symlink in archive: %s -> %s", hdr.Name, hdr.Linkname)
+			}
+			os.Remove(path)
+			if err := os.Symlink(hdr.Linkname, path); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// checkNoSymlinks returns an error if any of the directories between dst and
+// the entry rel inside it is a symlink.
+func checkNoSymlinks(dst, rel string) error {
+	dir := dst
+	for _, name := range strings.Split(filepath.Dir(rel), string(filepath.Separator)) {
+		if name == "." {
+			continue
+		}
+		dir = filepath.Join(dir, name)
+		info, err := os.Lstat(dir)
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("refusing to write through symlink: %s", dir)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-docopt"
+	"github.com/flynn/flynn/controller/client"
+)
+
+func init() {
+	register("drain", runDrain, `
+usage: flynn drain
+       flynn drain add <url>
+       flynn drain remove <id>
+
+Manage log drains for an app. The stdout and stderr lines of every job of the
+app are forwarded to each drain along with the app, release, type and job ID.
+
+Supported URL schemes:
+
+	syslog+tcp  RFC 5424 syslog over TCP
+	syslog+tls  RFC 5424 syslog over TLS
+	http, https batches of JSON encoded lines sent in POST requests
+
+Commands:
+	With no arguments, shows a list of log drains.
+
+	add     adds a log drain to an app
+	remove  removes a log drain
+
+Examples:
+
+	$ flynn drain add syslog+tls://logs.example.com:6514
+	Created log drain 0c8d2bb2d0e34c9d8d7eae4c3b2c1a9f.
+`)
+}
+
+func runDrain(args *docopt.Args, client *controller.Client) error {
+	if args.Bool["add"] {
+		return runDrainAdd(args, client)
+	} else if args.Bool["remove"] {
+		return runDrainRemove(args, client)
+	}
+
+	drains, err := client.LogDrainList(mustApp())
+	if err != nil {
+		return err
+	}
+
+	w := tabWriter()
+	defer w.Flush()
+
+	listRec(w, "ID", "URL")
+	for _, d := range drains {
+		listRec(w, d.ID, d.URL)
+	}
+	return nil
+}
+
+func runDrainAdd(args *docopt.Args, client *controller.Client) error {
+	drain, err := client.CreateLogDrain(mustApp(), args.String["<url>"])
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Created log drain %s.\n", drain.ID)
+	return nil
+}
+
+func runDrainRemove(args *docopt.Args, client *controller.Client) error {
+	id := args.String["<id>"]
+	if err := client.DeleteLogDrain(mustApp(), id); err != nil {
+		return err
+	}
+	fmt.Printf("Log drain %s removed.\n", id)
+	return nil
+}
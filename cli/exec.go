@@ -0,0 +1,106 @@
+package main
+
+import (
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/docker/docker/pkg/term"
+	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-docopt"
+	"github.com/flynn/flynn/controller/client"
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/pkg/cluster"
+	"github.com/flynn/flynn/pkg/shutdown"
+)
+
+func init() {
+	cmd := register("exec", runExec, `
+usage: flynn exec <job> [--] <command> [<argument>...]
+
+Run a command inside a running job.
+
+The command runs alongside the main process of the job, with the same
+environment and filesystem. A TTY is allocated if stdin and stdout are
+terminals.
+
+Example:
+
+	$ flynn exec 1d0b46ad-6ba5-41a0-a0b8-4a4b7d1e3ed6 -- ps aux
+`)
+	cmd.optsFirst = true
+}
+
+func runExec(args *docopt.Args, client *controller.Client) error {
+	req := &ct.JobExec{
+		Cmd: append([]string{args.String["<command>"]}, args.All["<argument>"].([]string)...),
+		TTY: term.IsTerminal(os.Stdin.Fd()) && term.IsTerminal(os.Stdout.Fd()),
+	}
+	if req.TTY {
+		ws, err := term.GetWinsize(os.Stdin.Fd())
+		if err != nil {
+			return err
+		}
+		req.Columns = int(ws.Width)
+		req.Lines = int(ws.Height)
+		req.Env = map[string]string{
+			"COLUMNS": strconv.Itoa(int(ws.Width)),
+			"LINES":   strconv.Itoa(int(ws.Height)),
+			"TERM":    os.Getenv("TERM"),
+		}
+	}
+
+	rwc, err := client.ExecJob(mustApp(), args.String["<job>"], req)
+	if err != nil {
+		return err
+	}
+	defer rwc.Close()
+	attachClient := cluster.NewAttachClient(rwc)
+
+	var termState *term.State
+	if req.TTY {
+		termState, err = term.MakeRaw(os.Stdin.Fd())
+		if err != nil {
+			return err
+		}
+		// Restore the terminal if we return without calling os.Exit
+		defer term.RestoreTerminal(os.Stdin.Fd(), termState)
+		go func() {
+			ch := make(chan os.Signal, 1)
+			signal.Notify(ch, SIGWINCH)
+			for range ch {
+				ws, err := term.GetWinsize(os.Stdin.Fd())
+				if err != nil {
+					return
+				}
+				attachClient.ResizeTTY(ws.Height, ws.Width)
+				attachClient.Signal(int(SIGWINCH))
+			}
+		}()
+	}
+
+	go func() {
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
+		for sig := range ch {
+			attachClient.Signal(int(sig.(syscall.Signal)))
+		}
+	}()
+
+	go func() {
+		io.Copy(attachClient, os.Stdin)
+		attachClient.CloseWrite()
+	}()
+
+	exitStatus, err := attachClient.Receive(os.Stdout, os.Stderr)
+	if err != nil {
+		return err
+	}
+	if req.TTY {
+		term.RestoreTerminal(os.Stdin.Fd(), termState)
+	}
+	shutdown.ExitWithCode(exitStatus)
+
+	panic("unreached")
+}
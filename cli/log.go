@@ -1,35 +1,47 @@
 package main
 
 import (
+	"fmt"
 	"io"
 	"os"
+	"time"
 
 	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-docopt"
 	"github.com/flynn/flynn/controller/client"
+	ct "github.com/flynn/flynn/controller/types"
 	"github.com/flynn/flynn/pkg/cluster"
 )
 
 func init() {
 	register("log", runLog, `
-usage: flynn log [options] <job>
+usage: flynn log [options] [<job>]
 
-Stream log for a specific job.
+Stream log for an app, or for a specific job.
+
+With no job, the lines of all jobs of the app are shown in timestamp order,
+prefixed with the timestamp, process type and job ID.
 
 Options:
+	-t, --type <type>   only show lines from jobs of this process type
 	-s, --split-stderr  send stderr lines to stderr
 	-f, --follow        stream new lines after printing log buffer
 `)
 }
 
 func runLog(args *docopt.Args, client *controller.Client) error {
-	rc, err := client.GetJobLog(mustApp(), args.String["<job>"], args.Bool["--follow"])
-	if err != nil {
-		return err
-	}
 	var stderr io.Writer = os.Stdout
 	if args.Bool["--split-stderr"] {
 		stderr = os.Stderr
 	}
+
+	if args.String["<job>"] == "" {
+		return runAppLog(args, client, stderr)
+	}
+
+	rc, err := client.GetJobLog(mustApp(), args.String["<job>"], args.Bool["--follow"])
+	if err != nil {
+		return err
+	}
 	attachClient := cluster.NewAttachClient(struct {
 		io.Writer
 		io.ReadCloser
@@ -37,3 +49,21 @@ func runLog(args *docopt.Args, client *controller.Client) error {
 	attachClient.Receive(os.Stdout, stderr)
 	return nil
 }
+
+func runAppLog(args *docopt.Args, client *controller.Client, stderr io.Writer) error {
+	ch := make(chan *ct.LogMessage)
+	stream, err := client.StreamAppLog(mustApp(), args.String["--type"], args.Bool["--follow"], ch)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	for msg := range ch {
+		var w io.Writer = os.Stdout
+		if msg.Stream == "stderr" {
+			w = stderr
+		}
+		fmt.Fprintf(w, "%s %s[%s]: %s\n", msg.Timestamp.Format(time.RFC3339), msg.Type, msg.JobID, msg.Message)
+	}
+	return stream.Err()
+}
@@ -48,8 +48,11 @@ Commands:
 	log       get job log
 	scale     change formation
 	run       run a job
+	exec      run a command in a running job
+	cp        copy files to and from a running job
 	env       manage env variables
 	route     manage routes
+	drain     manage log drains
 	provider  manage resource providers
 	resource  provision a new resource
 	key       manage SSH public keys
@@ -2,7 +2,9 @@ package main
 
 import (
 	"sort"
+	"time"
 
+	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/docker/docker/pkg/units"
 	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-docopt"
 	"github.com/flynn/flynn/controller/client"
 	ct "github.com/flynn/flynn/controller/types"
@@ -10,10 +12,13 @@ import (
 
 func init() {
 	register("ps", runPs, `
-usage: flynn ps
+usage: flynn ps [--stats]
 
 List flynn jobs.
 
+Options:
+	--stats  show the memory, CPU time and network and block IO used by each job
+
 Example:
 
 	$ flynn ps
@@ -21,6 +26,11 @@ Example:
 	flynn-bb97c7dac2fa455dad73459056fabac2  web
 	flynn-c59e02b3e6ad49809424848809d4749a  web
 	flynn-46f0d715a9684e4c822e248e84a5a418  web
+
+	$ flynn ps --stats
+	ID                                      TYPE  MEMORY    CPU     NET I/O            BLOCK I/O
+	flynn-bb97c7dac2fa455dad73459056fabac2  web   24.1 MiB  1.52s   1.2 MiB / 3.4 MiB  0 B / 12 KiB
+	flynn-c59e02b3e6ad49809424848809d4749a  web   23.8 MiB  1.49s   1.1 MiB / 3.2 MiB  0 B / 12 KiB
 `)
 }
 
@@ -34,7 +44,12 @@ func runPs(args *docopt.Args, client *controller.Client) error {
 	w := tabWriter()
 	defer w.Flush()
 
-	listRec(w, "ID", "TYPE")
+	showStats := args.Bool["--stats"]
+	if showStats {
+		listRec(w, "ID", "TYPE", "MEMORY", "CPU", "NET I/O", "BLOCK I/O")
+	} else {
+		listRec(w, "ID", "TYPE")
+	}
 	for _, j := range jobs {
 		if j.Type == "" {
 			j.Type = "run"
@@ -42,12 +57,31 @@ func runPs(args *docopt.Args, client *controller.Client) error {
 		if j.State != "up" {
 			continue
 		}
-		listRec(w, j.ID, j.Type)
+		if !showStats {
+			listRec(w, j.ID, j.Type)
+			continue
+		}
+		stats, err := client.GetJobStats(mustApp(), j.ID)
+		if err != nil {
+			// the job may have stopped since it was listed
+			listRec(w, j.ID, j.Type, "-", "-", "-", "-")
+			continue
+		}
+		listRec(w, j.ID, j.Type,
+			units.BytesSize(float64(stats.Memory.Usage)),
+			time.Duration(stats.CPU.Usage).String(),
+			ioPair(stats.Network.RxBytes, stats.Network.TxBytes),
+			ioPair(stats.BlockIO.ReadBytes, stats.BlockIO.WriteBytes),
+		)
 	}
 
 	return nil
 }
 
+func ioPair(in, out uint64) string {
+	return units.BytesSize(float64(in)) + " / " + units.BytesSize(float64(out))
+}
+
 type jobsByType []*ct.Job
 
 func (p jobsByType) Len() int           { return len(p) }
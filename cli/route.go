@@ -8,6 +8,7 @@ import (
 	"io/ioutil"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-docopt"
 	"github.com/flynn/flynn/controller/client"
@@ -17,29 +18,73 @@ import (
 func init() {
 	register("route", runRoute, `
 usage: flynn route
-       flynn route add http [-s <service>] [-c <tls-cert> -k <tls-key>] [--sticky] <domain>
-       flynn route add tcp [-s <service>]
+       flynn route add http [-s <service>] [-c <tls-cert> -k <tls-key> | --auto-tls] [--sticky] [--strip-path] [--rate <rate>] [--burst <burst>] [--max-conns <n>] [--limit-header <header>] <domain>
+       flynn route add tcp [-s <service>] [--proxy-protocol <version>] [--rate <rate>] [--burst <burst>] [--max-conns <n>]
+       flynn route update <id> [--allow-ips <ips>] [--deny-ips <ips>] [--basic-auth <htpasswd>]
        flynn route remove <id>
 
 Manage routes for application.
 
+HTTP routes can be limited to a path prefix by adding it to the domain, requests
+are routed using the longest matching prefix of their domain.
+
+Routes can limit the rate of requests, or of connections for TCP routes, and the
+number of concurrent requests or connections of each client. Clients are
+identified by IP address, or for HTTP routes by the value of a request header.
+Each router instance enforces the limits separately.
+
+HTTP routes can be restricted to clients from some IP addresses, or have some
+addresses blocked, and can require basic auth credentials. Credentials are read
+from an htpasswd file, which must use MD5 (the htpasswd default) or SHA1 hashes.
+
+HTTP routes can get certificates automatically from the ACME directory the
+router is configured with, which are renewed before they expire. The domain must
+resolve to the router and cannot be a wildcard.
+
 Options:
-	-s, --service <service>    service name to route domain to (defaults to APPNAME-web)
+	-s, --service <service>    service name to route domain to (defaults to APPNAME-web), or
+	                           a list of weighted services to split requests between (http only)
 	-c, --tls-cert <tls-cert>  path to PEM encoded certificate for TLS, - for stdin (http only)
 	-k, --tls-key <tls-key>    path to PEM encoded private key for TLS, - for stdin (http only)
+	--auto-tls                 obtain and renew a TLS certificate automatically (http only)
 	--sticky                   enable cookie-based sticky routing (http only)
+	--strip-path               remove the path prefix of the route from requests (http only)
+	--proxy-protocol <version> send a PROXY protocol header of version 1 or 2 to backends (tcp only)
+	--rate <rate>              maximum requests or connections per second of each client
+	--burst <burst>            requests or connections a client may make at once before the rate applies
+	--max-conns <n>            maximum concurrent requests or connections of each client
+	--limit-header <header>    identify clients by the value of a request header (http only)
+	--allow-ips <ips>          comma separated list of IP addresses or CIDR blocks to allow
+	                           requests from, "" to allow all (http only)
+	--deny-ips <ips>           comma separated list of IP addresses or CIDR blocks to deny
+	                           requests from, "" to deny none (http only)
+	--basic-auth <htpasswd>    path to an htpasswd file of credentials to require, - for stdin,
+	                           "" to require none (http only)
 
 Commands:
 	With no arguments, shows a list of routes.
 	
 	add     adds a route to an app
+	update  updates the access control of a route
 	remove  removes a route
 
 Examples:
 
 	$ flynn route add http example.com
 
+	$ flynn route add http -s api-web --strip-path example.com/api
+
+	$ flynn route add http --auto-tls example.com
+
+	$ flynn route add http -s myapp-web:90,myapp-canary-web:10 example.com
+
 	$ flynn route add tcp
+
+	$ flynn route add tcp --proxy-protocol 2
+
+	$ flynn route add http --rate 10 --burst 50 --limit-header Authorization api.example.com
+
+	$ flynn route update http/1ba949d1654e711d03b5f1e471426512 --allow-ips 10.0.0.0/8 --basic-auth .htpasswd
 `)
 }
 
@@ -53,6 +98,8 @@ func runRoute(args *docopt.Args, client *controller.Client) error {
 		default:
 			return fmt.Errorf("Route type %s not supported.", args.String["-t"])
 		}
+	} else if args.Bool["update"] {
+		return runRouteUpdate(args, client)
 	} else if args.Bool["remove"] {
 		return runRouteRemove(args, client)
 	}
@@ -75,7 +122,13 @@ func runRoute(args *docopt.Args, client *controller.Client) error {
 			service = k.TCPRoute().Service
 		case "http":
 			route = k.HTTPRoute().Domain
+			if path := k.HTTPRoute().Path; path != "" && path != "/" {
+				route += path
+			}
 			service = k.TCPRoute().Service
+			if services := k.HTTPRoute().Services; len(services) > 0 {
+				service = formatWeightedServices(services)
+			}
 			if k.HTTPRoute().TLSCert == "" {
 				protocol = "http"
 			} else {
@@ -93,7 +146,19 @@ func runRouteAddTCP(args *docopt.Args, client *controller.Client) error {
 		service = mustApp() + "-web"
 	}
 
-	hr := &router.TCPRoute{Service: service}
+	limits, err := parseLimits(args)
+	if err != nil {
+		return err
+	}
+
+	hr := &router.TCPRoute{Service: service, Limits: limits}
+	if v := args.String["--proxy-protocol"]; v != "" {
+		version, err := strconv.Atoi(v)
+		if err != nil || (version != 1 && version != 2) {
+			return errors.New("--proxy-protocol must be 1 or 2")
+		}
+		hr.ProxyProtocol = version
+	}
 	r := hr.ToRoute()
 	if err := client.CreateRoute(mustApp(), r); err != nil {
 		return err
@@ -137,12 +202,37 @@ func runRouteAddHTTP(args *docopt.Args, client *controller.Client) error {
 		return errors.New("Both the TLS certificate AND private key need to be specified")
 	}
 
+	// the domain may be followed by a path prefix, e.g. example.com/api
+	domain, path := args.String["<domain>"], ""
+	if i := strings.Index(domain, "/"); i != -1 {
+		domain, path = domain[:i], domain[i:]
+	}
+
+	var services []router.WeightedService
+	if strings.ContainsAny(service, ":,") {
+		var err error
+		if services, err = parseWeightedServices(service); err != nil {
+			return err
+		}
+		service = ""
+	}
+
+	limits, err := parseLimits(args)
+	if err != nil {
+		return err
+	}
+
 	hr := &router.HTTPRoute{
-		Service: service,
-		Domain:  args.String["<domain>"],
-		TLSCert: string(tlsCert),
-		TLSKey:  string(tlsKey),
-		Sticky:  args.Bool["sticky"],
+		Service:   service,
+		Services:  services,
+		Domain:    domain,
+		Path:      path,
+		StripPath: args.Bool["--strip-path"],
+		TLSCert:   string(tlsCert),
+		TLSKey:    string(tlsKey),
+		AutoTLS:   args.Bool["--auto-tls"],
+		Sticky:    args.Bool["sticky"],
+		Limits:    limits,
 	}
 	route := hr.ToRoute()
 	if err := client.CreateRoute(mustApp(), route); err != nil {
@@ -152,6 +242,69 @@ func runRouteAddHTTP(args *docopt.Args, client *controller.Client) error {
 	return nil
 }
 
+// parseWeightedServices parses a list of weighted services, given as
+// service:weight pairs separated by commas.
+func parseWeightedServices(s string) ([]router.WeightedService, error) {
+	var services []router.WeightedService
+	for _, pair := range strings.Split(s, ",") {
+		i := strings.LastIndex(pair, ":")
+		if i == -1 {
+			return nil, fmt.Errorf("Missing weight for service %q", pair)
+		}
+		weight, err := strconv.Atoi(pair[i+1:])
+		if err != nil || weight < 0 {
+			return nil, fmt.Errorf("Invalid weight for service %q", pair[:i])
+		}
+		services = append(services, router.WeightedService{Service: pair[:i], Weight: weight})
+	}
+	return services, nil
+}
+
+// parseLimits returns the limits of a route given as options, or nil if there
+// are none.
+func parseLimits(args *docopt.Args) (*router.Limits, error) {
+	limits := &router.Limits{Header: args.String["--limit-header"]}
+	if s := args.String["--rate"]; s != "" {
+		rate, err := strconv.ParseFloat(s, 64)
+		if err != nil || rate < 0 {
+			return nil, fmt.Errorf("Invalid rate %q", s)
+		}
+		limits.Rate = rate
+	}
+	for _, opt := range []struct {
+		name string
+		val  *int
+	}{
+		{"--burst", &limits.Burst},
+		{"--max-conns", &limits.MaxConns},
+	} {
+		s := args.String[opt.name]
+		if s == "" {
+			continue
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("Invalid %s %q", strings.TrimPrefix(opt.name, "--"), s)
+		}
+		*opt.val = n
+	}
+	if limits.Rate == 0 && limits.MaxConns == 0 {
+		if limits.Burst != 0 || limits.Header != "" {
+			return nil, errors.New("--burst and --limit-header require --rate or --max-conns")
+		}
+		return nil, nil
+	}
+	return limits, nil
+}
+
+func formatWeightedServices(services []router.WeightedService) string {
+	pairs := make([]string, len(services))
+	for i, s := range services {
+		pairs[i] = fmt.Sprintf("%s:%d", s.Service, s.Weight)
+	}
+	return strings.Join(pairs, ",")
+}
+
 func readPEM(typ string, path string, stdin []byte) ([]byte, error) {
 	if path == "-" {
 		var buf bytes.Buffer
@@ -173,6 +326,56 @@ func readPEM(typ string, path string, stdin []byte) ([]byte, error) {
 	return ioutil.ReadFile(path)
 }
 
+func runRouteUpdate(args *docopt.Args, client *controller.Client) error {
+	routeID := args.String["<id>"]
+	route, err := client.GetRoute(mustApp(), routeID)
+	if err != nil {
+		return err
+	}
+	if route.Type != "http" {
+		return errors.New("Only HTTP routes can be updated")
+	}
+	hr := route.HTTPRoute()
+
+	// options which are not given are nil rather than empty strings
+	if ips, ok := args.All["--allow-ips"].(string); ok {
+		hr.AllowIPs = splitList(ips)
+	}
+	if ips, ok := args.All["--deny-ips"].(string); ok {
+		hr.DenyIPs = splitList(ips)
+	}
+	if path, ok := args.All["--basic-auth"].(string); ok {
+		var data []byte
+		switch path {
+		case "":
+		case "-":
+			data, err = ioutil.ReadAll(os.Stdin)
+		default:
+			data, err = ioutil.ReadFile(path)
+		}
+		if err != nil {
+			return fmt.Errorf("Failed to read htpasswd file: %s", err)
+		}
+		hr.BasicAuth = string(data)
+	}
+
+	if err := client.UpdateRoute(mustApp(), routeID, hr.ToRoute()); err != nil {
+		return err
+	}
+	fmt.Printf("Route %s updated.\n", routeID)
+	return nil
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
 func runRouteRemove(args *docopt.Args, client *controller.Client) error {
 	routeID := args.String["<id>"]
 
@@ -137,7 +137,7 @@ loop:
 			switch e.Job.State {
 			case "up":
 				current[e.Job.Type]++
-			case "down", "crashed":
+			case "down", "crashed", "preempted":
 				current[e.Job.Type]--
 			}
 			if scalingComplete(current, processes) {
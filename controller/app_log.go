@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/pq"
+	"github.com/flynn/flynn/Godeps/_workspace/src/golang.org/x/net/context"
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/host/types"
+	"github.com/flynn/flynn/pkg/cluster"
+	"github.com/flynn/flynn/pkg/postgres"
+	"github.com/flynn/flynn/pkg/sse"
+)
+
+// AppLog streams the merged logs of the running jobs of an app, or of a single
+// process type if the type parameter is set. The existing lines are sent in
+// timestamp order, and if follow is set new lines are streamed from running
+// jobs and jobs as they start.
+func (c *controllerAPI) AppLog(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	app := c.getApp(ctx)
+	typ := req.FormValue("type")
+	follow := req.FormValue("follow") == "true"
+
+	// listen for new jobs before listing the existing ones so that none
+	// are missed
+	var listener *pq.Listener
+	if follow {
+		var err error
+		if listener, err = listenJobEvents(c.jobRepo.db, app.ID); err != nil {
+			respondWithError(w, err)
+			return
+		}
+		defer listener.Close()
+	}
+
+	jobs, err := c.jobRepo.List(app.ID)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	history := make(chan []*ct.LogMessage)
+	live := make(chan *ct.LogMessage)
+	streaming := make(map[string]struct{})
+	streamJob := func(job *ct.Job) {
+		streaming[job.ID] = struct{}{}
+		go c.streamJobLog(job, follow, history, live, done)
+	}
+	for _, job := range jobs {
+		// only running jobs are dialled, the logs of jobs which have
+		// stopped may be gone along with their host
+		if job.State != "starting" && job.State != "up" {
+			continue
+		}
+		if typ == "" || job.Type == typ {
+			streamJob(job)
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+	w.WriteHeader(200)
+	enc := json.NewEncoder(sse.NewWriter(w))
+	send := func(msgs ...*ct.LogMessage) error {
+		for _, msg := range msgs {
+			if err := enc.Encode(msg); err != nil {
+				return err
+			}
+		}
+		w.(http.Flusher).Flush()
+		return nil
+	}
+
+	// wait for the existing lines of every job so they can be sent in
+	// timestamp order
+	var msgs []*ct.LogMessage
+	for range streaming {
+		msgs = append(msgs, <-history...)
+	}
+	sort.Stable(logMessagesByTime(msgs))
+	if err := send(msgs...); err != nil || !follow {
+		return
+	}
+
+	closed := w.(http.CloseNotifier).CloseNotify()
+	for {
+		select {
+		case <-closed:
+			return
+		case msgs := <-history:
+			if err := send(msgs...); err != nil {
+				return
+			}
+		case msg := <-live:
+			if err := send(msg); err != nil {
+				return
+			}
+		case <-time.After(30 * time.Second):
+			if _, err := w.Write([]byte(":\n")); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+		case n, ok := <-listener.Notify:
+			if !ok {
+				return
+			}
+			if n == nil {
+				// the listener reconnected, so events may have been
+				// missed, but the jobs will be picked up from the
+				// events which follow
+				continue
+			}
+			id, err := strconv.ParseInt(n.Extra, 10, 64)
+			if err != nil {
+				return
+			}
+			e, err := c.jobRepo.getEvent(id)
+			if err != nil {
+				return
+			}
+			if _, ok := streaming[e.JobID]; ok || e.State != "up" || (typ != "" && e.Type != typ) {
+				continue
+			}
+			job := e.Job
+			job.ID = e.JobID
+			streamJob(&job)
+		}
+	}
+}
+
+// streamJobLog reads the log of a job, sending the existing lines to history
+// once they have all been read and then sending new lines to live if follow
+// is set. Jobs which can't be reached have an empty history.
+func (c *controllerAPI) streamJobLog(job *ct.Job, follow bool, history chan<- []*ct.LogMessage, live chan<- *ct.LogMessage, done <-chan struct{}) {
+	var msgs []*ct.LogMessage
+	sendHistory := func() bool {
+		select {
+		case history <- msgs:
+			msgs = nil
+			return true
+		case <-done:
+			return false
+		}
+	}
+	defer func() {
+		if msgs != nil {
+			sendHistory()
+		}
+	}()
+	msgs = []*ct.LogMessage{}
+
+	hostID, jobID, err := cluster.ParseJobID(job.ID)
+	if err != nil {
+		return
+	}
+	client, err := c.clusterClient.DialHost(hostID)
+	if err != nil {
+		return
+	}
+	ch := make(chan *host.LogMessage)
+	stream, err := client.StreamLog(jobID, follow, ch)
+	if err != nil {
+		return
+	}
+	defer stream.Close()
+
+	for {
+		select {
+		case msg, ok := <-ch:
+			if !ok {
+				return
+			}
+			if msg.Stream == "" {
+				// the end of the existing lines
+				if !sendHistory() {
+					return
+				}
+				continue
+			}
+			logMsg := &ct.LogMessage{
+				JobID:     job.ID,
+				Type:      job.Type,
+				Stream:    msg.Stream,
+				Timestamp: msg.Timestamp,
+				Message:   msg.Message,
+			}
+			if msgs != nil {
+				msgs = append(msgs, logMsg)
+				continue
+			}
+			select {
+			case live <- logMsg:
+			case <-done:
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// listenJobEvents returns a listener for the job events of an app, once it has
+// connected.
+func listenJobEvents(db *postgres.DB, appID string) (*pq.Listener, error) {
+	connected := make(chan error, 1)
+	listener := pq.NewListener(db.DSN(), 10*time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		switch ev {
+		case pq.ListenerEventConnected:
+			select {
+			case connected <- nil:
+			default:
+			}
+		case pq.ListenerEventConnectionAttemptFailed:
+			select {
+			case connected <- err:
+			default:
+			}
+		}
+	})
+	if err := listener.Listen("job_events:" + postgres.FormatUUID(appID)); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	select {
+	case err := <-connected:
+		if err != nil {
+			listener.Close()
+			return nil, err
+		}
+	case <-time.After(10 * time.Second):
+		listener.Close()
+		return nil, errors.New("controller: timed out connecting to the database")
+	}
+	return listener, nil
+}
+
+type logMessagesByTime []*ct.LogMessage
+
+func (m logMessagesByTime) Len() int           { return len(m) }
+func (m logMessagesByTime) Less(i, j int) bool { return m[i].Timestamp.Before(m[j].Timestamp) }
+func (m logMessagesByTime) Swap(i, j int)      { m[i], m[j] = m[j], m[i] }
@@ -13,6 +13,7 @@ import (
 	"time"
 
 	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/host/types"
 	"github.com/flynn/flynn/pkg/httpclient"
 	"github.com/flynn/flynn/pkg/pinned"
 	"github.com/flynn/flynn/pkg/stream"
@@ -212,6 +213,11 @@ func (c *Client) CreateRoute(appID string, route *router.Route) error {
 	return c.Post(fmt.Sprintf("/apps/%s/routes", appID), route, route)
 }
 
+// UpdateRoute replaces the config of a route under the specified app.
+func (c *Client) UpdateRoute(appID string, routeID string, route *router.Route) error {
+	return c.Put(fmt.Sprintf("/apps/%s/routes/%s", appID, routeID), route, route)
+}
+
 // DeleteRoute deletes a route under the specified app.
 func (c *Client) DeleteRoute(appID string, routeID string) error {
 	return c.Delete(fmt.Sprintf("/apps/%s/routes/%s", appID, routeID))
@@ -343,6 +349,56 @@ func (c *Client) GetJobLogWithWait(appID, jobID string, tail bool) (io.ReadClose
 	return res.Body, nil
 }
 
+// StreamAppLog streams the log lines of all jobs of an app, or of a single
+// process type if typ is set, to the output channel in timestamp order. If
+// follow is set, new lines are streamed until the stream is closed.
+func (c *Client) StreamAppLog(appID, typ string, follow bool, output chan<- *ct.LogMessage) (stream.Stream, error) {
+	path := fmt.Sprintf("/apps/%s/log?follow=%t", appID, follow)
+	if typ != "" {
+		path += "&type=" + url.QueryEscape(typ)
+	}
+	return c.Stream("GET", path, nil, output)
+}
+
+// GetJobStats returns the resource usage of a running job.
+func (c *Client) GetJobStats(appID, jobID string) (*host.JobStats, error) {
+	stats := &host.JobStats{}
+	return stats, c.Get(fmt.Sprintf("/apps/%s/jobs/%s/stats", appID, jobID), stats)
+}
+
+// StreamJobStats streams the resource usage of a running job to the output
+// channel every interval until the job stops.
+func (c *Client) StreamJobStats(appID, jobID string, interval time.Duration, output chan<- *host.JobStats) (stream.Stream, error) {
+	return c.Stream("GET", fmt.Sprintf("/apps/%s/jobs/%s/stats?interval=%s", appID, jobID, interval), nil, output)
+}
+
+// ExecJob runs a command inside the running job with the given ID and returns
+// a connection to its stdio which uses the attach protocol.
+func (c *Client) ExecJob(appID, jobID string, req *ct.JobExec) (httpclient.ReadWriteCloser, error) {
+	return c.Hijack("POST", fmt.Sprintf("/apps/%s/jobs/%s/exec", appID, jobID), http.Header{"Upgrade": {"flynn-attach/0"}}, req)
+}
+
+// CopyFromJob returns a tar archive of path inside the running job with the
+// given ID. The archive contains path itself, under its base name.
+func (c *Client) CopyFromJob(appID, jobID, path string) (io.ReadCloser, error) {
+	res, err := c.RawReq("GET", fmt.Sprintf("/apps/%s/jobs/%s/files?path=%s", appID, jobID, url.QueryEscape(path)), nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+// CopyToJob extracts a tar archive into the directory path inside the running
+// job with the given ID.
+func (c *Client) CopyToJob(appID, jobID, path string, archive io.Reader) error {
+	header := http.Header{"Content-Type": {"application/x-tar"}}
+	res, err := c.RawReq("PUT", fmt.Sprintf("/apps/%s/jobs/%s/files?path=%s", appID, jobID, url.QueryEscape(path)), header, archive, nil)
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
 // RunJobAttached runs a new job under the specified app, attaching to the job
 // and returning a ReadWriteCloser stream, which can then be used for
 // communicating with the job.
@@ -410,6 +466,36 @@ func (c *Client) DeleteKey(id string) error {
 	return c.Delete("/keys/" + strings.Replace(id, ":", "", -1))
 }
 
+// CreateLogDrain adds a drain which receives the log output of all jobs of
+// the app.
+func (c *Client) CreateLogDrain(appID, url string) (*ct.LogDrain, error) {
+	drain := &ct.LogDrain{}
+	return drain, c.Post(fmt.Sprintf("/apps/%s/log_drains", appID), &ct.LogDrain{URL: url}, drain)
+}
+
+// LogDrainList returns the log drains of the app.
+func (c *Client) LogDrainList(appID string) ([]*ct.LogDrain, error) {
+	var drains []*ct.LogDrain
+	return drains, c.Get(fmt.Sprintf("/apps/%s/log_drains", appID), &drains)
+}
+
+// DeleteLogDrain removes a log drain from the app.
+func (c *Client) DeleteLogDrain(appID, drainID string) error {
+	return c.Delete(fmt.Sprintf("/apps/%s/log_drains/%s", appID, drainID))
+}
+
+// SetNetworkPolicy replaces the network policy of the app. Dependencies may
+// be given as app names or IDs, and are returned as IDs.
+func (c *Client) SetNetworkPolicy(appID string, policy *ct.NetworkPolicy) error {
+	return c.Put(fmt.Sprintf("/apps/%s/network_policy", appID), policy, policy)
+}
+
+// GetNetworkPolicy returns the network policy of the app.
+func (c *Client) GetNetworkPolicy(appID string) (*ct.NetworkPolicy, error) {
+	policy := &ct.NetworkPolicy{}
+	return policy, c.Get(fmt.Sprintf("/apps/%s/network_policy", appID), policy)
+}
+
 // ProviderList returns a list of all providers.
 func (c *Client) ProviderList() ([]*ct.Provider, error) {
 	var providers []*ct.Provider
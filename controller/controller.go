@@ -128,20 +128,24 @@ func appHandler(c handlerConfig) http.Handler {
 	artifactRepo := NewArtifactRepo(c.db)
 	releaseRepo := NewReleaseRepo(c.db)
 	jobRepo := NewJobRepo(c.db)
-	formationRepo := NewFormationRepo(c.db, appRepo, releaseRepo, artifactRepo)
+	logDrainRepo := NewLogDrainRepo(c.db)
+	networkPolicyRepo := NewNetworkPolicyRepo(c.db, appRepo)
+	formationRepo := NewFormationRepo(c.db, appRepo, releaseRepo, artifactRepo, logDrainRepo, networkPolicyRepo)
 	deploymentRepo := NewDeploymentRepo(c.db, c.pgxpool)
 
 	api := controllerAPI{
-		appRepo:        appRepo,
-		releaseRepo:    releaseRepo,
-		providerRepo:   providerRepo,
-		formationRepo:  formationRepo,
-		artifactRepo:   artifactRepo,
-		jobRepo:        jobRepo,
-		resourceRepo:   resourceRepo,
-		deploymentRepo: deploymentRepo,
-		clusterClient:  c.cc,
-		routerc:        c.sc,
+		appRepo:           appRepo,
+		releaseRepo:       releaseRepo,
+		providerRepo:      providerRepo,
+		formationRepo:     formationRepo,
+		artifactRepo:      artifactRepo,
+		jobRepo:           jobRepo,
+		resourceRepo:      resourceRepo,
+		deploymentRepo:    deploymentRepo,
+		logDrainRepo:      logDrainRepo,
+		networkPolicyRepo: networkPolicyRepo,
+		clusterClient:     c.cc,
+		routerc:           c.sc,
 	}
 
 	httpRouter := httprouter.New()
@@ -164,6 +168,18 @@ func appHandler(c handlerConfig) http.Handler {
 	httpRouter.GET("/apps/:apps_id/jobs", httphelper.WrapHandler(api.appLookup(api.ListJobs)))
 	httpRouter.DELETE("/apps/:apps_id/jobs/:jobs_id", httphelper.WrapHandler(api.appLookup(api.KillJob)))
 	httpRouter.GET("/apps/:apps_id/jobs/:jobs_id/log", httphelper.WrapHandler(api.appLookup(api.JobLog)))
+	httpRouter.GET("/apps/:apps_id/jobs/:jobs_id/stats", httphelper.WrapHandler(api.appLookup(api.JobStats)))
+	httpRouter.POST("/apps/:apps_id/jobs/:jobs_id/exec", httphelper.WrapHandler(api.appLookup(api.ExecJob)))
+	httpRouter.GET("/apps/:apps_id/jobs/:jobs_id/files", httphelper.WrapHandler(api.appLookup(api.CopyFromJob)))
+	httpRouter.PUT("/apps/:apps_id/jobs/:jobs_id/files", httphelper.WrapHandler(api.appLookup(api.CopyToJob)))
+
+	httpRouter.GET("/apps/:apps_id/log", httphelper.WrapHandler(api.appLookup(api.AppLog)))
+	httpRouter.POST("/apps/:apps_id/log_drains", httphelper.WrapHandler(api.appLookup(api.CreateLogDrain)))
+	httpRouter.GET("/apps/:apps_id/log_drains", httphelper.WrapHandler(api.appLookup(api.ListLogDrains)))
+	httpRouter.DELETE("/apps/:apps_id/log_drains/:drains_id", httphelper.WrapHandler(api.appLookup(api.DeleteLogDrain)))
+
+	httpRouter.PUT("/apps/:apps_id/network_policy", httphelper.WrapHandler(api.appLookup(api.SetNetworkPolicy)))
+	httpRouter.GET("/apps/:apps_id/network_policy", httphelper.WrapHandler(api.appLookup(api.GetNetworkPolicy)))
 
 	httpRouter.POST("/apps/:apps_id/deploy", httphelper.WrapHandler(api.appLookup(api.CreateDeployment)))
 	httpRouter.GET("/deployments/:deployment_id", httphelper.WrapHandler(api.GetDeployment))
@@ -180,6 +196,7 @@ func appHandler(c handlerConfig) http.Handler {
 	httpRouter.POST("/apps/:apps_id/routes", httphelper.WrapHandler(api.appLookup(api.CreateRoute)))
 	httpRouter.GET("/apps/:apps_id/routes", httphelper.WrapHandler(api.appLookup(api.GetRouteList)))
 	httpRouter.GET("/apps/:apps_id/routes/:routes_type/:routes_id", httphelper.WrapHandler(api.appLookup(api.GetRoute)))
+	httpRouter.PUT("/apps/:apps_id/routes/:routes_type/:routes_id", httphelper.WrapHandler(api.appLookup(api.UpdateRoute)))
 	httpRouter.DELETE("/apps/:apps_id/routes/:routes_type/:routes_id", httphelper.WrapHandler(api.appLookup(api.DeleteRoute)))
 
 	return httphelper.ContextInjector("controller",
@@ -206,16 +223,18 @@ func muxHandler(main http.Handler, authKey string) http.Handler {
 }
 
 type controllerAPI struct {
-	appRepo        *AppRepo
-	releaseRepo    *ReleaseRepo
-	providerRepo   *ProviderRepo
-	formationRepo  *FormationRepo
-	artifactRepo   *ArtifactRepo
-	jobRepo        *JobRepo
-	resourceRepo   *ResourceRepo
-	deploymentRepo *DeploymentRepo
-	clusterClient  clusterClient
-	routerc        routerc.Client
+	appRepo           *AppRepo
+	releaseRepo       *ReleaseRepo
+	providerRepo      *ProviderRepo
+	formationRepo     *FormationRepo
+	artifactRepo      *ArtifactRepo
+	jobRepo           *JobRepo
+	resourceRepo      *ResourceRepo
+	deploymentRepo    *DeploymentRepo
+	logDrainRepo      *LogDrainRepo
+	networkPolicyRepo *NetworkPolicyRepo
+	clusterClient     clusterClient
+	routerc           routerc.Client
 }
 
 func (c *controllerAPI) getApp(ctx context.Context) *ct.App {
@@ -15,6 +15,7 @@ import (
 	"github.com/flynn/flynn/controller/client"
 	tu "github.com/flynn/flynn/controller/testutils"
 	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/pkg/httphelper"
 	"github.com/flynn/flynn/pkg/postgres"
 	"github.com/flynn/flynn/pkg/random"
 	"github.com/flynn/flynn/pkg/testutils"
@@ -257,6 +258,47 @@ func (s *S) TestCreateRelease(c *C) {
 	}
 }
 
+func (s *S) TestCreateReleaseStopConfig(c *C) {
+	out := s.createTestRelease(c, &ct.Release{Processes: map[string]ct.ProcessType{
+		"web": {Cmd: []string{"start"}, StopSignal: "SIGQUIT", StopTimeout: 30},
+	}})
+	gotRelease, err := s.c.GetRelease(out.ID)
+	c.Assert(err, IsNil)
+	c.Assert(gotRelease.Processes["web"].StopSignal, Equals, "SIGQUIT")
+	c.Assert(gotRelease.Processes["web"].StopTimeout, Equals, 30)
+
+	for _, t := range []ct.ProcessType{
+		{StopSignal: "SIGFOO"},
+		{StopTimeout: -1},
+	} {
+		err := s.c.CreateRelease(&ct.Release{Processes: map[string]ct.ProcessType{"web": t}})
+		c.Assert(err, NotNil)
+		c.Assert(err.(httphelper.JSONError).Code, Equals, httphelper.ValidationError)
+	}
+}
+
+func (s *S) TestCreateReleaseHealthCheck(c *C) {
+	check := &ct.HealthCheck{Type: "http", Path: "/status", Interval: 5, StartTimeout: 120}
+	out := s.createTestRelease(c, &ct.Release{Processes: map[string]ct.ProcessType{
+		"web": {Cmd: []string{"start"}, HealthCheck: check},
+	}})
+	gotRelease, err := s.c.GetRelease(out.ID)
+	c.Assert(err, IsNil)
+	c.Assert(gotRelease.Processes["web"].HealthCheck, DeepEquals, check)
+
+	for _, check := range []*ct.HealthCheck{
+		{},
+		{Type: "udp"},
+		{Type: "exec"},
+		{Type: "tcp", Port: 70000},
+		{Type: "tcp", Threshold: -1},
+	} {
+		err := s.c.CreateRelease(&ct.Release{Processes: map[string]ct.ProcessType{"web": {HealthCheck: check}}})
+		c.Assert(err, NotNil)
+		c.Assert(err.(httphelper.JSONError).Code, Equals, httphelper.ValidationError)
+	}
+}
+
 func (s *S) TestCreateFormation(c *C) {
 	for i, useName := range []bool{false, true} {
 		release := s.createTestRelease(c, &ct.Release{})
@@ -23,6 +23,16 @@ func allAtOnce(l log15.Logger, client *controller.Client, d *ct.Deployment, even
 		log.Error("Failed to fetch the old formation", "at", "get_formation", "err", err)
 		return err
 	}
+	timeout, err := stopTimeout(client, d.OldReleaseID)
+	if err != nil {
+		log.Error("Failed to fetch the old release", "at", "get_release", "err", err)
+		return err
+	}
+	upTimeout, err := startTimeout(client, d.NewReleaseID)
+	if err != nil {
+		log.Error("Failed to fetch the new release", "at", "get_release", "err", err)
+		return err
+	}
 
 	if err := client.PutFormation(&ct.Formation{
 		AppID:     d.AppID,
@@ -43,7 +53,7 @@ func allAtOnce(l log15.Logger, client *controller.Client, d *ct.Deployment, even
 		}
 		expect[d.NewReleaseID] = map[string]map[string]int{typ: {"up": n}}
 	}
-	if err := waitForJobEvents(jobStream, events, expect); err != nil {
+	if err := waitForJobEvents(jobStream, events, expect, upTimeout); err != nil {
 		log.Error("Error during waiting for job events", "at", "wait", "err", err)
 		return err
 	}
@@ -66,7 +76,7 @@ func allAtOnce(l log15.Logger, client *controller.Client, d *ct.Deployment, even
 		}
 		expect[d.OldReleaseID] = map[string]map[string]int{typ: {"down": n}}
 	}
-	if err := waitForJobEvents(jobStream, events, expect); err != nil {
+	if err := waitForJobEvents(jobStream, events, expect, timeout); err != nil {
 		log.Error("Error during waiting for job events", "at", "wait", "err", err)
 		return err
 	}
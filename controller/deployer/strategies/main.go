@@ -7,6 +7,7 @@ import (
 	"github.com/flynn/flynn/Godeps/_workspace/src/gopkg.in/inconshreveable/log15.v2"
 	"github.com/flynn/flynn/controller/client"
 	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/host/types"
 )
 
 type PerformFunc func(log15.Logger, *controller.Client, *ct.Deployment, chan<- ct.DeploymentEvent) error
@@ -47,7 +48,50 @@ func jobEventsEqual(expected, actual jobEvents) bool {
 
 type jobEvents map[string]map[string]map[string]int
 
-func waitForJobEvents(events chan *ct.JobEvent, deployEvents chan<- ct.DeploymentEvent, expected jobEvents) error {
+// jobEventTimeout is how long to wait for the expected job events before
+// failing the deployment.
+const jobEventTimeout = 60 * time.Second
+
+// stopTimeout returns how long to wait for the jobs of a release to stop,
+// allowing for the longest stop timeout of its process types.
+func stopTimeout(client *controller.Client, releaseID string) (time.Duration, error) {
+	release, err := client.GetRelease(releaseID)
+	if err != nil {
+		return 0, err
+	}
+	timeout := jobEventTimeout
+	for _, t := range release.Processes {
+		if d := jobEventTimeout + time.Duration(t.StopTimeout)*time.Second; d > timeout {
+			timeout = d
+		}
+	}
+	return timeout, nil
+}
+
+// startTimeout returns how long to wait for the jobs of a release to be up,
+// allowing for the longest health check start timeout of its process types.
+func startTimeout(client *controller.Client, releaseID string) (time.Duration, error) {
+	release, err := client.GetRelease(releaseID)
+	if err != nil {
+		return 0, err
+	}
+	timeout := jobEventTimeout
+	for _, t := range release.Processes {
+		if t.HealthCheck == nil {
+			continue
+		}
+		start := host.DefaultHealthCheckStartTimeout
+		if t.HealthCheck.StartTimeout > 0 {
+			start = time.Duration(t.HealthCheck.StartTimeout) * time.Second
+		}
+		if d := jobEventTimeout + start; d > timeout {
+			timeout = d
+		}
+	}
+	return timeout, nil
+}
+
+func waitForJobEvents(events chan *ct.JobEvent, deployEvents chan<- ct.DeploymentEvent, expected jobEvents, timeout time.Duration) error {
 	fmt.Printf("waiting for job events: %v\n", expected)
 	actual := make(jobEvents)
 	for {
@@ -84,13 +128,20 @@ func waitForJobEvents(events chan *ct.JobEvent, deployEvents chan<- ct.Deploymen
 					JobType:   event.Type,
 				}
 				return fmt.Errorf("job crashed!")
+			case "unhealthy":
+				deployEvents <- ct.DeploymentEvent{
+					ReleaseID: event.Job.ReleaseID,
+					JobState:  "unhealthy",
+					JobType:   event.Type,
+				}
+				return fmt.Errorf("job unhealthy!")
 			default:
 				break inner
 			}
 			if jobEventsEqual(expected, actual) {
 				return nil
 			}
-		case <-time.After(60 * time.Second):
+		case <-time.After(timeout):
 			return fmt.Errorf("timed out waiting for job events: ", expected)
 		}
 	}
@@ -23,6 +23,16 @@ func oneByOne(l log15.Logger, client *controller.Client, d *ct.Deployment, event
 		log.Error("Failed fetching the old formation", "at", "get_formation", "err", err)
 		return err
 	}
+	timeout, err := stopTimeout(client, d.OldReleaseID)
+	if err != nil {
+		log.Error("Failed fetching the old release", "at", "get_release", "err", err)
+		return err
+	}
+	upTimeout, err := startTimeout(client, d.NewReleaseID)
+	if err != nil {
+		log.Error("Failed fetching the new release", "at", "get_release", "err", err)
+		return err
+	}
 
 	oldFormation := f.Processes
 	newFormation := map[string]int{}
@@ -44,7 +54,7 @@ func oneByOne(l log15.Logger, client *controller.Client, d *ct.Deployment, event
 				JobState:  "starting",
 				JobType:   typ,
 			}
-			if err := waitForJobEvents(jobStream, events, jobEvents{d.NewReleaseID: {typ: {"up": 1}}}); err != nil {
+			if err := waitForJobEvents(jobStream, events, jobEvents{d.NewReleaseID: {typ: {"up": 1}}}, upTimeout); err != nil {
 				log.Error("Error during waiting for job events", "at", "wait", "err", err)
 				return err
 			}
@@ -63,7 +73,7 @@ func oneByOne(l log15.Logger, client *controller.Client, d *ct.Deployment, event
 				JobState:  "stopping",
 				JobType:   typ,
 			}
-			if err := waitForJobEvents(jobStream, events, jobEvents{d.OldReleaseID: {typ: {"down": 1}}}); err != nil {
+			if err := waitForJobEvents(jobStream, events, jobEvents{d.OldReleaseID: {typ: {"down": 1}}}, timeout); err != nil {
 				log.Error("Error during waiting for job events", "at", "wait", "err", err)
 				return err
 			}
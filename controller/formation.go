@@ -28,18 +28,22 @@ type FormationRepo struct {
 	apps      *AppRepo
 	releases  *ReleaseRepo
 	artifacts *ArtifactRepo
+	drains    *LogDrainRepo
+	policies  *NetworkPolicyRepo
 
 	subscriptions map[chan<- *ct.ExpandedFormation]struct{}
 	stopListener  chan struct{}
 	subMtx        sync.RWMutex
 }
 
-func NewFormationRepo(db *postgres.DB, appRepo *AppRepo, releaseRepo *ReleaseRepo, artifactRepo *ArtifactRepo) *FormationRepo {
+func NewFormationRepo(db *postgres.DB, appRepo *AppRepo, releaseRepo *ReleaseRepo, artifactRepo *ArtifactRepo, logDrainRepo *LogDrainRepo, networkPolicyRepo *NetworkPolicyRepo) *FormationRepo {
 	return &FormationRepo{
 		db:            db,
 		apps:          appRepo,
 		releases:      releaseRepo,
 		artifacts:     artifactRepo,
+		drains:        logDrainRepo,
+		policies:      networkPolicyRepo,
 		subscriptions: make(map[chan<- *ct.ExpandedFormation]struct{}),
 		stopListener:  make(chan struct{}),
 	}
@@ -121,6 +125,13 @@ func (r *FormationRepo) Remove(appID, releaseID string) error {
 	return nil
 }
 
+// Touch marks the formations of an app as updated so that subscribers such as
+// the scheduler receive them again, along with the app's log drains and
+// network policy.
+func (r *FormationRepo) Touch(appID string) error {
+	return r.db.Exec("UPDATE formations SET updated_at = now() WHERE app_id = $1 AND deleted_at IS NULL", appID)
+}
+
 func (r *FormationRepo) publish(appID, releaseID string) {
 	formation, err := r.Get(appID, releaseID)
 	if err == ErrNotFound {
@@ -160,12 +171,22 @@ func (r *FormationRepo) expandFormation(formation *ct.Formation) (*ct.ExpandedFo
 	if err != nil {
 		return nil, err
 	}
+	drains, err := r.drains.List(formation.AppID)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := r.policies.Get(formation.AppID)
+	if err != nil {
+		return nil, err
+	}
 	f := &ct.ExpandedFormation{
-		App:       app.(*ct.App),
-		Release:   release.(*ct.Release),
-		Artifact:  artifact.(*ct.Artifact),
-		Processes: formation.Processes,
-		UpdatedAt: *formation.UpdatedAt,
+		App:           app.(*ct.App),
+		Release:       release.(*ct.Release),
+		Artifact:      artifact.(*ct.Artifact),
+		Processes:     formation.Processes,
+		LogDrains:     drains,
+		NetworkPolicy: policy,
+		UpdatedAt:     *formation.UpdatedAt,
 	}
 	return f, nil
 }
@@ -5,8 +5,48 @@ import (
 
 	. "github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-check"
 	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/pkg/stream"
 )
 
+// appFormationStream streams formation updates for an app.
+type appFormationStream struct {
+	stream.Stream
+	appID   string
+	updates chan *ct.ExpandedFormation
+}
+
+// streamAppFormation streams the formations updated since since, returning
+// the stream and the last formation of appID sent before the stream caught
+// up, which must exist.
+func (s *S) streamAppFormation(c *C, appID string, since time.Time) (*appFormationStream, *ct.ExpandedFormation) {
+	updates := make(chan *ct.ExpandedFormation)
+	str, err := s.c.StreamFormations(&since, updates)
+	c.Assert(err, IsNil)
+	var current *ct.ExpandedFormation
+	for f := range updates {
+		if f.App == nil {
+			break
+		}
+		if f.App.ID == appID {
+			current = f
+		}
+	}
+	c.Assert(current, NotNil)
+	return &appFormationStream{Stream: str, appID: appID, updates: updates}, current
+}
+
+// Next waits for the next formation update, which must be for the app.
+func (s *appFormationStream) Next(c *C) *ct.ExpandedFormation {
+	select {
+	case f := <-s.updates:
+		c.Assert(f.App.ID, Equals, s.appID)
+		return f
+	case <-time.After(time.Second):
+		c.Fatal("timed out waiting for formation update")
+	}
+	return nil
+}
+
 func (s *S) TestFormationStreaming(c *C) {
 	before := time.Now()
 	release := s.createTestRelease(c, &ct.Release{})
@@ -244,6 +244,57 @@ func (c *controllerAPI) PutJob(ctx context.Context, w http.ResponseWriter, req *
 	httphelper.JSON(w, 200, &job)
 }
 
+func (c *controllerAPI) ExecJob(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	var execJob ct.JobExec
+	if err := httphelper.DecodeJSON(req, &execJob); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	if len(execJob.Cmd) == 0 {
+		respondWithError(w, ct.ValidationError{Field: "cmd", Message: "must not be empty"})
+		return
+	}
+
+	hc, jobID, err := c.connectHost(ctx)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	attachClient, err := hc.Exec(&host.ExecReq{
+		JobID:  jobID,
+		Cmd:    execJob.Cmd,
+		Env:    execJob.Env,
+		TTY:    execJob.TTY,
+		Flags:  host.AttachFlagStdout | host.AttachFlagStderr | host.AttachFlagStdin,
+		Height: uint16(execJob.Lines),
+		Width:  uint16(execJob.Columns),
+	})
+	if err != nil {
+		respondWithError(w, fmt.Errorf("exec failed: %s", err.Error()))
+		return
+	}
+	defer attachClient.Close()
+
+	w.Header().Set("Connection", "upgrade")
+	w.Header().Set("Upgrade", "flynn-attach/0")
+	w.WriteHeader(http.StatusSwitchingProtocols)
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		panic(err)
+	}
+	defer conn.Close()
+
+	done := make(chan struct{}, 2)
+	cp := func(to io.Writer, from io.Reader) {
+		io.Copy(to, from)
+		done <- struct{}{}
+	}
+	go cp(conn, attachClient.Conn())
+	go cp(attachClient.Conn(), conn)
+	<-done
+	<-done
+}
+
 func (c *controllerAPI) JobLog(ctx context.Context, w http.ResponseWriter, req *http.Request) {
 	hc, jobID, err := c.connectHost(ctx)
 	if err != nil {
@@ -309,6 +360,114 @@ func (c *controllerAPI) JobLog(ctx context.Context, w http.ResponseWriter, req *
 	}
 }
 
+// CopyFromJob streams a tar archive of a path inside a running job.
+func (c *controllerAPI) CopyFromJob(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	path := req.FormValue("path")
+	if path == "" {
+		respondWithError(w, ct.ValidationError{Field: "path", Message: "must not be blank"})
+		return
+	}
+	hc, jobID, err := c.connectHost(ctx)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	archive, err := hc.CopyFrom(jobID, path)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	defer archive.Close()
+	w.Header().Set("Content-Type", "application/x-tar")
+	w.WriteHeader(200)
+	io.Copy(w, archive)
+}
+
+// CopyToJob extracts a tar archive into a directory inside a running job.
+func (c *controllerAPI) CopyToJob(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	path := req.FormValue("path")
+	if path == "" {
+		respondWithError(w, ct.ValidationError{Field: "path", Message: "must not be blank"})
+		return
+	}
+	hc, jobID, err := c.connectHost(ctx)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	if err := hc.CopyTo(jobID, path, req.Body); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	w.WriteHeader(200)
+}
+
+// minStatsInterval is the shortest interval at which job stats are streamed,
+// as hosts read them from cgroup and /proc files each time.
+const minStatsInterval = 100 * time.Millisecond
+
+func (c *controllerAPI) JobStats(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	hc, jobID, err := c.connectHost(ctx)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	// report stats using the cluster job ID rather than the host job ID
+	clusterJobID := httphelper.ParamsFromContext(ctx).ByName("jobs_id")
+
+	if !strings.Contains(req.Header.Get("Accept"), "text/event-stream") {
+		stats, err := hc.GetJobStats(jobID)
+		if err != nil {
+			respondWithError(w, err)
+			return
+		}
+		stats.JobID = clusterJobID
+		httphelper.JSON(w, 200, stats)
+		return
+	}
+
+	interval := time.Second
+	if s := req.FormValue("interval"); s != "" {
+		interval, err = time.ParseDuration(s)
+		if err != nil {
+			respondWithError(w, ct.ValidationError{Field: "interval", Message: "is invalid"})
+			return
+		}
+		if interval < minStatsInterval {
+			respondWithError(w, ct.ValidationError{Field: "interval", Message: "must be at least " + minStatsInterval.String()})
+			return
+		}
+	}
+	ch := make(chan *host.JobStats)
+	stream, err := hc.StreamJobStats(jobID, interval, ch)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	defer stream.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+	w.WriteHeader(200)
+	w.(http.Flusher).Flush()
+	enc := json.NewEncoder(sse.NewWriter(w))
+	closed := w.(http.CloseNotifier).CloseNotify()
+	for {
+		select {
+		case stats, ok := <-ch:
+			if !ok {
+				return
+			}
+			stats.JobID = clusterJobID
+			if err := enc.Encode(stats); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+		case <-closed:
+			return
+		}
+	}
+}
+
 func streamJobs(req *http.Request, w http.ResponseWriter, app *ct.App, repo *JobRepo) (err error) {
 	var lastID int64
 	if req.Header.Get("Last-Event-Id") != "" {
@@ -494,6 +653,14 @@ func (c *controllerAPI) RunJob(ctx context.Context, w http.ResponseWriter, req *
 	if len(newJob.Entrypoint) > 0 {
 		job.Config.Entrypoint = newJob.Entrypoint
 	}
+	drains, err := c.logDrainRepo.List(app.ID)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	for _, d := range drains {
+		job.LogDrains = append(job.LogDrains, d.URL)
+	}
 
 	hosts, err := c.clusterClient.ListHosts()
 	if err != nil {
@@ -505,7 +672,15 @@ func (c *controllerAPI) RunJob(ctx context.Context, w http.ResponseWriter, req *
 		return
 	}
 
-	hostID := schedutil.PickHost(hosts).ID
+	h := schedutil.PickHost(hosts, job)
+	if h == nil {
+		respondWithError(w, httphelper.JSONError{
+			Code:    httphelper.UnavailableError,
+			Message: "no hosts have capacity for the job",
+		})
+		return
+	}
+	hostID := h.ID
 
 	var attachClient cluster.AttachClient
 	if attach {
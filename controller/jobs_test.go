@@ -8,6 +8,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"strings"
+	"time"
 
 	. "github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-check"
 	"github.com/flynn/flynn/controller/client"
@@ -15,7 +16,9 @@ import (
 	ct "github.com/flynn/flynn/controller/types"
 	"github.com/flynn/flynn/host/types"
 	"github.com/flynn/flynn/pkg/cluster"
+	"github.com/flynn/flynn/pkg/httphelper"
 	"github.com/flynn/flynn/pkg/random"
+	"github.com/flynn/flynn/pkg/schedutil"
 )
 
 func (s *S) createTestJob(c *C, in *ct.Job) *ct.Job {
@@ -225,6 +228,109 @@ func (s *S) TestRunJobDetached(c *C) {
 	c.Assert(job.Config.Stdin, Equals, false)
 }
 
+func (s *S) TestRunJobNoCapacity(c *C) {
+	app := s.createTestApp(c, &ct.App{Name: "run-no-capacity"})
+
+	hostID := random.UUID()
+	s.cc.SetHosts(map[string]host.Host{hostID: {
+		ID:       hostID,
+		Jobs:     []*host.Job{{ID: random.UUID()}},
+		Metadata: map[string]string{schedutil.MetaMaxJobs: "1"},
+	}})
+
+	artifact := s.createTestArtifact(c, &ct.Artifact{Type: "docker", URI: "docker://foo/bar"})
+	release := s.createTestRelease(c, &ct.Release{ArtifactID: artifact.ID})
+
+	_, err := s.c.RunJobDetached(app.ID, &ct.NewJob{ReleaseID: release.ID})
+	c.Assert(err, NotNil)
+	jsonErr, ok := err.(httphelper.JSONError)
+	c.Assert(ok, Equals, true)
+	c.Assert(jsonErr.Code, Equals, httphelper.UnavailableError)
+}
+
+func (s *S) TestJobStats(c *C) {
+	app := s.createTestApp(c, &ct.App{Name: "job-stats"})
+	hostID, jobID := random.UUID(), random.UUID()
+	hc := tu.NewFakeHostClient(hostID)
+	hc.SetJobStats(jobID, &host.JobStats{
+		JobID:  jobID,
+		Memory: host.MemoryStats{Usage: 1024},
+		CPU:    host.CPUStats{Usage: 1000},
+	})
+	s.cc.SetHostClient(hostID, hc)
+
+	stats, err := s.c.GetJobStats(app.ID, hostID+"-"+jobID)
+	c.Assert(err, IsNil)
+	c.Assert(stats.JobID, Equals, hostID+"-"+jobID)
+	c.Assert(stats.Memory.Usage, Equals, uint64(1024))
+	c.Assert(stats.CPU.Usage, Equals, uint64(1000))
+
+	ch := make(chan *host.JobStats)
+	stream, err := s.c.StreamJobStats(app.ID, hostID+"-"+jobID, time.Second, ch)
+	c.Assert(err, IsNil)
+	defer stream.Close()
+	select {
+	case stats := <-ch:
+		c.Assert(stats, NotNil)
+		c.Assert(stats.JobID, Equals, hostID+"-"+jobID)
+		c.Assert(stats.Memory.Usage, Equals, uint64(1024))
+	case <-time.After(5 * time.Second):
+		c.Fatal("timed out waiting for job stats")
+	}
+
+	_, err = s.c.StreamJobStats(app.ID, hostID+"-"+jobID, time.Nanosecond, make(chan *host.JobStats))
+	c.Assert(err, NotNil)
+}
+
+func (s *S) TestExecJob(c *C) {
+	app := s.createTestApp(c, &ct.App{Name: "exec-job"})
+	hostID, jobID := random.UUID(), random.UUID()
+	hc := tu.NewFakeHostClient(hostID)
+
+	done := make(chan struct{})
+	hc.SetExecFunc(jobID, func(req *host.ExecReq) (cluster.AttachClient, error) {
+		c.Assert(req, DeepEquals, &host.ExecReq{
+			JobID:  jobID,
+			Cmd:    []string{"ps", "aux"},
+			Env:    map[string]string{"FOO": "bar"},
+			TTY:    true,
+			Flags:  host.AttachFlagStdout | host.AttachFlagStderr | host.AttachFlagStdin,
+			Height: 20,
+			Width:  10,
+		})
+		pipeR, pipeW := io.Pipe()
+		go func() {
+			stdin, err := ioutil.ReadAll(pipeR)
+			c.Assert(err, IsNil)
+			c.Assert(string(stdin), Equals, "test in")
+			close(done)
+		}()
+		return cluster.NewAttachClient(struct {
+			io.Reader
+			io.WriteCloser
+		}{strings.NewReader("test out"), pipeW}), nil
+	})
+	s.cc.SetHostClient(hostID, hc)
+
+	rwc, err := s.c.ExecJob(app.ID, hostID+"-"+jobID, &ct.JobExec{
+		Cmd:     []string{"ps", "aux"},
+		Env:     map[string]string{"FOO": "bar"},
+		TTY:     true,
+		Columns: 10,
+		Lines:   20,
+	})
+	c.Assert(err, IsNil)
+
+	_, err = rwc.Write([]byte("test in"))
+	c.Assert(err, IsNil)
+	rwc.CloseWrite()
+	stdout, err := ioutil.ReadAll(rwc)
+	c.Assert(err, IsNil)
+	c.Assert(string(stdout), Equals, "test out")
+	rwc.Close()
+	<-done
+}
+
 func (s *S) TestRunJobAttached(c *C) {
 	app := s.createTestApp(c, &ct.App{Name: "run-attached"})
 	hostID := random.UUID()
@@ -296,3 +402,84 @@ func (s *S) TestRunJobAttached(c *C) {
 	c.Assert(job.Config.Env, DeepEquals, map[string]string{"FOO": "baz", "JOB": "true", "RELEASE": "true"})
 	c.Assert(job.Config.Stdin, Equals, true)
 }
+
+func (s *S) TestAppLog(c *C) {
+	app := s.createTestApp(c, &ct.App{Name: "app-log"})
+	release := s.createTestRelease(c, &ct.Release{})
+	s.createTestFormation(c, &ct.Formation{ReleaseID: release.ID, AppID: app.ID})
+	hostID := random.UUID()
+	hc := tu.NewFakeHostClient(hostID)
+	s.cc.SetHostClient(hostID, hc)
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	jobs := map[string][]*host.LogMessage{
+		"web": {
+			{Stream: "stdout", Timestamp: now, Message: "web 1"},
+			{Stream: "stderr", Timestamp: now.Add(2 * time.Second), Message: "web 2"},
+		},
+		"worker": {
+			{Stream: "stdout", Timestamp: now.Add(time.Second), Message: "worker 1"},
+		},
+	}
+	jobIDs := make(map[string]string, len(jobs))
+	for typ, msgs := range jobs {
+		jobID := random.UUID()
+		jobIDs[typ] = hostID + "-" + jobID
+		hc.SetLog(jobID, msgs)
+		s.createTestJob(c, &ct.Job{ID: jobIDs[typ], AppID: app.ID, ReleaseID: release.ID, Type: typ, State: "up"})
+	}
+
+	// the logs of jobs which have stopped are not read
+	stoppedID := random.UUID()
+	hc.SetLog(stoppedID, []*host.LogMessage{{Stream: "stdout", Timestamp: now, Message: "stopped"}})
+	s.createTestJob(c, &ct.Job{ID: hostID + "-" + stoppedID, AppID: app.ID, ReleaseID: release.ID, Type: "web", State: "down"})
+
+	readLog := func(typ string) []*ct.LogMessage {
+		ch := make(chan *ct.LogMessage)
+		stream, err := s.c.StreamAppLog(app.ID, typ, false, ch)
+		c.Assert(err, IsNil)
+		defer stream.Close()
+		var msgs []*ct.LogMessage
+		for msg := range ch {
+			msgs = append(msgs, msg)
+		}
+		c.Assert(stream.Err(), IsNil)
+		return msgs
+	}
+
+	msgs := readLog("")
+	c.Assert(msgs, HasLen, 3)
+	for i, expected := range []struct{ typ, message string }{
+		{"web", "web 1"},
+		{"worker", "worker 1"},
+		{"web", "web 2"},
+	} {
+		c.Assert(msgs[i].Type, Equals, expected.typ)
+		c.Assert(msgs[i].JobID, Equals, jobIDs[expected.typ])
+		c.Assert(msgs[i].Message, Equals, expected.message)
+	}
+	c.Assert(msgs[2].Stream, Equals, "stderr")
+	c.Assert(msgs[2].Timestamp.Equal(now.Add(2*time.Second)), Equals, true)
+
+	msgs = readLog("worker")
+	c.Assert(msgs, HasLen, 1)
+	c.Assert(msgs[0].Message, Equals, "worker 1")
+}
+
+func (s *S) TestCopyJobFiles(c *C) {
+	app := s.createTestApp(c, &ct.App{Name: "copy-job-files"})
+	hostID, jobID := random.UUID(), random.UUID()
+	hc := tu.NewFakeHostClient(hostID)
+	s.cc.SetHostClient(hostID, hc)
+
+	c.Assert(s.c.CopyToJob(app.ID, hostID+"-"+jobID, "/tmp", strings.NewReader("archive")), IsNil)
+	archive, err := s.c.CopyFromJob(app.ID, hostID+"-"+jobID, "/tmp")
+	c.Assert(err, IsNil)
+	defer archive.Close()
+	data, err := ioutil.ReadAll(archive)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "archive")
+
+	_, err = s.c.CopyFromJob(app.ID, hostID+"-"+jobID, "")
+	c.Assert(err, NotNil)
+}
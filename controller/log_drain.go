@@ -0,0 +1,136 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-sql"
+	"github.com/flynn/flynn/Godeps/_workspace/src/golang.org/x/net/context"
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/pkg/httphelper"
+	"github.com/flynn/flynn/pkg/postgres"
+)
+
+type LogDrainRepo struct {
+	db *postgres.DB
+}
+
+func NewLogDrainRepo(db *postgres.DB) *LogDrainRepo {
+	return &LogDrainRepo{db}
+}
+
+func validateLogDrainURL(s string) error {
+	if s == "" {
+		return ct.ValidationError{Field: "url", Message: "must not be blank"}
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return ct.ValidationError{Field: "url", Message: "is invalid"}
+	}
+	switch u.Scheme {
+	case "syslog+tcp", "syslog+tls", "http", "https":
+	default:
+		return ct.ValidationError{Field: "url", Message: "must use the syslog+tcp, syslog+tls, http or https scheme"}
+	}
+	if u.Host == "" {
+		return ct.ValidationError{Field: "url", Message: "must have a host"}
+	}
+	return nil
+}
+
+func (r *LogDrainRepo) Add(drain *ct.LogDrain) error {
+	if err := validateLogDrainURL(drain.URL); err != nil {
+		return err
+	}
+	err := r.db.QueryRow("INSERT INTO log_drains (app_id, url) VALUES ($1, $2) RETURNING drain_id, created_at",
+		drain.AppID, drain.URL).Scan(&drain.ID, &drain.CreatedAt)
+	if err != nil {
+		return err
+	}
+	drain.ID = postgres.CleanUUID(drain.ID)
+	return nil
+}
+
+func scanLogDrain(s postgres.Scanner) (*ct.LogDrain, error) {
+	drain := &ct.LogDrain{}
+	err := s.Scan(&drain.ID, &drain.AppID, &drain.URL, &drain.CreatedAt)
+	if err == sql.ErrNoRows {
+		err = ErrNotFound
+	}
+	drain.ID = postgres.CleanUUID(drain.ID)
+	drain.AppID = postgres.CleanUUID(drain.AppID)
+	return drain, err
+}
+
+func (r *LogDrainRepo) Get(appID, id string) (*ct.LogDrain, error) {
+	row := r.db.QueryRow("SELECT drain_id, app_id, url, created_at FROM log_drains WHERE app_id = $1 AND drain_id = $2 AND deleted_at IS NULL", appID, id)
+	return scanLogDrain(row)
+}
+
+func (r *LogDrainRepo) List(appID string) ([]*ct.LogDrain, error) {
+	rows, err := r.db.Query("SELECT drain_id, app_id, url, created_at FROM log_drains WHERE app_id = $1 AND deleted_at IS NULL ORDER BY created_at", appID)
+	if err != nil {
+		return nil, err
+	}
+	drains := []*ct.LogDrain{}
+	for rows.Next() {
+		drain, err := scanLogDrain(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		drains = append(drains, drain)
+	}
+	return drains, rows.Err()
+}
+
+func (r *LogDrainRepo) Remove(appID, id string) error {
+	return r.db.Exec("UPDATE log_drains SET deleted_at = now() WHERE app_id = $1 AND drain_id = $2 AND deleted_at IS NULL", appID, id)
+}
+
+func (c *controllerAPI) CreateLogDrain(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	var drain ct.LogDrain
+	if err := httphelper.DecodeJSON(req, &drain); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	drain.AppID = c.getApp(ctx).ID
+	if err := c.logDrainRepo.Add(&drain); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	// the scheduler receives the new list of drains with the formations and
+	// updates running jobs
+	if err := c.formationRepo.Touch(drain.AppID); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, &drain)
+}
+
+func (c *controllerAPI) ListLogDrains(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	drains, err := c.logDrainRepo.List(c.getApp(ctx).ID)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, drains)
+}
+
+func (c *controllerAPI) DeleteLogDrain(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	app := c.getApp(ctx)
+	id := httphelper.ParamsFromContext(ctx).ByName("drains_id")
+	if _, err := c.logDrainRepo.Get(app.ID, id); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	if err := c.logDrainRepo.Remove(app.ID, id); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	if err := c.formationRepo.Touch(app.ID); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	w.WriteHeader(200)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"time"
+
+	. "github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-check"
+	"github.com/flynn/flynn/controller/client"
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/pkg/httphelper"
+)
+
+func (s *S) TestLogDrains(c *C) {
+	release := s.createTestRelease(c, &ct.Release{})
+	app := s.createTestApp(c, &ct.App{Name: "log-drains"})
+	s.createTestFormation(c, &ct.Formation{ReleaseID: release.ID, AppID: app.ID})
+
+	for _, url := range []string{"", "ftp://example.com", "syslog+tcp://"} {
+		_, err := s.c.CreateLogDrain(app.ID, url)
+		c.Assert(err, NotNil)
+		c.Assert(err.(httphelper.JSONError).Code, Equals, httphelper.ValidationError)
+	}
+
+	before := time.Now()
+	drain, err := s.c.CreateLogDrain(app.ID, "syslog+tls://logs.example.com:6514")
+	c.Assert(err, IsNil)
+	c.Assert(drain.ID, Not(Equals), "")
+	c.Assert(drain.AppID, Equals, app.ID)
+
+	list, err := s.c.LogDrainList(app.ID)
+	c.Assert(err, IsNil)
+	c.Assert(list, HasLen, 1)
+	c.Assert(list[0].URL, Equals, drain.URL)
+
+	// adding a drain updates the formations of the app
+	stream, f := s.streamAppFormation(c, app.ID, before)
+	defer stream.Close()
+	c.Assert(f.LogDrains, HasLen, 1)
+	c.Assert(f.LogDrains[0].URL, Equals, drain.URL)
+
+	c.Assert(s.c.DeleteLogDrain(app.ID, drain.ID), IsNil)
+	c.Assert(stream.Next(c).LogDrains, HasLen, 0)
+	c.Assert(s.c.DeleteLogDrain(app.ID, drain.ID), Equals, controller.ErrNotFound)
+
+	list, err = s.c.LogDrainList(app.ID)
+	c.Assert(err, IsNil)
+	c.Assert(list, HasLen, 0)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-sql"
+	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/pq"
+	"github.com/flynn/flynn/Godeps/_workspace/src/golang.org/x/net/context"
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/pkg/httphelper"
+	"github.com/flynn/flynn/pkg/postgres"
+)
+
+type NetworkPolicyRepo struct {
+	db   *postgres.DB
+	apps *AppRepo
+}
+
+func NewNetworkPolicyRepo(db *postgres.DB, appRepo *AppRepo) *NetworkPolicyRepo {
+	return &NetworkPolicyRepo{db: db, apps: appRepo}
+}
+
+// resolveDependencies replaces the app names or IDs in the dependencies of
+// policy with app IDs.
+func (r *NetworkPolicyRepo) resolveDependencies(policy *ct.NetworkPolicy) error {
+	ids := make([]string, 0, len(policy.Dependencies))
+	seen := make(map[string]struct{}, len(policy.Dependencies))
+	for _, dep := range policy.Dependencies {
+		app, err := r.apps.Get(dep)
+		if err == ErrNotFound {
+			return ct.ValidationError{Field: "dependencies", Message: "app " + dep + " not found"}
+		} else if err != nil {
+			return err
+		}
+		id := app.(*ct.App).ID
+		if id == policy.AppID {
+			return ct.ValidationError{Field: "dependencies", Message: "must not include the app itself"}
+		}
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		ids = append(ids, id)
+	}
+	policy.Dependencies = ids
+	return nil
+}
+
+func (r *NetworkPolicyRepo) Set(policy *ct.NetworkPolicy) error {
+	if err := r.resolveDependencies(policy); err != nil {
+		return err
+	}
+	deps, err := json.Marshal(policy.Dependencies)
+	if err != nil {
+		return err
+	}
+	err = r.db.QueryRow("INSERT INTO network_policies (app_id, isolated, dependencies) VALUES ($1, $2, $3) RETURNING updated_at",
+		policy.AppID, policy.Isolated, string(deps)).Scan(&policy.UpdatedAt)
+	if e, ok := err.(*pq.Error); ok && e.Code.Name() == "unique_violation" {
+		err = r.db.QueryRow("UPDATE network_policies SET isolated = $2, dependencies = $3, updated_at = now() WHERE app_id = $1 RETURNING updated_at",
+			policy.AppID, policy.Isolated, string(deps)).Scan(&policy.UpdatedAt)
+	}
+	return err
+}
+
+// Get returns the network policy of an app, apps without a stored policy are
+// not isolated.
+func (r *NetworkPolicyRepo) Get(appID string) (*ct.NetworkPolicy, error) {
+	policy := &ct.NetworkPolicy{AppID: appID}
+	var deps string
+	err := r.db.QueryRow("SELECT isolated, dependencies, updated_at FROM network_policies WHERE app_id = $1", appID).Scan(&policy.Isolated, &deps, &policy.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return policy, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(deps), &policy.Dependencies); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+func (c *controllerAPI) SetNetworkPolicy(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	var policy ct.NetworkPolicy
+	if err := httphelper.DecodeJSON(req, &policy); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	policy.AppID = c.getApp(ctx).ID
+	if err := c.networkPolicyRepo.Set(&policy); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	// the scheduler receives the new policy with the formations and updates
+	// the hosts
+	if err := c.formationRepo.Touch(policy.AppID); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, &policy)
+}
+
+func (c *controllerAPI) GetNetworkPolicy(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	policy, err := c.networkPolicyRepo.Get(c.getApp(ctx).ID)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, policy)
+}
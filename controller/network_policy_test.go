@@ -0,0 +1,49 @@
+package main
+
+import (
+	"time"
+
+	. "github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-check"
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/pkg/httphelper"
+)
+
+func (s *S) TestNetworkPolicy(c *C) {
+	release := s.createTestRelease(c, &ct.Release{})
+	app := s.createTestApp(c, &ct.App{Name: "network-policy"})
+	s.createTestFormation(c, &ct.Formation{ReleaseID: release.ID, AppID: app.ID})
+	web := s.createTestApp(c, &ct.App{Name: "network-policy-web"})
+
+	// apps are not isolated by default
+	policy, err := s.c.GetNetworkPolicy(app.ID)
+	c.Assert(err, IsNil)
+	c.Assert(policy.Isolated, Equals, false)
+
+	for _, deps := range [][]string{{"nonexistent-app"}, {app.Name}} {
+		err = s.c.SetNetworkPolicy(app.ID, &ct.NetworkPolicy{Isolated: true, Dependencies: deps})
+		c.Assert(err, NotNil)
+		c.Assert(err.(httphelper.JSONError).Code, Equals, httphelper.ValidationError)
+	}
+
+	// dependencies are resolved to app IDs
+	before := time.Now()
+	policy = &ct.NetworkPolicy{Isolated: true, Dependencies: []string{web.Name, web.ID}}
+	c.Assert(s.c.SetNetworkPolicy(app.ID, policy), IsNil)
+	c.Assert(policy.Dependencies, DeepEquals, []string{web.ID})
+
+	policy, err = s.c.GetNetworkPolicy(app.ID)
+	c.Assert(err, IsNil)
+	c.Assert(policy.Isolated, Equals, true)
+	c.Assert(policy.Dependencies, DeepEquals, []string{web.ID})
+
+	// setting the policy updates the formations of the app
+	stream, f := s.streamAppFormation(c, app.ID, before)
+	defer stream.Close()
+	c.Assert(f.NetworkPolicy, NotNil)
+	c.Assert(f.NetworkPolicy.Isolated, Equals, true)
+
+	c.Assert(s.c.SetNetworkPolicy(app.ID, &ct.NetworkPolicy{}), IsNil)
+	f = stream.Next(c)
+	c.Assert(f.NetworkPolicy.Isolated, Equals, false)
+	c.Assert(f.NetworkPolicy.Dependencies, HasLen, 0)
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-sql"
 	"github.com/flynn/flynn/Godeps/_workspace/src/golang.org/x/net/context"
 	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/host/types"
 	"github.com/flynn/flynn/pkg/httphelper"
 	"github.com/flynn/flynn/pkg/postgres"
 	"github.com/flynn/flynn/pkg/random"
@@ -41,8 +42,57 @@ func scanRelease(s postgres.Scanner) (*ct.Release, error) {
 	return release, err
 }
 
+func validateRelease(release *ct.Release) error {
+	for name, t := range release.Processes {
+		if _, ok := host.StopSignals[t.StopSignal]; t.StopSignal != "" && !ok {
+			return ct.ValidationError{Field: fmt.Sprintf("processes.%s.stop_signal", name), Message: "is not a supported signal"}
+		}
+		if t.StopTimeout < 0 {
+			return ct.ValidationError{Field: fmt.Sprintf("processes.%s.stop_timeout", name), Message: "must not be negative"}
+		}
+		if t.HealthCheck != nil {
+			if err := validateHealthCheck(name, t.HealthCheck); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func validateHealthCheck(name string, check *ct.HealthCheck) error {
+	field := func(f string) string {
+		return fmt.Sprintf("processes.%s.health_check.%s", name, f)
+	}
+	switch check.Type {
+	case "tcp", "http":
+	case "exec":
+		if len(check.Cmd) == 0 {
+			return ct.ValidationError{Field: field("cmd"), Message: "must be set for exec checks"}
+		}
+	default:
+		return ct.ValidationError{Field: field("type"), Message: "must be tcp, http or exec"}
+	}
+	if check.Port < 0 || check.Port > 65535 {
+		return ct.ValidationError{Field: field("port"), Message: "is invalid"}
+	}
+	for f, v := range map[string]int{
+		"interval":      check.Interval,
+		"timeout":       check.Timeout,
+		"threshold":     check.Threshold,
+		"start_timeout": check.StartTimeout,
+	} {
+		if v < 0 {
+			return ct.ValidationError{Field: field(f), Message: "must not be negative"}
+		}
+	}
+	return nil
+}
+
 func (r *ReleaseRepo) Add(data interface{}) error {
 	release := data.(*ct.Release)
+	if err := validateRelease(release); err != nil {
+		return err
+	}
 	releaseCopy := *release
 
 	releaseCopy.ID = ""
@@ -2,8 +2,11 @@ package main
 
 import (
 	"net/http"
+	"path"
+	"strings"
 
 	"github.com/flynn/flynn/Godeps/_workspace/src/golang.org/x/net/context"
+	ct "github.com/flynn/flynn/controller/types"
 	"github.com/flynn/flynn/pkg/httphelper"
 	routerc "github.com/flynn/flynn/router/client"
 	"github.com/flynn/flynn/router/types"
@@ -34,6 +37,58 @@ func (c *controllerAPI) GetRoute(ctx context.Context, w http.ResponseWriter, req
 	httphelper.JSON(w, 200, route)
 }
 
+// UpdateRoute replaces the config of a route. The domain and path of an HTTP
+// route, and the port of a TCP route, identify it and cannot be changed.
+func (c *controllerAPI) UpdateRoute(ctx context.Context, w http.ResponseWriter, req *http.Request) {
+	existing, err := c.getRoute(ctx)
+	if err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	var route router.Route
+	if err := httphelper.DecodeJSON(req, &route); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	if route.Type == "" {
+		route.Type = existing.Type
+	}
+	if err := validateRouteUpdate(existing, &route); err != nil {
+		respondWithError(w, err)
+		return
+	}
+
+	route.ID = existing.ID
+	route.ParentRef = existing.ParentRef
+	if err := c.routerc.SetRoute(&route); err != nil {
+		respondWithError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, &route)
+}
+
+func validateRouteUpdate(existing, route *router.Route) error {
+	if route.Type != existing.Type {
+		return ct.ValidationError{Field: "type", Message: "cannot be changed"}
+	}
+	switch route.Type {
+	case "http":
+		before, after := existing.HTTPRoute(), route.HTTPRoute()
+		if !strings.EqualFold(before.Domain, after.Domain) {
+			return ct.ValidationError{Field: "domain", Message: "cannot be changed"}
+		}
+		if path.Clean("/"+before.Path) != path.Clean("/"+after.Path) {
+			return ct.ValidationError{Field: "path", Message: "cannot be changed"}
+		}
+	case "tcp":
+		if existing.TCPRoute().Port != route.TCPRoute().Port {
+			return ct.ValidationError{Field: "port", Message: "cannot be changed"}
+		}
+	}
+	return nil
+}
+
 func (c *controllerAPI) GetRouteList(ctx context.Context, w http.ResponseWriter, req *http.Request) {
 	routes, err := c.routerc.ListRoutes(routeParentRef(c.getApp(ctx).ID))
 	if err != nil {
@@ -8,6 +8,7 @@ import (
 	. "github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-check"
 	"github.com/flynn/flynn/controller/client"
 	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/pkg/httphelper"
 	"github.com/flynn/flynn/pkg/random"
 	routerc "github.com/flynn/flynn/router/client"
 	"github.com/flynn/flynn/router/types"
@@ -54,7 +55,18 @@ func (r *fakeRouter) GetRoute(id string) (*router.Route, error) {
 	return route, nil
 }
 
-func (r *fakeRouter) SetRoute(*router.Route) error { return nil }
+func (r *fakeRouter) SetRoute(route *router.Route) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	now := time.Now()
+	route.CreatedAt = &now
+	if existing, ok := r.routes[route.ID]; ok {
+		route.CreatedAt = existing.CreatedAt
+	}
+	route.UpdatedAt = &now
+	r.routes[route.ID] = route
+	return nil
+}
 
 type sortedRoutes []*router.Route
 
@@ -104,6 +116,30 @@ func (s *S) TestDeleteRoute(c *C) {
 	c.Assert(err, Equals, controller.ErrNotFound)
 }
 
+func (s *S) TestUpdateRoute(c *C) {
+	app := s.createTestApp(c, &ct.App{Name: "update-route"})
+	route := s.createTestRoute(c, app.ID, (&router.HTTPRoute{Service: "foo", Domain: "example.com"}).ToRoute())
+
+	hr := route.HTTPRoute()
+	hr.AllowIPs = []string{"10.0.0.0/8"}
+	updated := hr.ToRoute()
+	c.Assert(s.c.UpdateRoute(app.ID, route.ID, updated), IsNil)
+	c.Assert(updated.ID, Equals, route.ID)
+
+	gotRoute, err := s.c.GetRoute(app.ID, route.ID)
+	c.Assert(err, IsNil)
+	c.Assert(gotRoute.HTTPRoute().AllowIPs, DeepEquals, []string{"10.0.0.0/8"})
+	c.Assert(gotRoute.HTTPRoute().Domain, Equals, "example.com")
+
+	hr.Domain = "example.net"
+	err = s.c.UpdateRoute(app.ID, route.ID, hr.ToRoute())
+	c.Assert(err, NotNil)
+	c.Assert(err.(httphelper.JSONError).Code, Equals, httphelper.ValidationError)
+
+	other := s.createTestApp(c, &ct.App{Name: "update-route-other"})
+	c.Assert(s.c.UpdateRoute(other.ID, route.ID, updated), Equals, controller.ErrNotFound)
+}
+
 func (s *S) TestListRoutes(c *C) {
 	app0 := s.createTestApp(c, &ct.App{Name: "delete-route1"})
 	app1 := s.createTestApp(c, &ct.App{Name: "delete-route2"})
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/julienschmidt/httprouter"
+	"github.com/flynn/flynn/pkg/httphelper"
+)
+
+// maxRectifyDecisions is the number of recent rectify decisions kept in memory
+// and exposed via the HTTP API.
+const maxRectifyDecisions = 100
+
+type RectifyDecision struct {
+	AppID     string    `json:"app"`
+	ReleaseID string    `json:"release"`
+	Type      string    `json:"type"`
+	HostID    string    `json:"host_id,omitempty"`
+	Expected  int       `json:"expected"`
+	Actual    int       `json:"actual"`
+	Diff      int       `json:"diff"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func newRectifyLog(size int) *rectifyLog {
+	return &rectifyLog{decisions: make([]*RectifyDecision, 0, size), size: size}
+}
+
+// rectifyLog is a fixed size ring buffer of rectify decisions.
+type rectifyLog struct {
+	decisions []*RectifyDecision
+	next      int
+	size      int
+	mtx       sync.Mutex
+}
+
+func (l *rectifyLog) Add(d *RectifyDecision) {
+	d.CreatedAt = time.Now()
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if len(l.decisions) < l.size {
+		l.decisions = append(l.decisions, d)
+		return
+	}
+	l.decisions[l.next] = d
+	l.next = (l.next + 1) % l.size
+}
+
+// List returns the decisions in reverse chronological order.
+func (l *rectifyLog) List() []*RectifyDecision {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	res := make([]*RectifyDecision, 0, len(l.decisions))
+	for i := len(l.decisions) - 1; i >= 0; i-- {
+		res = append(res, l.decisions[(l.next+i)%len(l.decisions)])
+	}
+	return res
+}
+
+type FormationStatus struct {
+	AppID     string                        `json:"app"`
+	AppName   string                        `json:"app_name"`
+	ReleaseID string                        `json:"release"`
+	Processes map[string]*ProcessTypeStatus `json:"processes"`
+}
+
+type ProcessTypeStatus struct {
+	Expected int  `json:"expected"`
+	Actual   int  `json:"actual"`
+	Pending  int  `json:"pending"` // jobs waiting to be restarted
+	Omni     bool `json:"omni,omitempty"`
+}
+
+type JobStatus struct {
+	ID        string     `json:"id"`
+	HostID    string     `json:"host_id"`
+	AppID     string     `json:"app"`
+	ReleaseID string     `json:"release"`
+	Type      string     `json:"type"`
+	Restarts  int        `json:"restarts"`
+	StartedAt time.Time  `json:"started_at,omitempty"`
+	RestartAt *time.Time `json:"restart_at,omitempty"`
+}
+
+type SchedulerStatus struct {
+	Leader      bool       `json:"leader"`
+	LeaderSince *time.Time `json:"leader_since,omitempty"`
+}
+
+type HostStatus struct {
+	ID string `json:"id"`
+}
+
+// Status returns the expected and actual job counts for each process type of
+// the formation.
+func (f *Formation) Status() *FormationStatus {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	s := &FormationStatus{
+		AppID:     f.AppID,
+		AppName:   f.AppName,
+		ReleaseID: f.Release.ID,
+		Processes: make(map[string]*ProcessTypeStatus, len(f.Processes)),
+	}
+	for typ, n := range f.Processes {
+		s.Processes[typ] = &ProcessTypeStatus{Expected: n, Omni: f.Release.Processes[typ].Omni}
+	}
+	for typ, jobs := range f.jobs {
+		if typ == "" {
+			continue
+		}
+		p, ok := s.Processes[typ]
+		if !ok {
+			p = &ProcessTypeStatus{}
+			s.Processes[typ] = p
+		}
+		for _, job := range jobs {
+			if job.pendingRestart() {
+				p.Pending++
+			} else {
+				p.Actual++
+			}
+		}
+	}
+	return s
+}
+
+// PendingJobs returns the jobs of the formation which are waiting to be
+// restarted.
+func (f *Formation) PendingJobs() []*JobStatus {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	var res []*JobStatus
+	for _, jobs := range f.jobs {
+		for _, job := range jobs {
+			if s := job.Status(); s.RestartAt != nil {
+				res = append(res, s)
+			}
+		}
+	}
+	return res
+}
+
+func (j *Job) pendingRestart() bool {
+	j.timerMtx.Lock()
+	defer j.timerMtx.Unlock()
+	return j.timer != nil
+}
+
+func (j *Job) Status() *JobStatus {
+	j.timerMtx.Lock()
+	defer j.timerMtx.Unlock()
+	s := &JobStatus{
+		ID:        j.ID,
+		HostID:    j.HostID,
+		Type:      j.Type,
+		Restarts:  j.restarts,
+		StartedAt: j.startedAt,
+	}
+	if j.Formation != nil {
+		s.AppID = j.Formation.AppID
+		s.ReleaseID = j.Formation.Release.ID
+	}
+	if j.timer != nil {
+		restartAt := j.restartAt
+		s.RestartAt = &restartAt
+	}
+	return s
+}
+
+type sortFormationStatus []*FormationStatus
+
+func (s sortFormationStatus) Len() int      { return len(s) }
+func (s sortFormationStatus) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s sortFormationStatus) Less(i, j int) bool {
+	if s[i].AppID == s[j].AppID {
+		return s[i].ReleaseID < s[j].ReleaseID
+	}
+	return s[i].AppID < s[j].AppID
+}
+
+type schedulerAPI struct {
+	c *context
+}
+
+func (api *schedulerAPI) GetStatus(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	res := &SchedulerStatus{}
+	api.c.leaderMtx.RLock()
+	if since := api.c.leaderSince; !since.IsZero() {
+		res.Leader = true
+		res.LeaderSince = &since
+	}
+	api.c.leaderMtx.RUnlock()
+	httphelper.JSON(w, 200, res)
+}
+
+func (api *schedulerAPI) ListFormations(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	formations := api.c.formations.List()
+	res := make(sortFormationStatus, 0, len(formations))
+	for _, f := range formations {
+		res = append(res, f.Status())
+	}
+	sort.Sort(res)
+	httphelper.JSON(w, 200, res)
+}
+
+func (api *schedulerAPI) GetFormation(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	f := api.c.formations.Get(ps.ByName("app_id"), ps.ByName("release_id"))
+	if f == nil {
+		httphelper.Error(w, httphelper.JSONError{
+			Code:    httphelper.ObjectNotFoundError,
+			Message: "formation not found",
+		})
+		return
+	}
+	httphelper.JSON(w, 200, f.Status())
+}
+
+func (api *schedulerAPI) ListJobs(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	jobs := api.c.jobs.List()
+	res := make([]*JobStatus, 0, len(jobs))
+	for _, job := range jobs {
+		res = append(res, job.Status())
+	}
+	httphelper.JSON(w, 200, res)
+}
+
+func (api *schedulerAPI) ListPendingJobs(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	res := make([]*JobStatus, 0)
+	for _, f := range api.c.formations.List() {
+		res = append(res, f.PendingJobs()...)
+	}
+	httphelper.JSON(w, 200, res)
+}
+
+func (api *schedulerAPI) ListHosts(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	httphelper.JSON(w, 200, api.c.hosts.List())
+}
+
+func (api *schedulerAPI) ListRectifyDecisions(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	httphelper.JSON(w, 200, api.c.decisions.List())
+}
+
+func (api *schedulerAPI) RegisterRoutes(r *httprouter.Router) {
+	r.GET("/status", api.GetStatus)
+	r.GET("/formations", api.ListFormations)
+	r.GET("/formations/:app_id/:release_id", api.GetFormation)
+	r.GET("/jobs", api.ListJobs)
+	r.GET("/jobs/pending", api.ListPendingJobs)
+	r.GET("/hosts", api.ListHosts)
+	r.GET("/rectify", api.ListRectifyDecisions)
+}
+
+func (c *context) serveHTTP(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	r := httprouter.New()
+	api := &schedulerAPI{c}
+	api.RegisterRoutes(r)
+
+	go http.Serve(l, r)
+	return nil
+}
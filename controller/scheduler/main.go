@@ -2,6 +2,7 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"os"
 	"sort"
 	"strings"
@@ -16,12 +17,19 @@ import (
 	"github.com/flynn/flynn/host/types"
 	"github.com/flynn/flynn/pkg/attempt"
 	"github.com/flynn/flynn/pkg/cluster"
+	"github.com/flynn/flynn/pkg/schedutil"
 	"github.com/flynn/flynn/pkg/shutdown"
 	"github.com/flynn/flynn/pkg/stream"
 )
 
 var backoffPeriod = 10 * time.Minute
 
+// hostLossGracePeriod is how long a host can be missing from the cluster
+// before its jobs are considered lost and restarted on other hosts.
+var hostLossGracePeriod = 10 * time.Second
+
+const serviceName = "flynn-controller-scheduler"
+
 func main() {
 	defer shutdown.Exit()
 
@@ -37,6 +45,20 @@ func main() {
 		grohl.Log(grohl.Data{"at": "backoff_period", "period": backoffPeriod.String()})
 	}
 
+	if period := os.Getenv("HOST_LOSS_GRACE_PERIOD"); period != "" {
+		var err error
+		hostLossGracePeriod, err = time.ParseDuration(period)
+		if err != nil {
+			shutdown.Fatal(err)
+		}
+		grohl.Log(grohl.Data{"at": "host_loss_grace_period", "period": hostLossGracePeriod.String()})
+	}
+
+	policy, err := schedutil.LookupPolicy(os.Getenv("SCHEDULER_POLICY"))
+	if err != nil {
+		shutdown.Fatal(err)
+	}
+
 	cc, err := controller.NewClient("", os.Getenv("AUTH_KEY"))
 	if err != nil {
 		shutdown.Fatal(err)
@@ -46,34 +68,28 @@ func main() {
 		shutdown.Fatal(err)
 	}
 	c := newContext(cc, cl)
+	c.policy = policy
+
+	addr := ":" + os.Getenv("PORT")
 
 	grohl.Log(grohl.Data{"at": "leaderwait"})
-	hb, err := discoverd.AddServiceAndRegister("flynn-controller-scheduler", ":"+os.Getenv("PORT"))
+	hb, err := discoverd.AddServiceAndRegister(serviceName, addr)
 	if err != nil {
 		shutdown.Fatal(err)
 	}
 	shutdown.BeforeExit(func() { hb.Close() })
 
-	leaders := make(chan *discoverd.Instance)
-	stream, err := discoverd.NewService("flynn-controller-scheduler").Leaders(leaders)
-	if err != nil {
-		shutdown.Fatal(err)
-	}
-	for leader := range leaders {
-		if leader.Addr == hb.Addr() {
-			break
-		}
-	}
-	if err := stream.Err(); err != nil {
-		// TODO: handle discoverd errors
-		shutdown.Fatal(err)
-	}
-	stream.Close()
-	// TODO: handle demotion
+	c.waitForLeadership(discoverd.NewService(serviceName), hb.Addr())
 
 	grohl.Log(grohl.Data{"at": "leader"})
 
+	// the API is only served by the leader, as standbys have no state
+	if err := c.serveHTTP(addr); err != nil {
+		shutdown.Fatal(err)
+	}
+
 	// TODO: periodic full cluster sync for anti-entropy
+	go c.syncNetworkPolicies()
 	c.watchFormations()
 }
 
@@ -85,6 +101,12 @@ func newContext(cc controllerClient, cl clusterClient) *context {
 		hosts:            newHostClients(),
 		jobs:             newJobMap(),
 		omni:             make(map[*Formation]struct{}),
+		decisions:        newRectifyLog(maxRectifyDecisions),
+		policy:           schedutil.DefaultPolicy,
+		preempted:        make(map[jobKey]struct{}),
+		lostHosts:        make(map[string]*time.Timer),
+		volumeHosts:      make(map[string]string),
+		network:          newNetworkPolicies(),
 	}
 }
 
@@ -98,6 +120,92 @@ type context struct {
 	hosts *hostClients
 	jobs  *jobMap
 	mtx   sync.RWMutex
+
+	decisions *rectifyLog
+	policy    schedutil.Policy
+
+	leaderSince time.Time
+	leaderMtx   sync.RWMutex
+
+	// preempted contains jobs which have been stopped to make room for
+	// higher priority jobs
+	preempted    map[jobKey]struct{}
+	preemptedMtx sync.Mutex
+
+	// lostHosts contains timers for hosts which have been removed from the
+	// cluster, the jobs of which are restarted once the timer fires
+	lostHosts    map[string]*time.Timer
+	lostHostsMtx sync.Mutex
+
+	// volumeHosts maps named volumes to the host which owns them, jobs
+	// which use a named volume are always placed on its host
+	volumeHosts    map[string]string
+	volumeHostsMtx sync.Mutex
+
+	// network tracks app network policies and job addresses, which are
+	// sent to the hosts to isolate apps from each other
+	network *networkPolicies
+}
+
+// waitForLeadership blocks until the scheduler instance registered with addr
+// is the leader of the service. Leadership changes continue to be watched
+// after it returns, and the process exits if another instance becomes the
+// leader so that two schedulers never act on the cluster at the same time.
+// Standby instances are restarted by the new leader and wait for leadership
+// again.
+func (c *context) waitForLeadership(service discoverd.Service, addr string) {
+	g := grohl.NewContext(grohl.Data{"fn": "waitForLeadership", "addr": addr})
+
+	elected := make(chan struct{})
+	go func() {
+		for {
+			leaders := make(chan *discoverd.Instance)
+			stream, err := service.Leaders(leaders)
+			if err != nil {
+				g.Log(grohl.Data{"at": "error", "err": err})
+				time.Sleep(time.Second)
+				continue
+			}
+			for leader := range leaders {
+				if leader == nil {
+					continue
+				}
+				if leader.Addr == addr {
+					if c.setLeader() {
+						g.Log(grohl.Data{"at": "elected"})
+						close(elected)
+					}
+					continue
+				}
+				if c.isLeader() {
+					g.Log(grohl.Data{"at": "demoted", "leader": leader.Addr})
+					shutdown.Fatal("scheduler: demoted, ", leader.Addr, " is now the leader")
+				}
+				g.Log(grohl.Data{"at": "standby", "leader": leader.Addr})
+			}
+			g.Log(grohl.Data{"at": "disconnect", "err": stream.Err()})
+			time.Sleep(time.Second)
+		}
+	}()
+	<-elected
+}
+
+// setLeader marks the scheduler as the leader, returning false if it already
+// was.
+func (c *context) setLeader() bool {
+	c.leaderMtx.Lock()
+	defer c.leaderMtx.Unlock()
+	if !c.leaderSince.IsZero() {
+		return false
+	}
+	c.leaderSince = time.Now()
+	return true
+}
+
+func (c *context) isLeader() bool {
+	c.leaderMtx.RLock()
+	defer c.leaderMtx.RUnlock()
+	return !c.leaderSince.IsZero()
 }
 
 type clusterClient interface {
@@ -127,22 +235,30 @@ func jobMetaFromMetadata(metadata map[string]string) map[string]string {
 }
 
 func (c *context) syncCluster() {
-	g := grohl.NewContext(grohl.Data{"fn": "syncCluster"})
-
-	artifacts := make(map[string]*ct.Artifact)
-	releases := make(map[string]*ct.Release)
-	rectify := make(map[*Formation]struct{})
-
 	go c.watchHosts()
 
 	hosts, err := c.ListHosts()
 	if err != nil {
 		// TODO: log/handle error
 	}
+	c.syncJobs(hosts)
+}
+
+// syncJobs adds any jobs running on hosts which are not yet known to the
+// scheduler to their formations, and then rectifies those formations.
+func (c *context) syncJobs(hosts []host.Host) {
+	g := grohl.NewContext(grohl.Data{"fn": "syncJobs"})
+
+	artifacts := make(map[string]*ct.Artifact)
+	releases := make(map[string]*ct.Release)
+	rectify := make(map[*Formation]struct{})
+	var err error
 
 	c.mtx.Lock()
 	for _, h := range hosts {
 		for _, job := range h.Jobs {
+			c.setVolumeHost(job, h.ID)
+
 			appID := job.Metadata["flynn-controller.app"]
 			appName := job.Metadata["flynn-controller.app_name"]
 			releaseID := job.Metadata["flynn-controller.release"]
@@ -192,6 +308,7 @@ func (c *context) syncCluster() {
 				})
 				gg.Log(grohl.Data{"at": "addFormation"})
 				f = c.formations.Add(f)
+				c.checkOmni(f)
 			}
 
 			gg.Log(grohl.Data{"at": "addJob"})
@@ -246,24 +363,20 @@ func (c *context) watchFormations() {
 				continue
 			}
 			lastUpdatedAt = ef.UpdatedAt
+			c.network.SetPolicy(ef.App.ID, ef.NetworkPolicy)
 			f := c.formations.Get(ef.App.ID, ef.Release.ID)
 			if f != nil {
 				g.Log(grohl.Data{"app.id": ef.App.ID, "release.id": ef.Release.ID, "at": "update"})
 				f.SetProcesses(ef.Processes)
+				if f.SetLogDrains(logDrainURLs(ef)) {
+					go f.UpdateLogDrains()
+				}
 			} else {
 				g.Log(grohl.Data{"app.id": ef.App.ID, "release.id": ef.Release.ID, "at": "new"})
 				f = NewFormation(c, ef)
 				c.formations.Add(f)
 			}
-			// check for omnipresence
-			for _, proctype := range f.Release.Processes {
-				if proctype.Omni {
-					c.omniMtx.Lock()
-					c.omni[f] = struct{}{}
-					c.omniMtx.Unlock()
-					break
-				}
-			}
+			c.checkOmni(f)
 			go f.Rectify()
 		}
 		if streamCtrl.Err() != nil {
@@ -273,6 +386,37 @@ func (c *context) watchFormations() {
 	}
 }
 
+// checkOmni tracks f as an omnipresent formation if any of its process types
+// are omnipresent. This must happen before f is first rectified, otherwise the
+// per-host jobs of omni process types would be counted against the total.
+func (c *context) checkOmni(f *Formation) {
+	for _, proctype := range f.Release.Processes {
+		if proctype.Omni {
+			c.omniMtx.Lock()
+			c.omni[f] = struct{}{}
+			c.omniMtx.Unlock()
+			return
+		}
+	}
+}
+
+func (c *context) addPreempted(hostID, jobID string) {
+	c.preemptedMtx.Lock()
+	c.preempted[jobKey{hostID, jobID}] = struct{}{}
+	c.preemptedMtx.Unlock()
+}
+
+// removePreempted returns whether the job was preempted, removing it from the
+// set of preempted jobs.
+func (c *context) removePreempted(hostID, jobID string) bool {
+	c.preemptedMtx.Lock()
+	defer c.preemptedMtx.Unlock()
+	key := jobKey{hostID, jobID}
+	_, ok := c.preempted[key]
+	delete(c.preempted, key)
+	return ok
+}
+
 func (c *context) watchHosts() {
 	hosts, err := c.ListHosts()
 	if err != nil {
@@ -283,16 +427,23 @@ func (c *context) watchHosts() {
 		ch := make(chan *host.HostEvent)
 		c.StreamHostEvents(ch)
 		for event := range ch {
-			if event.Event != "add" {
-				continue
-			}
-			go c.watchHost(event.HostID)
+			switch event.Event {
+			case "add":
+				if !c.cancelHostLoss(event.HostID) {
+					// the host was lost and has come back, so adopt any
+					// jobs it is still running
+					go c.syncHost(event.HostID)
+				}
+				go c.watchHost(event.HostID)
 
-			c.omniMtx.RLock()
-			for f := range c.omni {
-				go f.Rectify()
+				c.omniMtx.RLock()
+				for f := range c.omni {
+					go f.Rectify()
+				}
+				c.omniMtx.RUnlock()
+			case "remove":
+				c.scheduleHostLoss(event.HostID)
 			}
-			c.omniMtx.RUnlock()
 		}
 	}()
 
@@ -302,16 +453,111 @@ func (c *context) watchHosts() {
 
 }
 
+// scheduleHostLoss marks the jobs of the host as lost once
+// hostLossGracePeriod has elapsed, unless the host is added back to the
+// cluster before then.
+func (c *context) scheduleHostLoss(hostID string) {
+	g := grohl.NewContext(grohl.Data{"fn": "scheduleHostLoss", "host.id": hostID})
+	g.Log(grohl.Data{"at": "start", "grace_period": hostLossGracePeriod.String()})
+
+	c.lostHostsMtx.Lock()
+	defer c.lostHostsMtx.Unlock()
+	if _, ok := c.lostHosts[hostID]; ok {
+		return
+	}
+	c.lostHosts[hostID] = time.AfterFunc(hostLossGracePeriod, func() {
+		c.lostHostsMtx.Lock()
+		// the timer is left in lostHosts so that syncHost is called if the
+		// host comes back
+		c.lostHosts[hostID] = nil
+		c.lostHostsMtx.Unlock()
+		c.handleHostLoss(hostID)
+	})
+}
+
+// cancelHostLoss cancels the pending loss of the host, returning false if the
+// jobs of the host have already been restarted elsewhere.
+func (c *context) cancelHostLoss(hostID string) bool {
+	c.lostHostsMtx.Lock()
+	defer c.lostHostsMtx.Unlock()
+	timer, ok := c.lostHosts[hostID]
+	if !ok {
+		return true
+	}
+	delete(c.lostHosts, hostID)
+	if timer == nil {
+		return false
+	}
+	g := grohl.NewContext(grohl.Data{"fn": "cancelHostLoss", "host.id": hostID})
+	g.Log(grohl.Data{"at": "cancel"})
+	return timer.Stop()
+}
+
+// handleHostLoss marks all jobs of the host as down and starts replacements
+// for them on other hosts.
+func (c *context) handleHostLoss(hostID string) {
+	g := grohl.NewContext(grohl.Data{"fn": "handleHostLoss", "host.id": hostID})
+
+	jobs := c.jobs.RemoveHost(hostID)
+	g.Log(grohl.Data{"at": "start", "jobs": len(jobs)})
+	for _, j := range jobs {
+		job := &ct.Job{
+			ID:        hostID + "-" + j.ID,
+			AppID:     j.Formation.AppID,
+			ReleaseID: j.Formation.Release.ID,
+			Type:      j.Type,
+			State:     "down",
+		}
+		go putJobAttempts.Run(func() error {
+			if err := c.PutJob(job); err != nil {
+				g.Log(grohl.Data{"at": "error", "job.id": job.ID, "err": err})
+				return err
+			}
+			return nil
+		})
+		go func(j *Job) {
+			c.mtx.RLock()
+			j.Formation.RescheduleJob(j)
+			c.mtx.RUnlock()
+		}(j)
+	}
+}
+
+// syncHost adopts the jobs running on a host which has come back after being
+// considered lost, stopping any which have since been replaced.
+func (c *context) syncHost(hostID string) {
+	hosts, err := c.ListHosts()
+	if err != nil {
+		return
+	}
+	for _, h := range hosts {
+		if h.ID == hostID {
+			c.syncJobs([]host.Host{h})
+			return
+		}
+	}
+}
+
 var putJobAttempts = attempt.Strategy{
 	Total: 30 * time.Second,
 	Delay: 500 * time.Millisecond,
 }
 
 func jobState(event *host.Event) string {
+	switch event.Event {
+	case "healthy":
+		return "up"
+	case "unhealthy":
+		return "unhealthy"
+	}
 	switch event.Job.Status {
 	case host.StatusStarting:
 		return "starting"
 	case host.StatusRunning:
+		// jobs with a health check are up once it first passes
+		if event.Event == "start" && event.Job.Job.Config.HealthCheck != nil {
+			return "starting"
+		}
 		return "up"
 	case host.StatusDone:
 		return "down"
@@ -332,6 +578,7 @@ func (c *context) watchHost(id string) {
 		return
 	}
 	defer c.hosts.Remove(id)
+	defer c.network.RemoveHost(id)
 
 	g := grohl.NewContext(grohl.Data{"fn": "watchHost", "host.id": id})
 
@@ -351,6 +598,19 @@ func (c *context) watchHost(id string) {
 	ch := make(chan *host.Event)
 	h.StreamEvents("all", ch)
 
+	// record the addresses of running jobs and send the current network
+	// policies, later changes are sent by syncNetworkPolicies
+	if jobs, err := h.ListJobs(); err == nil {
+		for _, job := range jobs {
+			if job.Status == host.StatusRunning {
+				c.network.AddJob(id, &job)
+			}
+		}
+	}
+	if err := h.SetNetworkPolicies(c.network.Build()); err != nil {
+		g.Log(grohl.Data{"at": "set_network_policies_error", "err": err})
+	}
+
 	for event := range ch {
 		meta := event.Job.Job.Metadata
 		appID := meta["flynn-controller.app"]
@@ -360,13 +620,30 @@ func (c *context) watchHost(id string) {
 		if appID == "" || releaseID == "" {
 			continue
 		}
+		if event.Event == "recovered" {
+			// the job was stopped when it became unhealthy, so it stays
+			// unhealthy rather than being reported up again
+			g.Log(grohl.Data{"at": "recovered", "job.id": event.JobID})
+			continue
+		}
+
+		switch event.Event {
+		case "start":
+			c.network.AddJob(id, event.Job)
+		case "stop", "error":
+			c.network.RemoveJob(id, event.JobID)
+		}
 
+		state := jobState(event)
+		if (event.Event == "stop" || event.Event == "error") && c.removePreempted(id, event.JobID) {
+			state = "preempted"
+		}
 		job := &ct.Job{
 			ID:        id + "-" + event.JobID,
 			AppID:     appID,
 			ReleaseID: releaseID,
 			Type:      jobType,
-			State:     jobState(event),
+			State:     state,
 			Meta:      jobMetaFromMetadata(meta),
 		}
 		g.Log(grohl.Data{"at": "event", "job.id": event.JobID, "event": event.Event})
@@ -389,6 +666,17 @@ func (c *context) watchHost(id string) {
 		}
 		j.startedAt = event.Job.StartedAt
 
+		if event.Event == "unhealthy" {
+			// stop the job, it is restarted once it has stopped
+			g.Log(grohl.Data{"at": "stop_unhealthy", "job.id": event.JobID})
+			go func(jobID string) {
+				if err := h.StopJob(jobID); err != nil {
+					g.Log(grohl.Data{"at": "error", "job.id": jobID, "err": err})
+				}
+			}(event.JobID)
+			continue
+		}
+
 		if event.Event != "error" && event.Event != "stop" {
 			continue
 		}
@@ -404,6 +692,81 @@ func (c *context) watchHost(id string) {
 	// TODO: check error/reconnect
 }
 
+func jobVolumes(job *host.Job) []string {
+	var names []string
+	for _, m := range job.Config.Mounts {
+		if m.Volume != "" {
+			names = append(names, m.Volume)
+		}
+	}
+	return names
+}
+
+// volumeHost returns the ID of the host which owns the named volumes used by
+// job, or an empty string if the job doesn't use named volumes or they don't
+// exist yet. An error is returned if the owner is not one of hosts.
+func (c *context) volumeHost(hosts []host.Host, job *host.Job) (string, error) {
+	names := jobVolumes(job)
+	if len(names) == 0 {
+		return "", nil
+	}
+
+	var hostID string
+	c.volumeHostsMtx.Lock()
+	for _, name := range names {
+		id, ok := c.volumeHosts[name]
+		if !ok {
+			continue
+		}
+		if hostID != "" && id != hostID {
+			c.volumeHostsMtx.Unlock()
+			return "", fmt.Errorf("scheduler: volumes of job are on different hosts (%s and %s)", hostID, id)
+		}
+		hostID = id
+	}
+	c.volumeHostsMtx.Unlock()
+
+	if hostID == "" {
+		// the volumes may have been created before the scheduler started,
+		// so ask the hosts
+	outer:
+		for _, h := range hosts {
+			client := c.hosts.Get(h.ID)
+			if client == nil {
+				continue
+			}
+			for _, name := range names {
+				if _, err := client.GetVolume(name); err == nil {
+					hostID = h.ID
+					break outer
+				}
+			}
+		}
+		if hostID == "" {
+			return "", nil
+		}
+	}
+
+	for _, h := range hosts {
+		if h.ID == hostID {
+			return hostID, nil
+		}
+	}
+	return "", fmt.Errorf("scheduler: host %s which owns the volumes of job is not online", hostID)
+}
+
+func (c *context) setVolumeHost(job *host.Job, hostID string) {
+	names := jobVolumes(job)
+	if len(names) == 0 {
+		return
+	}
+	c.volumeHostsMtx.Lock()
+	defer c.volumeHostsMtx.Unlock()
+	for _, name := range names {
+		c.volumeHosts[name] = hostID
+	}
+}
+
 func newHostClients() *hostClients {
 	return &hostClients{hosts: make(map[string]cluster.Host)}
 }
@@ -441,6 +804,29 @@ func (h *hostClients) Get(id string) cluster.Host {
 	return h.hosts[id]
 }
 
+// Connected returns the clients of all connected hosts keyed by host ID.
+func (h *hostClients) Connected() map[string]cluster.Host {
+	h.mtx.RLock()
+	defer h.mtx.RUnlock()
+	res := make(map[string]cluster.Host, len(h.hosts))
+	for id, client := range h.hosts {
+		if client != nil {
+			res[id] = client
+		}
+	}
+	return res
+}
+
+// List returns the status of all connected hosts.
+func (h *hostClients) List() []*HostStatus {
+	connected := h.Connected()
+	res := make([]*HostStatus, 0, len(connected))
+	for id := range connected {
+		res = append(res, &HostStatus{ID: id})
+	}
+	return res
+}
+
 func newJobMap() *jobMap {
 	return &jobMap{jobs: make(map[jobKey]*Job)}
 }
@@ -468,6 +854,30 @@ func (m *jobMap) Get(host, job string) *Job {
 	return m.jobs[jobKey{host, job}]
 }
 
+func (m *jobMap) List() []*Job {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	res := make([]*Job, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		res = append(res, job)
+	}
+	return res
+}
+
+// RemoveHost removes and returns all jobs of the host.
+func (m *jobMap) RemoveHost(hostID string) []*Job {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	var res []*Job
+	for k, job := range m.jobs {
+		if k.hostID == hostID {
+			res = append(res, job)
+			delete(m.jobs, k)
+		}
+	}
+	return res
+}
+
 func (m *jobMap) Len() int {
 	m.mtx.RLock()
 	defer m.mtx.RUnlock()
@@ -513,6 +923,16 @@ func (fs *Formations) Delete(f *Formation) {
 	fs.mtx.Unlock()
 }
 
+func (fs *Formations) List() []*Formation {
+	fs.mtx.RLock()
+	defer fs.mtx.RUnlock()
+	res := make([]*Formation, 0, len(fs.formations))
+	for _, f := range fs.formations {
+		res = append(res, f)
+	}
+	return res
+}
+
 func (fs *Formations) Len() int {
 	fs.mtx.Lock()
 	defer fs.mtx.Unlock()
@@ -526,6 +946,7 @@ func NewFormation(c *context, ef *ct.ExpandedFormation) *Formation {
 		Release:   ef.Release,
 		Artifact:  ef.Artifact,
 		Processes: ef.Processes,
+		LogDrains: logDrainURLs(ef),
 		jobs:      make(jobTypeMap),
 		c:         c,
 	}
@@ -539,6 +960,7 @@ type Job struct {
 
 	restarts  int
 	timer     *time.Timer
+	restartAt time.Time
 	timerMtx  sync.Mutex
 	startedAt time.Time
 }
@@ -581,6 +1003,7 @@ type Formation struct {
 	Release   *ct.Release
 	Artifact  *ct.Artifact
 	Processes map[string]int
+	LogDrains []string
 
 	jobs jobTypeMap
 	c    *context
@@ -596,6 +1019,45 @@ func (f *Formation) SetProcesses(p map[string]int) {
 	f.mtx.Unlock()
 }
 
+// SetLogDrains sets the log drains of the formation, returning whether they
+// have changed.
+func (f *Formation) SetLogDrains(drains []string) bool {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	if stringsEqual(f.LogDrains, drains) {
+		return false
+	}
+	f.LogDrains = drains
+	return true
+}
+
+// UpdateLogDrains sends the current log drains of the formation to the hosts
+// of its running jobs.
+func (f *Formation) UpdateLogDrains() {
+	g := grohl.NewContext(grohl.Data{"fn": "UpdateLogDrains", "app.id": f.AppID, "release.id": f.Release.ID})
+
+	f.mtx.Lock()
+	drains := f.LogDrains
+	var jobs []*Job
+	for _, typeJobs := range f.jobs {
+		for _, job := range typeJobs {
+			jobs = append(jobs, job)
+		}
+	}
+	f.mtx.Unlock()
+
+	for _, job := range jobs {
+		h := f.c.hosts.Get(job.HostID)
+		if h == nil {
+			g.Log(grohl.Data{"at": "unknown_host", "host.id": job.HostID, "job.id": job.ID})
+			continue
+		}
+		if err := h.SetLogDrains(job.ID, drains); err != nil {
+			g.Log(grohl.Data{"at": "error", "host.id": job.HostID, "job.id": job.ID, "err": err})
+		}
+	}
+}
+
 func (f *Formation) Rectify() {
 	f.mtx.Lock()
 	defer f.mtx.Unlock()
@@ -632,15 +1094,42 @@ func (f *Formation) RestartJob(typ, hostID, jobID string) {
 		job.timer = time.AfterFunc(duration, func() {
 			f.restart(job)
 		})
+		job.restartAt = time.Now().Add(duration)
 		job.timerMtx.Unlock()
 	}
 }
 
+// RescheduleJob replaces a job which was lost along with its host by starting
+// a new job straight away, without any backoff.
+func (f *Formation) RescheduleJob(job *Job) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	g := grohl.NewContext(grohl.Data{"fn": "RescheduleJob", "app.id": f.AppID, "release.id": f.Release.ID})
+	if f.jobs.Get(job.Type, job.HostID, job.ID) == nil {
+		return
+	}
+	f.jobs.Remove(job)
+	// one off jobs are not restarted, and omni jobs only run on the lost host
+	if job.Type == "" || f.Release.Processes[job.Type].Omni {
+		return
+	}
+	newJob, err := f.start(job.Type, "")
+	if err != nil {
+		g.Log(grohl.Data{"at": "error", "old.host.id": job.HostID, "old.job.id": job.ID, "err": err})
+		return
+	}
+	g.Log(grohl.Data{"old.host.id": job.HostID, "old.job.id": job.ID, "new.host.id": newJob.HostID, "new.job.id": newJob.ID})
+}
+
 func (f *Formation) rectify() {
 	g := grohl.NewContext(grohl.Data{"fn": "rectify", "app.id": f.AppID, "release.id": f.Release.ID})
 
 	var hosts []host.Host
-	if _, ok := f.c.omni[f]; ok {
+	f.c.omniMtx.RLock()
+	_, omni := f.c.omni[f]
+	f.c.omniMtx.RUnlock()
+	if omni {
 		var err error
 		hosts, err = f.c.ListHosts()
 		if err != nil {
@@ -668,6 +1157,7 @@ func (f *Formation) rectify() {
 			for hostID, actual := range hostCounts {
 				diff := expected - actual
 				g.Log(grohl.Data{"at": "update", "type": t, "expected": expected, "actual": actual, "diff": diff})
+				f.recordDecision(t, hostID, expected, actual)
 				if diff > 0 {
 					f.add(diff, t, hostID)
 				} else if diff < 0 {
@@ -678,6 +1168,7 @@ func (f *Formation) rectify() {
 			actual := len(f.jobs[t])
 			diff := expected - actual
 			g.Log(grohl.Data{"at": "update", "type": t, "expected": expected, "actual": actual, "diff": diff})
+			f.recordDecision(t, "", expected, actual)
 			if diff > 0 {
 				f.add(diff, t, "")
 			} else if diff < 0 {
@@ -694,11 +1185,27 @@ func (f *Formation) rectify() {
 		}
 		if _, exists := f.Processes[t]; !exists {
 			g.Log(grohl.Data{"at": "cleanup", "type": t, "count": len(jobs)})
+			f.recordDecision(t, "", 0, len(jobs))
 			f.remove(len(jobs), t, "")
 		}
 	}
 }
 
+func (f *Formation) recordDecision(typ, hostID string, expected, actual int) {
+	if expected == actual {
+		return
+	}
+	f.c.decisions.Add(&RectifyDecision{
+		AppID:     f.AppID,
+		ReleaseID: f.Release.ID,
+		Type:      typ,
+		HostID:    hostID,
+		Expected:  expected,
+		Actual:    actual,
+		Diff:      expected - actual,
+	})
+}
+
 func (f *Formation) add(n int, name string, hostID string) {
 	g := grohl.NewContext(grohl.Data{"fn": "add", "app.id": f.AppID, "release.id": f.Release.ID})
 	for i := 0; i < n; i++ {
@@ -743,28 +1250,27 @@ func (f *Formation) start(typ string, hostID string) (job *Job, err error) {
 		return nil, errors.New("scheduler: no online hosts")
 	}
 
-	var h host.Host
+	if hostID == "" {
+		if hostID, err = f.c.volumeHost(hosts, config); err != nil {
+			return nil, err
+		}
+	}
+
+	var h *host.Host
 	if hostID != "" {
-		for _, host := range hosts {
-			if hostID == host.ID {
-				h = host
+		for i := range hosts {
+			if hostID == hosts[i].ID {
+				h = &hosts[i]
 				break
 			}
 		}
 	} else {
-		sh := make(sortHosts, 0, len(hosts))
-		for _, host := range hosts {
-			var count int
-			for _, job := range h.Jobs {
-				if f.jobType(job) != typ {
-					continue
-				}
-				count++
-			}
-			sh = append(sh, sortHost{host, count})
+		h = f.c.policy.PickHost(hosts, config)
+	}
+	if h == nil || schedutil.HostFull(h) {
+		if h, err = f.preempt(hosts, hostID, config); err != nil {
+			return nil, err
 		}
-		sh.Sort()
-		h = sh[0].Host
 	}
 
 	job = f.jobs.Add(typ, h.ID, config.ID)
@@ -777,9 +1283,62 @@ func (f *Formation) start(typ string, hostID string) (job *Job, err error) {
 		f.c.jobs.Remove(config.ID, h.ID)
 		return nil, err
 	}
+	f.c.setVolumeHost(config, h.ID)
 	return job, nil
 }
 
+// preempt stops the lowest priority job which has a lower priority than job,
+// returning the host it was running on so that job can be started there
+// instead. If hostID is set, only jobs on that host are considered.
+func (f *Formation) preempt(hosts []host.Host, hostID string, job *host.Job) (*host.Host, error) {
+	priority := schedutil.JobPriority(job)
+
+	var victim *host.Job
+	var victimHost *host.Host
+	var victimPriority int
+	for i := range hosts {
+		h := &hosts[i]
+		if hostID != "" && h.ID != hostID {
+			continue
+		}
+		for _, j := range h.Jobs {
+			p := schedutil.JobPriority(j)
+			if p >= priority {
+				continue
+			}
+			// prefer the lowest priority job, and then the busiest host
+			if victim == nil || p < victimPriority || p == victimPriority && len(h.Jobs) > len(victimHost.Jobs) {
+				victim, victimHost, victimPriority = j, h, p
+			}
+		}
+	}
+	if victim == nil {
+		return nil, errors.New("scheduler: no suitable host")
+	}
+
+	g := grohl.NewContext(grohl.Data{"fn": "preempt", "app.id": f.AppID, "release.id": f.Release.ID})
+	client := f.c.hosts.Get(victimHost.ID)
+	if client == nil {
+		return nil, fmt.Errorf("scheduler: host %s is not connected", victimHost.ID)
+	}
+	f.c.addPreempted(victimHost.ID, victim.ID)
+	if err := client.StopJob(victim.ID); err != nil {
+		f.c.removePreempted(victimHost.ID, victim.ID)
+		return nil, err
+	}
+	g.Log(grohl.Data{
+		"at":                "preempted",
+		"host.id":           victimHost.ID,
+		"job.id":            victim.ID,
+		"job.app.id":        victim.Metadata["flynn-controller.app"],
+		"job.type":          victim.Metadata["flynn-controller.type"],
+		"job.priority":      victimPriority,
+		"required.type":     job.Metadata["flynn-controller.type"],
+		"required.priority": priority,
+	})
+	return victimHost, nil
+}
+
 func (f *Formation) jobType(job *host.Job) string {
 	if job.Metadata["flynn-controller.app"] != f.AppID ||
 		job.Metadata["flynn-controller.release"] != f.Release.ID {
@@ -836,29 +1395,36 @@ func (f *Formation) remove(n int, name string, hostID string) {
 }
 
 func (f *Formation) jobConfig(name string) *host.Job {
+	drains := make([]*ct.LogDrain, len(f.LogDrains))
+	for i, url := range f.LogDrains {
+		drains[i] = &ct.LogDrain{URL: url}
+	}
 	return utils.JobConfig(&ct.ExpandedFormation{
-		App:      &ct.App{ID: f.AppID, Name: f.AppName},
-		Release:  f.Release,
-		Artifact: f.Artifact,
+		App:       &ct.App{ID: f.AppID, Name: f.AppName},
+		Release:   f.Release,
+		Artifact:  f.Artifact,
+		LogDrains: drains,
 	}, name)
 }
 
-type sortHost struct {
-	Host host.Host
-	Jobs int
+func logDrainURLs(ef *ct.ExpandedFormation) []string {
+	urls := make([]string, len(ef.LogDrains))
+	for i, d := range ef.LogDrains {
+		urls[i] = d.URL
+	}
+	return urls
 }
 
-type sortHosts []sortHost
-
-func (h sortHosts) Len() int      { return len(h) }
-func (h sortHosts) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
-func (h sortHosts) Sort()         { sort.Sort(h) }
-
-func (h sortHosts) Less(i, j int) bool {
-	if h[i].Jobs == h[j].Jobs {
-		return len(h[i].Host.Jobs) < len(h[j].Host.Jobs)
+func stringsEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
 	}
-	return h[i].Jobs < h[j].Jobs
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
 }
 
 type FormationEvent struct {
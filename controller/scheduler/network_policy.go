@@ -0,0 +1,167 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/technoweenie/grohl"
+	ct "github.com/flynn/flynn/controller/types"
+	"github.com/flynn/flynn/host/types"
+	"github.com/flynn/flynn/pkg/attempt"
+)
+
+func newNetworkPolicies() *networkPolicies {
+	return &networkPolicies{
+		policies: make(map[string]*ct.NetworkPolicy),
+		addrs:    make(map[jobKey]jobAddr),
+		update:   make(chan struct{}, 1),
+	}
+}
+
+// networkPolicies tracks the network policies of apps along with the overlay
+// network addresses of their jobs, which are combined into the list of
+// addresses each isolated app accepts connections from.
+type networkPolicies struct {
+	policies map[string]*ct.NetworkPolicy
+	addrs    map[jobKey]jobAddr
+	mtx      sync.Mutex
+
+	// update is signalled when the policies may need to be sent to the
+	// hosts again
+	update chan struct{}
+}
+
+type jobAddr struct {
+	AppID string
+	IP    string
+}
+
+// SetPolicy sets the network policy of an app, a nil policy removes it.
+func (n *networkPolicies) SetPolicy(appID string, policy *ct.NetworkPolicy) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	if policy == nil || !policy.Isolated && len(policy.Dependencies) == 0 {
+		if _, ok := n.policies[appID]; !ok {
+			return
+		}
+		delete(n.policies, appID)
+	} else {
+		if p, ok := n.policies[appID]; ok && p.Isolated == policy.Isolated && stringsEqual(p.Dependencies, policy.Dependencies) {
+			return
+		}
+		n.policies[appID] = policy
+	}
+	n.notify()
+}
+
+// AddJob records the address of a job running on the overlay network, jobs
+// using the host network are ignored.
+func (n *networkPolicies) AddJob(hostID string, job *host.ActiveJob) {
+	appID := job.Job.Metadata["flynn-controller.app"]
+	if appID == "" || job.InternalIP == "" {
+		return
+	}
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	n.addrs[jobKey{hostID, job.Job.ID}] = jobAddr{AppID: appID, IP: job.InternalIP}
+	n.notify()
+}
+
+func (n *networkPolicies) RemoveJob(hostID, jobID string) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	k := jobKey{hostID, jobID}
+	if _, ok := n.addrs[k]; !ok {
+		return
+	}
+	delete(n.addrs, k)
+	n.notify()
+}
+
+// RemoveHost forgets the addresses of all jobs on a host which has gone.
+func (n *networkPolicies) RemoveHost(hostID string) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	for k := range n.addrs {
+		if k.hostID == hostID {
+			delete(n.addrs, k)
+		}
+	}
+	n.notify()
+}
+
+func (n *networkPolicies) notify() {
+	select {
+	case n.update <- struct{}{}:
+	default:
+	}
+}
+
+// Build returns the host policy of every isolated app. An isolated app
+// accepts connections from its own jobs and from the jobs of apps which
+// depend on it.
+func (n *networkPolicies) Build() []*host.NetworkPolicy {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	ips := make(map[string][]string)
+	for _, addr := range n.addrs {
+		ips[addr.AppID] = append(ips[addr.AppID], addr.IP)
+	}
+
+	res := []*host.NetworkPolicy{}
+	for appID, policy := range n.policies {
+		if !policy.Isolated {
+			continue
+		}
+		allowed := append([]string{}, ips[appID]...)
+		for otherID, other := range n.policies {
+			for _, dep := range other.Dependencies {
+				if dep == appID {
+					allowed = append(allowed, ips[otherID]...)
+					break
+				}
+			}
+		}
+		sort.Strings(allowed)
+		res = append(res, &host.NetworkPolicy{AppID: appID, AllowedIPs: allowed})
+	}
+	sort.Sort(networkPoliciesByApp(res))
+	return res
+}
+
+type networkPoliciesByApp []*host.NetworkPolicy
+
+func (p networkPoliciesByApp) Len() int           { return len(p) }
+func (p networkPoliciesByApp) Less(i, j int) bool { return p[i].AppID < p[j].AppID }
+func (p networkPoliciesByApp) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+var setNetworkPoliciesAttempts = attempt.Strategy{
+	Total: 10 * time.Second,
+	Delay: 500 * time.Millisecond,
+}
+
+// syncNetworkPolicies sends the network policies to all connected hosts
+// whenever they change. Hosts which connect later are sent the policies by
+// watchHost.
+func (c *context) syncNetworkPolicies() {
+	g := grohl.NewContext(grohl.Data{"fn": "syncNetworkPolicies"})
+
+	var last []*host.NetworkPolicy
+	for range c.network.update {
+		policies := c.network.Build()
+		if reflect.DeepEqual(policies, last) {
+			continue
+		}
+		last = policies
+		for id, h := range c.hosts.Connected() {
+			if err := setNetworkPoliciesAttempts.Run(func() error {
+				return h.SetNetworkPolicies(policies)
+			}); err != nil {
+				g.Log(grohl.Data{"at": "error", "host.id": id, "err": err})
+			}
+		}
+	}
+}
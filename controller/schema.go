@@ -185,5 +185,41 @@ $$ LANGUAGE plpgsql`,
     CONSTRAINT que_jobs_pkey PRIMARY KEY (queue, priority, run_at, job_id))`,
 		`COMMENT ON TABLE que_jobs IS '3'`,
 	)
+	// enum values cannot be added inside a transaction, so recreate the type
+	m.Add(3,
+		`ALTER TYPE job_state RENAME TO job_state_old`,
+		`CREATE TYPE job_state AS ENUM ('starting', 'up', 'down', 'crashed', 'preempted')`,
+		`ALTER TABLE job_cache ALTER COLUMN state TYPE job_state USING state::text::job_state`,
+		`ALTER TABLE job_events ALTER COLUMN state TYPE job_state USING state::text::job_state`,
+		`DROP TYPE job_state_old`,
+	)
+	m.Add(4,
+		`CREATE TABLE log_drains (
+    drain_id uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+    app_id uuid NOT NULL REFERENCES apps (app_id),
+    url text NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    deleted_at timestamptz
+)`,
+		`CREATE INDEX ON log_drains (app_id) WHERE deleted_at IS NULL`,
+	)
+	m.Add(5,
+		`CREATE TABLE network_policies (
+    app_id uuid PRIMARY KEY REFERENCES apps (app_id),
+    isolated boolean NOT NULL DEFAULT false,
+    dependencies text NOT NULL DEFAULT '[]',
+    created_at timestamptz NOT NULL DEFAULT now(),
+    updated_at timestamptz NOT NULL DEFAULT now()
+)`,
+	)
+	// add the unhealthy state of jobs failing their health check, recreating
+	// the type as in migration 3
+	m.Add(6,
+		`ALTER TYPE job_state RENAME TO job_state_old`,
+		`CREATE TYPE job_state AS ENUM ('starting', 'up', 'down', 'crashed', 'preempted', 'unhealthy')`,
+		`ALTER TABLE job_cache ALTER COLUMN state TYPE job_state USING state::text::job_state`,
+		`ALTER TABLE job_events ALTER COLUMN state TYPE job_state USING state::text::job_state`,
+		`DROP TYPE job_state_old`,
+	)
 	return m.Migrate(db)
 }
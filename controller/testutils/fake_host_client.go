@@ -1,12 +1,16 @@
 package testutils
 
 import (
+	"bytes"
 	"errors"
+	"io"
+	"io/ioutil"
 	"sync"
 	"time"
 
 	"github.com/flynn/flynn/host/types"
 	"github.com/flynn/flynn/pkg/cluster"
+	"github.com/flynn/flynn/pkg/random"
 	"github.com/flynn/flynn/pkg/stream"
 )
 
@@ -15,6 +19,12 @@ func NewFakeHostClient(hostID string) *FakeHostClient {
 		hostID:  hostID,
 		stopped: make(map[string]bool),
 		attach:  make(map[string]attachFunc),
+		exec:    make(map[string]execFunc),
+		stats:   make(map[string]*host.JobStats),
+		volumes: make(map[string]*host.Volume),
+		drains:  make(map[string][]string),
+		logs:    make(map[string][]*host.LogMessage),
+		files:   make(map[string][]byte),
 	}
 }
 
@@ -22,12 +32,21 @@ type FakeHostClient struct {
 	hostID    string
 	stopped   map[string]bool
 	attach    map[string]attachFunc
+	exec      map[string]execFunc
+	stats     map[string]*host.JobStats
+	volumes   map[string]*host.Volume
+	drains    map[string][]string
+	drainsMtx sync.Mutex
+	logs      map[string][]*host.LogMessage
+	files     map[string][]byte
+	filesMtx  sync.Mutex
 	cluster   *FakeCluster
 	listeners []chan<- *host.Event
 	listenMtx sync.RWMutex
 }
 
 func (c *FakeHostClient) ListJobs() (map[string]host.ActiveJob, error) { return nil, nil }
+func (c *FakeHostClient) ListJobHistory() ([]host.ActiveJob, error)    { return nil, nil }
 func (c *FakeHostClient) Attach(req *host.AttachReq, wait bool) (cluster.AttachClient, error) {
 	f, ok := c.attach[req.JobID]
 	if !ok {
@@ -36,6 +55,14 @@ func (c *FakeHostClient) Attach(req *host.AttachReq, wait bool) (cluster.AttachC
 	return f(req, wait)
 }
 
+func (c *FakeHostClient) Exec(req *host.ExecReq) (cluster.AttachClient, error) {
+	f, ok := c.exec[req.JobID]
+	if !ok {
+		return nil, errors.New("job not found")
+	}
+	return f(req)
+}
+
 func (c *FakeHostClient) GetJob(id string) (*host.ActiveJob, error) {
 	hosts, err := c.cluster.ListHosts()
 	if err != nil {
@@ -52,6 +79,148 @@ func (c *FakeHostClient) GetJob(id string) (*host.ActiveJob, error) {
 	return nil, errors.New("job not found")
 }
 
+func (c *FakeHostClient) GetJobStats(id string) (*host.JobStats, error) {
+	stats, ok := c.stats[id]
+	if !ok {
+		return nil, errors.New("job not found")
+	}
+	return stats, nil
+}
+
+func (c *FakeHostClient) StreamJobStats(id string, interval time.Duration, ch chan<- *host.JobStats) (stream.Stream, error) {
+	stats, ok := c.stats[id]
+	if !ok {
+		return nil, errors.New("job not found")
+	}
+	go func() {
+		ch <- stats
+		close(ch)
+	}()
+	return &FakeHostStatsStream{}, nil
+}
+
+func (c *FakeHostClient) SetJobStats(id string, stats *host.JobStats) {
+	c.stats[id] = stats
+}
+
+// StreamLog sends the messages set with SetLog, followed by an empty message
+// if follow is set. Followed streams stay open until closed.
+func (c *FakeHostClient) StreamLog(id string, follow bool, ch chan<- *host.LogMessage) (stream.Stream, error) {
+	msgs, ok := c.logs[id]
+	if !ok {
+		return nil, errors.New("job not found")
+	}
+	s := &FakeHostLogStream{done: make(chan struct{})}
+	go func() {
+		defer close(ch)
+		for _, msg := range msgs {
+			select {
+			case ch <- msg:
+			case <-s.done:
+				return
+			}
+		}
+		if !follow {
+			return
+		}
+		select {
+		case ch <- &host.LogMessage{}:
+		case <-s.done:
+			return
+		}
+		<-s.done
+	}()
+	return s, nil
+}
+
+func (c *FakeHostClient) SetLog(id string, msgs []*host.LogMessage) {
+	c.logs[id] = msgs
+}
+
+func (c *FakeHostClient) SetLogDrains(id string, drains []string) error {
+	c.drainsMtx.Lock()
+	c.drains[id] = drains
+	c.drainsMtx.Unlock()
+	return nil
+}
+
+func (c *FakeHostClient) LogDrains(id string) []string {
+	c.drainsMtx.Lock()
+	defer c.drainsMtx.Unlock()
+	return c.drains[id]
+}
+
+// CopyFrom returns the archive set with SetArchive or written with CopyTo.
+func (c *FakeHostClient) CopyFrom(id, path string) (io.ReadCloser, error) {
+	c.filesMtx.Lock()
+	defer c.filesMtx.Unlock()
+	data, ok := c.files[id+":"+path]
+	if !ok {
+		return nil, errors.New("file not found")
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (c *FakeHostClient) CopyTo(id, path string, archive io.Reader) error {
+	data, err := ioutil.ReadAll(archive)
+	if err != nil {
+		return err
+	}
+	c.SetArchive(id, path, data)
+	return nil
+}
+
+func (c *FakeHostClient) SetArchive(id, path string, data []byte) {
+	c.filesMtx.Lock()
+	c.files[id+":"+path] = data
+	c.filesMtx.Unlock()
+}
+
+func (c *FakeHostClient) SetNetworkPolicies([]*host.NetworkPolicy) error { return nil }
+
+func (c *FakeHostClient) ListVolumes() ([]*host.Volume, error) {
+	volumes := make([]*host.Volume, 0, len(c.volumes))
+	for _, v := range c.volumes {
+		volumes = append(volumes, v)
+	}
+	return volumes, nil
+}
+
+func (c *FakeHostClient) GetVolume(name string) (*host.Volume, error) {
+	v, ok := c.volumes[name]
+	if !ok {
+		return nil, errors.New("volume not found")
+	}
+	return v, nil
+}
+
+func (c *FakeHostClient) CreateVolume(name string) (*host.Volume, error) {
+	if _, ok := c.volumes[name]; ok {
+		return nil, errors.New("volume already exists")
+	}
+	v := &host.Volume{Name: name, CreatedAt: time.Now().UTC()}
+	c.volumes[name] = v
+	return v, nil
+}
+
+func (c *FakeHostClient) DeleteVolume(name string) error {
+	if _, ok := c.volumes[name]; !ok {
+		return errors.New("volume not found")
+	}
+	delete(c.volumes, name)
+	return nil
+}
+
+func (c *FakeHostClient) CreateSnapshot(volume string) (*host.VolumeSnapshot, error) {
+	v, ok := c.volumes[volume]
+	if !ok {
+		return nil, errors.New("volume not found")
+	}
+	snapshot := &host.VolumeSnapshot{ID: random.UUID(), CreatedAt: time.Now().UTC()}
+	v.Snapshots = append(v.Snapshots, snapshot)
+	return snapshot, nil
+}
+
 func (c *FakeHostClient) StreamEvents(id string, ch chan<- *host.Event) (stream.Stream, error) {
 	c.listenMtx.Lock()
 	defer c.listenMtx.Unlock()
@@ -79,6 +248,10 @@ func (c *FakeHostClient) SetAttachFunc(id string, f attachFunc) {
 	c.attach[id] = f
 }
 
+func (c *FakeHostClient) SetExecFunc(id string, f execFunc) {
+	c.exec[id] = f
+}
+
 func (c *FakeHostClient) SendEvent(event, id string) {
 	c.listenMtx.RLock()
 	defer c.listenMtx.RUnlock()
@@ -94,6 +267,8 @@ func (c *FakeHostClient) SendEvent(event, id string) {
 
 type attachFunc func(req *host.AttachReq, wait bool) (cluster.AttachClient, error)
 
+type execFunc func(req *host.ExecReq) (cluster.AttachClient, error)
+
 type FakeHostEventStream struct {
 	ch chan<- *host.Event
 }
@@ -106,3 +281,20 @@ func (h *FakeHostEventStream) Close() error {
 func (h *FakeHostEventStream) Err() error {
 	return nil
 }
+
+type FakeHostStatsStream struct{}
+
+func (FakeHostStatsStream) Close() error { return nil }
+func (FakeHostStatsStream) Err() error   { return nil }
+
+type FakeHostLogStream struct {
+	done     chan struct{}
+	closeOne sync.Once
+}
+
+func (s *FakeHostLogStream) Close() error {
+	s.closeOne.Do(func() { close(s.done) })
+	return nil
+}
+
+func (s *FakeHostLogStream) Err() error { return nil }
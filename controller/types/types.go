@@ -7,11 +7,13 @@ import (
 )
 
 type ExpandedFormation struct {
-	App       *App           `json:"app,omitempty"`
-	Release   *Release       `json:"release,omitempty"`
-	Artifact  *Artifact      `json:"artifact,omitempty"`
-	Processes map[string]int `json:"processes,omitempty"`
-	UpdatedAt time.Time      `json:"updated_at,omitempty"`
+	App           *App           `json:"app,omitempty"`
+	Release       *Release       `json:"release,omitempty"`
+	Artifact      *Artifact      `json:"artifact,omitempty"`
+	Processes     map[string]int `json:"processes,omitempty"`
+	LogDrains     []*LogDrain    `json:"log_drains,omitempty"`
+	NetworkPolicy *NetworkPolicy `json:"network_policy,omitempty"`
+	UpdatedAt     time.Time      `json:"updated_at,omitempty"`
 }
 
 type App struct {
@@ -38,8 +40,41 @@ type ProcessType struct {
 	Env         map[string]string `json:"env,omitempty"`
 	Ports       []Port            `json:"ports,omitempty"`
 	Data        bool              `json:"data,omitempty"`
+	Volumes     []VolumeReq       `json:"volumes,omitempty"`
 	Omni        bool              `json:"omni,omitempty"` // omnipresent - present on all hosts
 	HostNetwork bool              `json:"host_network,omitempty"`
+	Priority    int               `json:"priority,omitempty"` // jobs may preempt jobs with a lower priority
+
+	// StopSignal and StopTimeout (in seconds) control how jobs are stopped
+	// when scaling down or deploying, see host.ContainerConfig.
+	StopSignal  string `json:"stop_signal,omitempty"`
+	StopTimeout int    `json:"stop_timeout,omitempty"`
+
+	// HealthCheck is run against running jobs, which are only reported up
+	// once it passes, see host.HealthCheck.
+	HealthCheck *HealthCheck `json:"health_check,omitempty"`
+}
+
+// HealthCheck has the same fields as host.HealthCheck.
+type HealthCheck struct {
+	Type         string   `json:"type,omitempty"`
+	Port         int      `json:"port,omitempty"`
+	Path         string   `json:"path,omitempty"`
+	Host         string   `json:"host,omitempty"`
+	Status       int      `json:"status,omitempty"`
+	Match        string   `json:"match,omitempty"`
+	Cmd          []string `json:"cmd,omitempty"`
+	Interval     int      `json:"interval,omitempty"`
+	Timeout      int      `json:"timeout,omitempty"`
+	Threshold    int      `json:"threshold,omitempty"`
+	StartTimeout int      `json:"start_timeout,omitempty"`
+}
+
+// VolumeReq mounts a named persistent volume at Path. Named volumes survive
+// job restarts, and jobs using them are kept on the host which owns them.
+type VolumeReq struct {
+	Path string `json:"path"`
+	Name string `json:"name"`
 }
 
 type Port struct {
@@ -70,6 +105,25 @@ type Key struct {
 	CreatedAt *time.Time `json:"created_at,omitempty"`
 }
 
+// LogDrain forwards the output of all jobs of an app to a syslog
+// (syslog+tcp:// or syslog+tls://) or HTTP (http:// or https://) endpoint.
+type LogDrain struct {
+	ID        string     `json:"id,omitempty"`
+	AppID     string     `json:"app,omitempty"`
+	URL       string     `json:"url,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+}
+
+// NetworkPolicy controls which apps may connect to the jobs of an app. Jobs
+// of an isolated app only accept connections from the router, from other jobs
+// of the app and from jobs of apps which list it as a dependency.
+type NetworkPolicy struct {
+	AppID        string     `json:"app,omitempty"`
+	Isolated     bool       `json:"isolated"`
+	Dependencies []string   `json:"dependencies,omitempty"`
+	UpdatedAt    *time.Time `json:"updated_at,omitempty"`
+}
+
 type Job struct {
 	ID        string            `json:"id,omitempty"`
 	AppID     string            `json:"app,omitempty"`
@@ -88,6 +142,15 @@ type JobEvent struct {
 	JobID string `json:"job_id,omitempty"`
 }
 
+// LogMessage is a line of output from one of the jobs of an app.
+type LogMessage struct {
+	JobID     string    `json:"job_id,omitempty"`
+	Type      string    `json:"type,omitempty"`
+	Stream    string    `json:"stream,omitempty"`
+	Timestamp time.Time `json:"timestamp,omitempty"`
+	Message   string    `json:"message"`
+}
+
 type NewJob struct {
 	ReleaseID  string            `json:"release,omitempty"`
 	Cmd        []string          `json:"cmd,omitempty"`
@@ -99,6 +162,14 @@ type NewJob struct {
 	Lines      int               `json:"tty_lines,omitempty"`
 }
 
+type JobExec struct {
+	Cmd     []string          `json:"cmd,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	TTY     bool              `json:"tty,omitempty"`
+	Columns int               `json:"tty_columns,omitempty"`
+	Lines   int               `json:"tty_lines,omitempty"`
+}
+
 type Deployment struct {
 	ID           string     `json:"id,omitempty"`
 	AppID        string     `json:"app,omitempty"`
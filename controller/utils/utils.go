@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"strconv"
+
 	ct "github.com/flynn/flynn/controller/types"
 	"github.com/flynn/flynn/host/types"
 )
@@ -31,8 +33,16 @@ func JobConfig(f *ct.ExpandedFormation, name string) *host.Job {
 			Cmd:         t.Cmd,
 			Env:         env,
 			HostNetwork: t.HostNetwork,
+			StopSignal:  t.StopSignal,
+			StopTimeout: t.StopTimeout,
 		},
 	}
+	for _, d := range f.LogDrains {
+		job.LogDrains = append(job.LogDrains, d.URL)
+	}
+	if t.Priority != 0 {
+		job.Metadata["flynn-controller.priority"] = strconv.Itoa(t.Priority)
+	}
 	if len(t.Entrypoint) > 0 {
 		job.Config.Entrypoint = t.Entrypoint
 	}
@@ -42,8 +52,15 @@ func JobConfig(f *ct.ExpandedFormation, name string) *host.Job {
 		job.Config.Ports[i].Port = p.Port
 		job.Config.Ports[i].RangeEnd = p.RangeEnd
 	}
+	if t.HealthCheck != nil {
+		check := host.HealthCheck(*t.HealthCheck)
+		job.Config.HealthCheck = &check
+	}
 	if t.Data {
 		job.Config.Mounts = []host.Mount{{Location: "/data", Writeable: true}}
 	}
+	for _, v := range t.Volumes {
+		job.Config.Mounts = append(job.Config.Mounts, host.Mount{Location: v.Path, Volume: v.Name, Writeable: true})
+	}
 	return job
 }
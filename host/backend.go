@@ -2,7 +2,10 @@ package main
 
 import (
 	"io"
+	"syscall"
+	"time"
 
+	"github.com/flynn/flynn/host/logbuf"
 	"github.com/flynn/flynn/host/types"
 )
 
@@ -20,12 +23,55 @@ type AttachRequest struct {
 	Stdin  io.Reader
 }
 
+type ExecRequest struct {
+	Job    *host.ActiveJob
+	Cmd    []string
+	Env    map[string]string
+	TTY    bool
+	Height uint16
+	Width  uint16
+
+	Stdout io.WriteCloser
+	Stderr io.WriteCloser
+	Stdin  io.Reader
+}
+
+// ExecProcess is a process started in a running job by Backend.Exec.
+type ExecProcess interface {
+	Signal(int) error
+	ResizeTTY(height, width uint16) error
+
+	// Wait waits for the process to exit and for its output to be copied,
+	// and returns the exit status.
+	Wait() (int, error)
+}
+
+// stopConfig returns the signal used to stop a job and how long to wait for
+// it to exit before killing it.
+func stopConfig(job *host.Job) (int, time.Duration) {
+	sig := int(syscall.SIGTERM)
+	if s, ok := host.StopSignals[job.Config.StopSignal]; ok {
+		sig = s
+	}
+	timeout := host.DefaultStopTimeout
+	if job.Config.StopTimeout > 0 {
+		timeout = time.Duration(job.Config.StopTimeout) * time.Second
+	}
+	return sig, timeout
+}
+
+// killTimeout is how long Cleanup waits for a job to exit after killing it.
+const killTimeout = 5 * time.Second
+
 type Backend interface {
 	Run(*host.Job) error
 	Stop(string) error
 	Signal(string, int) error
 	ResizeTTY(id string, height, width uint16) error
 	Attach(*AttachRequest) error
+	Exec(*ExecRequest) (ExecProcess, error)
+	Stats(id string) (*host.JobStats, error)
+	OpenLog(id string) *logbuf.Log
 	Cleanup() error
 	UnmarshalState(map[string]*host.ActiveJob, map[string][]byte, []byte) error
 	ConfigureNetworking(strategy NetworkStrategy, job string) (*NetworkInfo, error)
@@ -34,6 +80,11 @@ type Backend interface {
 type NetworkInfo struct {
 	BridgeAddr  string
 	Nameservers []string
+
+	// Network is the overlay network and Subnet the part of it used by
+	// this host, they are empty if jobs use the host network
+	Network string
+	Subnet  string
 }
 
 type JobStateSaver interface {
@@ -5,6 +5,7 @@ import (
 	"io"
 	"os"
 	"sort"
+	"strconv"
 	"text/tabwriter"
 	"time"
 
@@ -18,7 +19,11 @@ func init() {
 	Register("ps", runPs, `
 usage: flynn-host ps [-a|--all] [-q|--quiet]
 
-List jobs`)
+List jobs
+
+Options:
+	-a, --all    include finished jobs, from the job history of each host
+	-q, --quiet  only show job IDs`)
 }
 
 type sortJobs []host.ActiveJob
@@ -61,6 +66,19 @@ func jobList(client *cluster.Client, all bool) (sortJobs, error) {
 		for _, job := range hostJobs {
 			jobs = append(jobs, job)
 		}
+		if !all {
+			continue
+		}
+		// the history also includes jobs which the host has removed
+		history, err := h.ListJobHistory()
+		if err != nil {
+			return nil, fmt.Errorf("could not get job history for host %s: %s", host.ID, err)
+		}
+		for _, job := range history {
+			if _, ok := hostJobs[job.Job.ID]; !ok {
+				jobs = append(jobs, job)
+			}
+		}
 	}
 
 	sorted := make(sortJobs, 0, len(jobs))
@@ -83,6 +101,7 @@ func printJobs(jobs sortJobs, out io.Writer) {
 		"STARTED",
 		"CONTROLLER APP",
 		"CONTROLLER TYPE",
+		"EXIT",
 	)
 
 	for _, job := range jobs {
@@ -97,10 +116,25 @@ func printJobs(jobs sortJobs, out io.Writer) {
 			started,
 			job.Job.Metadata["flynn-controller.app_name"],
 			job.Job.Metadata["flynn-controller.type"],
+			exitReason(job),
 		)
 	}
 }
 
+// exitReason describes why a finished job exited.
+func exitReason(job host.ActiveJob) string {
+	switch {
+	case job.Status == host.StatusFailed && job.Error != nil:
+		return *job.Error
+	case job.OOMKilled:
+		return fmt.Sprintf("%d (out of memory)", job.ExitStatus)
+	case job.Status == host.StatusDone || job.Status == host.StatusCrashed:
+		return strconv.Itoa(job.ExitStatus)
+	default:
+		return ""
+	}
+}
+
 func clusterJobID(job host.ActiveJob) string {
 	return job.HostID + "-" + job.Job.ID
 }
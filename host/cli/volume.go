@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/docker/docker/pkg/units"
+	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-docopt"
+	"github.com/flynn/flynn/pkg/cluster"
+)
+
+func init() {
+	Register("volume", runVolume, `
+usage: flynn-host volume list
+       flynn-host volume create HOST NAME
+       flynn-host volume delete HOST NAME
+       flynn-host volume snapshot HOST NAME
+
+Manage named persistent volumes.
+
+Commands:
+	list      list the volumes on all hosts
+	create    create a volume on a host
+	delete    delete a volume and its snapshots
+	snapshot  copy the current contents of a volume`)
+}
+
+func runVolume(args *docopt.Args, client *cluster.Client) error {
+	if args.Bool["list"] {
+		return runVolumeList(client)
+	}
+
+	h, err := client.DialHost(args.String["HOST"])
+	if err != nil {
+		return fmt.Errorf("could not dial host %s: %s", args.String["HOST"], err)
+	}
+	name := args.String["NAME"]
+	switch {
+	case args.Bool["create"]:
+		vol, err := h.CreateVolume(name)
+		if err != nil {
+			return err
+		}
+		fmt.Println(vol.Path)
+	case args.Bool["delete"]:
+		if err := h.DeleteVolume(name); err != nil {
+			return err
+		}
+		fmt.Println(name, "deleted")
+	case args.Bool["snapshot"]:
+		snapshot, err := h.CreateSnapshot(name)
+		if err != nil {
+			return err
+		}
+		fmt.Println(snapshot.ID)
+	}
+	return nil
+}
+
+func runVolumeList(client *cluster.Client) error {
+	hosts, err := client.ListHosts()
+	if err != nil {
+		return fmt.Errorf("could not list hosts: %s", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 1, 2, 2, ' ', 0)
+	defer w.Flush()
+	listRec(w, "HOST", "NAME", "CREATED", "SNAPSHOTS")
+	for _, host := range hosts {
+		h, err := client.DialHost(host.ID)
+		if err != nil {
+			return fmt.Errorf("could not dial host %s: %s", host.ID, err)
+		}
+		volumes, err := h.ListVolumes()
+		if err != nil {
+			return fmt.Errorf("could not get volumes for host %s: %s", host.ID, err)
+		}
+		for _, vol := range volumes {
+			created := units.HumanDuration(time.Now().UTC().Sub(vol.CreatedAt)) + " ago"
+			listRec(w, host.ID, vol.Name, created, len(vol.Snapshots))
+		}
+	}
+	return nil
+}
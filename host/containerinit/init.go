@@ -144,11 +144,52 @@ func (c *Client) Signal(signal int) error {
 	return err
 }
 
+// ExecConfig describes an extra process to run in a running container.
+type ExecConfig struct {
+	ID   string
+	Args []string
+	Env  map[string]string
+	TTY  bool
+}
+
+type ExecSignal struct {
+	ID     string
+	Signal int
+}
+
+// Exec starts a process in the container, returning the pty master if
+// config.TTY is set, otherwise the process stdin, stdout and stderr.
+func (c *Client) Exec(config *ExecConfig) ([]*os.File, error) {
+	var fds []fdrpc.FD
+	if err := c.c.Call("ContainerInit.Exec", config, &fds); err != nil {
+		return nil, err
+	}
+	files := make([]*os.File, len(fds))
+	for i, fd := range fds {
+		files[i] = os.NewFile(uintptr(fd.FD), "exec")
+	}
+	return files, nil
+}
+
+// WaitExec waits for the process started with the given ID to exit and
+// returns its exit status.
+func (c *Client) WaitExec(id string) (int, error) {
+	var status int
+	return status, c.c.Call("ContainerInit.WaitExec", id, &status)
+}
+
+func (c *Client) SignalExec(id string, signal int) error {
+	return c.c.Call("ContainerInit.SignalExec", &ExecSignal{ID: id, Signal: signal}, &struct{}{})
+}
+
 func newContainerInit(c *Config) *ContainerInit {
 	return &ContainerInit{
 		resume:    make(chan struct{}),
 		streams:   make(map[chan StateChange]struct{}),
 		openStdin: c.OpenStdin,
+		config:    c,
+		execs:     make(map[string]*execProcess),
+		execPIDs:  make(map[int]*execProcess),
 	}
 }
 
@@ -167,6 +208,17 @@ type ContainerInit struct {
 
 	streams    map[chan StateChange]struct{}
 	streamsMtx sync.RWMutex
+
+	config   *Config
+	execs    map[string]*execProcess
+	execPIDs map[int]*execProcess
+	execMtx  sync.Mutex
+}
+
+type execProcess struct {
+	process *os.Process
+	status  int
+	done    chan struct{}
 }
 
 func (c *ContainerInit) GetState(arg *struct{}, status *State) error {
@@ -271,6 +323,132 @@ func (c *ContainerInit) StreamState(arg struct{}, stream rpcplus.Stream) error {
 	}
 }
 
+// Exec starts a process in the container, returning the client side of its
+// stdio. The files are closed once they have been sent to the client, so that
+// the process sees EOF on stdin when the client closes it.
+func (c *ContainerInit) Exec(config *ExecConfig, files *[]*os.File) error {
+	c.mtx.Lock()
+	state := c.state
+	c.mtx.Unlock()
+	if state != StateRunning {
+		return errors.New("container is not running")
+	}
+	if len(config.Args) == 0 {
+		return errors.New("missing command")
+	}
+
+	cmdPath, err := exec.LookPath(config.Args[0])
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command(cmdPath, config.Args[1:]...)
+	cmd.Dir = c.config.WorkDir
+	env := make(map[string]string, len(c.config.Env)+len(config.Env))
+	for k, v := range c.config.Env {
+		env[k] = v
+	}
+	for k, v := range config.Env {
+		env[k] = v
+	}
+	for k, v := range env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if cmd.SysProcAttr.Credential, err = getCredential(c.config); err != nil {
+		return err
+	}
+
+	// child contains the container side of the process stdio, which is
+	// closed once the process has started
+	var child, client []*os.File
+	defer func() {
+		for _, f := range child {
+			f.Close()
+		}
+	}()
+	if config.TTY {
+		ptyMaster, ptySlave, err := pty.Open()
+		if err != nil {
+			return err
+		}
+		child, client = []*os.File{ptySlave}, []*os.File{ptyMaster}
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = ptySlave, ptySlave, ptySlave
+		cmd.SysProcAttr.Setctty = true
+	} else {
+		for i := 0; i < 3; i++ {
+			r, w, err := os.Pipe()
+			if err != nil {
+				return err
+			}
+			if i == 0 {
+				child, client = append(child, r), append(client, w)
+			} else {
+				child, client = append(child, w), append(client, r)
+			}
+		}
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = child[0], child[1], child[2]
+	}
+
+	// hold execMtx until the process is registered so that babySit does
+	// not reap it before then
+	c.execMtx.Lock()
+	defer c.execMtx.Unlock()
+	if err := cmd.Start(); err != nil {
+		for _, f := range client {
+			f.Close()
+		}
+		return err
+	}
+	e := &execProcess{process: cmd.Process, done: make(chan struct{})}
+	c.execs[config.ID] = e
+	c.execPIDs[cmd.Process.Pid] = e
+
+	*files = client
+	return nil
+}
+
+func (c *ContainerInit) WaitExec(id string, status *int) error {
+	c.execMtx.Lock()
+	e, ok := c.execs[id]
+	c.execMtx.Unlock()
+	if !ok {
+		return errors.New("unknown exec process")
+	}
+	<-e.done
+	c.execMtx.Lock()
+	delete(c.execs, id)
+	c.execMtx.Unlock()
+	*status = e.status
+	return nil
+}
+
+func (c *ContainerInit) SignalExec(sig *ExecSignal, res *struct{}) error {
+	c.execMtx.Lock()
+	e, ok := c.execs[sig.ID]
+	c.execMtx.Unlock()
+	if !ok {
+		return errors.New("unknown exec process")
+	}
+	return e.process.Signal(syscall.Signal(sig.Signal))
+}
+
+// execExited records the exit status of an exec process reaped by babySit.
+func (c *ContainerInit) execExited(pid int, wstatus syscall.WaitStatus) {
+	c.execMtx.Lock()
+	defer c.execMtx.Unlock()
+	e, ok := c.execPIDs[pid]
+	if !ok {
+		return
+	}
+	delete(c.execPIDs, pid)
+	if wstatus.Signaled() {
+		e.status = 128 + int(wstatus.Signal())
+	} else {
+		e.status = wstatus.ExitStatus()
+	}
+	close(e.done)
+}
+
 // Caller must hold lock
 func (c *ContainerInit) changeState(state State, err string, exitStatus int) {
 	c.state = state
@@ -395,7 +573,7 @@ func getCmdPath(c *Config) (string, error) {
 	return cmdPath, nil
 }
 
-func babySit(process *os.Process) int {
+func (c *ContainerInit) babySit(process *os.Process) int {
 	// Forward all signals to the app
 	sigchan := make(chan os.Signal, 1)
 	sigutil.CatchAll(sigchan)
@@ -415,6 +593,8 @@ func babySit(process *os.Process) int {
 		pid, err := syscall.Wait4(-1, &wstatus, 0, nil)
 		if err == nil && pid == process.Pid {
 			break
+		} else if err == nil {
+			c.execExited(pid, wstatus)
 		}
 	}
 
@@ -513,7 +693,7 @@ func containerInitApp(c *Config) error {
 	init.changeState(StateRunning, "", -1)
 
 	init.mtx.Unlock() // Allow calls
-	exitCode := babySit(init.process)
+	exitCode := init.babySit(init.process)
 	init.mtx.Lock()
 	init.changeState(StateExited, "", exitCode)
 
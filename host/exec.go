@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/docker/docker/pkg/term"
+	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/julienschmidt/httprouter"
+	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/technoweenie/grohl"
+	"github.com/flynn/flynn/host/types"
+)
+
+// execHandler runs extra processes in running jobs, using the same framing
+// protocol as attachHandler.
+type execHandler struct {
+	state   *State
+	backend Backend
+}
+
+func (h *execHandler) ServeHTTP(w http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+	var execReq host.ExecReq
+	if err := json.NewDecoder(req.Body).Decode(&execReq); err != nil {
+		http.Error(w, "invalid JSON", 400)
+		return
+	}
+	w.Header().Set("Connection", "upgrade")
+	w.Header().Set("Upgrade", "flynn-attach/0")
+	w.WriteHeader(http.StatusSwitchingProtocols)
+
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		return
+	}
+	h.exec(&execReq, conn)
+}
+
+func (h *execHandler) exec(req *host.ExecReq, conn io.ReadWriteCloser) {
+	defer conn.Close()
+
+	g := grohl.NewContext(grohl.Data{"fn": "exec", "job.id": req.JobID})
+	g.Log(grohl.Data{"at": "start", "cmd": req.Cmd})
+
+	w := bufio.NewWriter(conn)
+	writeError := func(err string) {
+		g.Log(grohl.Data{"at": "error", "err": err})
+		w.WriteByte(host.AttachError)
+		binary.Write(w, binary.BigEndian, uint32(len(err)))
+		w.WriteString(err)
+		w.Flush()
+	}
+
+	job := h.state.GetJob(req.JobID)
+	if job == nil {
+		writeError("unknown job")
+		return
+	}
+	if job.Status != host.StatusRunning {
+		writeError("job is not running")
+		return
+	}
+	if len(req.Cmd) == 0 {
+		writeError("missing command")
+		return
+	}
+
+	writeMtx := &sync.Mutex{}
+	opts := &ExecRequest{
+		Job:    job,
+		Cmd:    req.Cmd,
+		Env:    req.Env,
+		TTY:    req.TTY,
+		Height: req.Height,
+		Width:  req.Width,
+	}
+	var stdinW *io.PipeWriter
+	if req.Flags&host.AttachFlagStdin != 0 {
+		opts.Stdin, stdinW = io.Pipe()
+	}
+	if req.Flags&host.AttachFlagStdout != 0 {
+		opts.Stdout = newFrameWriter(1, w, writeMtx)
+	}
+	if req.Flags&host.AttachFlagStderr != 0 {
+		opts.Stderr = newFrameWriter(2, w, writeMtx)
+	}
+
+	// hold the write lock until the success byte has been written so that
+	// output frames are not written before it
+	writeMtx.Lock()
+	process, err := h.backend.Exec(opts)
+	if err != nil {
+		writeError(err.Error())
+		writeMtx.Unlock()
+		return
+	}
+	w.WriteByte(host.AttachSuccess)
+	w.Flush()
+	writeMtx.Unlock()
+
+	go func() {
+		defer func() {
+			if stdinW != nil {
+				stdinW.Close()
+			}
+		}()
+
+		r := bufio.NewReader(conn)
+		var buf [4]byte
+
+		for {
+			frameType, err := r.ReadByte()
+			if err != nil {
+				return
+			}
+			switch frameType {
+			case host.AttachData:
+				stream, err := r.ReadByte()
+				if err != nil || stream != 0 || stdinW == nil {
+					return
+				}
+				if _, err := io.ReadFull(r, buf[:]); err != nil {
+					return
+				}
+				length := int64(binary.BigEndian.Uint32(buf[:]))
+				if length == 0 {
+					stdinW.Close()
+					stdinW = nil
+					continue
+				}
+				if _, err := io.CopyN(stdinW, r, length); err != nil {
+					return
+				}
+			case host.AttachSignal:
+				if _, err := io.ReadFull(r, buf[:]); err != nil {
+					return
+				}
+				signal := int(binary.BigEndian.Uint32(buf[:]))
+				g.Log(grohl.Data{"at": "signal", "signal": signal})
+				if err := process.Signal(signal); err != nil {
+					g.Log(grohl.Data{"at": "signal", "status": "error", "err": err})
+					return
+				}
+			case host.AttachResize:
+				if !req.TTY {
+					return
+				}
+				if _, err := io.ReadFull(r, buf[:]); err != nil {
+					return
+				}
+				height := binary.BigEndian.Uint16(buf[:])
+				width := binary.BigEndian.Uint16(buf[2:])
+				g.Log(grohl.Data{"at": "tty_resize", "height": height, "width": width})
+				if err := process.ResizeTTY(height, width); err != nil {
+					g.Log(grohl.Data{"at": "tty_resize", "status": "error", "err": err})
+					return
+				}
+			default:
+				return
+			}
+		}
+	}()
+
+	status, err := process.Wait()
+	if opts.Stdout != nil {
+		opts.Stdout.Close()
+	}
+	if opts.Stderr != nil {
+		opts.Stderr.Close()
+	}
+	writeMtx.Lock()
+	defer writeMtx.Unlock()
+	if err != nil {
+		writeError(err.Error())
+		return
+	}
+	w.WriteByte(host.AttachExit)
+	binary.Write(w, binary.BigEndian, uint32(status))
+	w.Flush()
+	g.Log(grohl.Data{"at": "finish", "status": status})
+}
+
+// copyExecStreams copies the stdio of an exec process to and from req. files
+// is either the pty master of the process if req.TTY is set, or the process
+// stdin, stdout and stderr. The files are closed and the returned channel is
+// closed once all of the output has been copied.
+func copyExecStreams(req *ExecRequest, files []*os.File) (<-chan struct{}, error) {
+	done := make(chan struct{})
+	if req.TTY {
+		if len(files) != 1 {
+			return nil, errors.New("exec: expected a pty")
+		}
+		pty := files[0]
+		if err := term.SetWinsize(pty.Fd(), &term.Winsize{Height: req.Height, Width: req.Width}); err != nil {
+			pty.Close()
+			return nil, err
+		}
+		if req.Stdin != nil {
+			go io.Copy(pty, req.Stdin)
+		}
+		go func() {
+			var out io.Writer = ioutil.Discard
+			if req.Stdout != nil {
+				out = req.Stdout
+			}
+			// reading from the pty returns an error once the process
+			// has exited
+			io.Copy(out, pty)
+			pty.Close()
+			close(done)
+		}()
+		return done, nil
+	}
+
+	if len(files) != 3 {
+		return nil, errors.New("exec: expected stdin, stdout and stderr")
+	}
+	stdin := files[0]
+	if req.Stdin != nil {
+		go func() {
+			io.Copy(stdin, req.Stdin)
+			stdin.Close()
+		}()
+	} else {
+		stdin.Close()
+	}
+	var wg sync.WaitGroup
+	for i, w := range []io.Writer{req.Stdout, req.Stderr} {
+		if w == nil {
+			w = ioutil.Discard
+		}
+		wg.Add(1)
+		go func(w io.Writer, f *os.File) {
+			io.Copy(w, f)
+			f.Close()
+			wg.Done()
+		}(w, files[i+1])
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	return done, nil
+}
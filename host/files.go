@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/flynn/flynn/host/types"
+	"github.com/flynn/flynn/pkg/httphelper"
+)
+
+func (h *Host) runningJob(id string) (*host.ActiveJob, error) {
+	job := h.state.GetJob(id)
+	if job == nil || job.Status != host.StatusRunning {
+		return nil, httphelper.JSONError{Code: httphelper.ObjectNotFoundError, Message: "host: unknown job"}
+	}
+	return job, nil
+}
+
+func validateJobPath(path string) error {
+	if !filepath.IsAbs(path) {
+		return httphelper.JSONError{Code: httphelper.ValidationError, Message: "host: path must be absolute"}
+	}
+	return nil
+}
+
+// CopyFrom returns a tar archive of path inside a running job, which contains
+// path itself under its base name. The archive is created by running tar in
+// the job so that the filesystem is seen as the job sees it, including any
+// volumes. An error is returned if tar fails before writing any of the
+// archive, for example because path doesn't exist.
+func (h *Host) CopyFrom(id, path string) (io.ReadCloser, error) {
+	job, err := h.runningJob(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateJobPath(path); err != nil {
+		return nil, err
+	}
+	dir, base := filepath.Split(filepath.Clean(path))
+	if base == "" {
+		base = "."
+	}
+
+	r, w := io.Pipe()
+	stderr := &bufferCloser{}
+	proc, err := h.backend.Exec(&ExecRequest{
+		Job:    job,
+		Cmd:    []string{"tar", "-c", "-f", "-", "-C", dir, base},
+		Stdout: w,
+		Stderr: stderr,
+	})
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		w.CloseWithError(tarResult(proc, stderr))
+	}()
+
+	// wait for the start of the archive so that errors can be returned
+	// before any of the archive is sent
+	br := bufio.NewReader(r)
+	if _, err := br.Peek(1); err != nil {
+		r.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{br, r}, nil
+}
+
+// CopyTo extracts a tar archive into the directory path inside a running job.
+func (h *Host) CopyTo(id, path string, archive io.Reader) error {
+	job, err := h.runningJob(id)
+	if err != nil {
+		return err
+	}
+	if err := validateJobPath(path); err != nil {
+		return err
+	}
+	stderr := &bufferCloser{}
+	proc, err := h.backend.Exec(&ExecRequest{
+		Job:    job,
+		Cmd:    []string{"tar", "-x", "-f", "-", "-C", path},
+		Stdin:  archive,
+		Stderr: stderr,
+	})
+	if err != nil {
+		return err
+	}
+	return tarResult(proc, stderr)
+}
+
+// tarResult waits for a tar process to exit, returning its error output as a
+// validation error if it fails.
+func tarResult(proc ExecProcess, stderr *bufferCloser) error {
+	status, err := proc.Wait()
+	if err != nil {
+		return err
+	}
+	if status != 0 {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = fmt.Sprintf("exited with status %d", status)
+		}
+		return httphelper.JSONError{Code: httphelper.ValidationError, Message: "tar: " + msg}
+	}
+	return nil
+}
+
+type bufferCloser struct {
+	bytes.Buffer
+}
+
+func (b *bufferCloser) Close() error { return nil }
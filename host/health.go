@@ -0,0 +1,211 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/technoweenie/grohl"
+	"github.com/flynn/flynn/discoverd/health"
+	"github.com/flynn/flynn/host/types"
+	"github.com/flynn/flynn/pkg/stream"
+)
+
+// HealthChecker runs the health checks of running jobs, recording the results
+// in the state which sends healthy, unhealthy and recovered job events.
+type HealthChecker struct {
+	state   *State
+	backend Backend
+
+	mtx      sync.Mutex
+	monitors map[string]stream.Stream
+}
+
+func NewHealthChecker(state *State, backend Backend) *HealthChecker {
+	return &HealthChecker{state: state, backend: backend, monitors: make(map[string]stream.Stream)}
+}
+
+func (h *HealthChecker) Run() {
+	events := h.state.AddListener("all")
+
+	// jobs restored from a previous run are checked again from the start
+	for _, job := range h.state.Get() {
+		if job.Status == host.StatusRunning {
+			job := job
+			h.monitor(&job)
+		}
+	}
+
+	for event := range events {
+		switch event.Event {
+		case "start":
+			h.monitor(event.Job)
+		case "stop", "error":
+			h.mtx.Lock()
+			if s, ok := h.monitors[event.JobID]; ok {
+				s.Close()
+				delete(h.monitors, event.JobID)
+			}
+			h.mtx.Unlock()
+		}
+	}
+}
+
+func (h *HealthChecker) monitor(job *host.ActiveJob) {
+	config := job.Job.Config.HealthCheck
+	if config == nil {
+		return
+	}
+	g := grohl.NewContext(grohl.Data{"fn": "HealthChecker.monitor", "job.id": job.Job.ID})
+
+	check, err := h.newCheck(job, config)
+	if err != nil {
+		g.Log(grohl.Data{"at": "error", "err": err})
+		h.state.SetHealth(job.Job.ID, false)
+		return
+	}
+	monitorConfig := health.MonitorConfig{
+		Interval:  time.Duration(config.Interval) * time.Second,
+		Threshold: config.Threshold,
+	}
+	if config.Type == "exec" {
+		// exec checks run a process in the job, so are run less often than
+		// the default start interval of tcp and http checks
+		monitorConfig.StartInterval = execCheckStartInterval
+	}
+	ch := make(chan health.MonitorEvent)
+	s := health.Monitor(monitorConfig, check, ch)
+
+	h.mtx.Lock()
+	h.monitors[job.Job.ID] = s
+	h.mtx.Unlock()
+
+	startTimeout := host.DefaultHealthCheckStartTimeout
+	if config.StartTimeout > 0 {
+		startTimeout = time.Duration(config.StartTimeout) * time.Second
+	}
+	go func() {
+		timeout := time.After(startTimeout)
+		for {
+			select {
+			case e, ok := <-ch:
+				if !ok {
+					return
+				}
+				switch e.Status {
+				case health.MonitorStatusUp:
+					g.Log(grohl.Data{"at": "healthy"})
+					timeout = nil
+					h.state.SetHealth(job.Job.ID, true)
+				case health.MonitorStatusDown:
+					g.Log(grohl.Data{"at": "unhealthy", "err": e.Err})
+					h.state.SetHealth(job.Job.ID, false)
+				}
+			case <-timeout:
+				g.Log(grohl.Data{"at": "start_timeout"})
+				timeout = nil
+				h.state.SetHealth(job.Job.ID, false)
+			}
+		}
+	}()
+}
+
+// newCheck returns the check described by config for a job, tcp and http
+// checks connect to the job's overlay network address or to the host for jobs
+// using the host network.
+func (h *HealthChecker) newCheck(job *host.ActiveJob, config *host.HealthCheck) (health.Check, error) {
+	timeout := time.Duration(config.Timeout) * time.Second
+	if config.Type == "exec" {
+		return &execCheck{state: h.state, backend: h.backend, jobID: job.Job.ID, cmd: config.Cmd, timeout: timeout}, nil
+	}
+
+	port := config.Port
+	if port == 0 {
+		for _, p := range job.Job.Config.Ports {
+			if p.Proto == "tcp" {
+				port = p.Port
+				break
+			}
+		}
+	}
+	if port == 0 {
+		return nil, errors.New("host: health check has no port")
+	}
+	ip := job.InternalIP
+	if ip == "" {
+		ip = "127.0.0.1"
+	}
+	addr := net.JoinHostPort(ip, strconv.Itoa(port))
+
+	switch config.Type {
+	case "tcp":
+		return &health.TCPCheck{Addr: addr, Timeout: timeout}, nil
+	case "http":
+		return &health.HTTPCheck{
+			URL:        "http://" + addr + config.Path,
+			Host:       config.Host,
+			Timeout:    timeout,
+			StatusCode: config.Status,
+			MatchBytes: []byte(config.Match),
+		}, nil
+	default:
+		return nil, fmt.Errorf("host: unknown health check type %q", config.Type)
+	}
+}
+
+const (
+	defaultExecCheckTimeout = 2 * time.Second
+	execCheckStartInterval  = time.Second
+)
+
+// execCheck runs a command inside a job, passing if it exits with a zero
+// status.
+type execCheck struct {
+	state   *State
+	backend Backend
+	jobID   string
+	cmd     []string
+	timeout time.Duration
+}
+
+func (c *execCheck) Check() error {
+	job := c.state.GetJob(c.jobID)
+	if job == nil {
+		return errors.New("host: unknown job")
+	}
+	proc, err := c.backend.Exec(&ExecRequest{Job: job, Cmd: c.cmd})
+	if err != nil {
+		return err
+	}
+
+	type result struct {
+		status int
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		status, err := proc.Wait()
+		done <- result{status, err}
+	}()
+	timeout := c.timeout
+	if timeout == 0 {
+		timeout = defaultExecCheckTimeout
+	}
+	select {
+	case res := <-done:
+		if res.err != nil {
+			return res.err
+		}
+		if res.status != 0 {
+			return fmt.Errorf("healthcheck: command exited with status %d", res.status)
+		}
+		return nil
+	case <-time.After(timeout):
+		proc.Signal(int(syscall.SIGKILL))
+		return errors.New("healthcheck: command timed out")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"io"
 	"log"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -18,6 +19,7 @@ import (
 	"github.com/flynn/flynn/host/types"
 	"github.com/flynn/flynn/pkg/attempt"
 	"github.com/flynn/flynn/pkg/cluster"
+	"github.com/flynn/flynn/pkg/schedutil"
 	"github.com/flynn/flynn/pkg/shutdown"
 )
 
@@ -43,8 +45,9 @@ options:
   --id=ID                host id
   --force                kill all containers booted by flynn-host before starting
   --volpath=PATH         directory to create volumes in [default: /var/lib/flynn/host-volumes]
-  --backend=BACKEND      runner backend [default: libvirt-lxc]
-  --meta=<KEY=VAL>...    key=value pair to add as metadata
+  --backend=BACKEND      runner backend (libvirt-lxc or process) [default: libvirt-lxc]
+  --namespaces           run jobs in namespaces when using the process backend
+  --meta=<KEY=VAL>...    key=value pair to add as metadata, max_jobs=N limits the number of jobs placed on the host
   --bind=IP              bind containers to IP
   --flynn-init=PATH      path to flynn-init binary [default: /usr/bin/flynn-init]
 	`)
@@ -68,6 +71,7 @@ Commands:
   log                        Get the logs of a job
   ps                         List jobs
   stop                       Stop running jobs
+  volume                     Manage persistent volumes
   upload-debug-info          Upload debug information to an anonymous gist
 
 See 'flynn-host help <command>' for more information on a specific command.
@@ -126,6 +130,7 @@ func runDaemon(args *docopt.Args) {
 	force := args.Bool["--force"]
 	volPath := args.String["--volpath"]
 	backendName := args.String["--backend"]
+	namespaces := args.Bool["--namespaces"]
 	flynnInit := args.String["--flynn-init"]
 	metadata := args.All["--meta"].([]string)
 
@@ -159,6 +164,8 @@ func runDaemon(args *docopt.Args) {
 	switch backendName {
 	case "libvirt-lxc":
 		backend, err = NewLibvirtLXCBackend(state, volPath, "/tmp/flynn-host-logs", flynnInit)
+	case "process":
+		backend, err = NewProcessBackend(state, volPath, "/tmp/flynn-host-logs", portAlloc["tcp"], namespaces)
 	default:
 		log.Fatalf("unknown backend %q", backendName)
 	}
@@ -166,7 +173,19 @@ func runDaemon(args *docopt.Args) {
 		shutdown.Fatal(err)
 	}
 
-	router, err := serveHTTP(&Host{state: state, backend: backend}, &attachHandler{state: state, backend: backend})
+	volumes, err := NewVolumeManager(volPath, state)
+	if err != nil {
+		shutdown.Fatal(err)
+	}
+
+	logs := NewLogShipper(hostID, state, backend)
+	network := NewNetworkPolicyManager(state)
+
+	router, err := serveHTTP(
+		&Host{state: state, backend: backend, volumes: volumes, logs: logs, network: network},
+		&attachHandler{state: state, backend: backend},
+		&execHandler{state: state, backend: backend},
+	)
 	if err != nil {
 		shutdown.Fatal(err)
 	}
@@ -174,6 +193,9 @@ func runDaemon(args *docopt.Args) {
 	if err := state.Restore(backend); err != nil {
 		shutdown.Fatal(err)
 	}
+	go logs.Run()
+	go network.Run()
+	go NewHealthChecker(state, backend).Run()
 
 	shutdown.BeforeExit(func() { backend.Cleanup() })
 
@@ -189,7 +211,9 @@ func runDaemon(args *docopt.Args) {
 		bindAddr:     bindAddr,
 		backend:      backend,
 		state:        state,
+		volumes:      volumes,
 		ports:        portAlloc,
+		network:      network,
 	}
 
 	discURL := os.Getenv("DISCOVERD")
@@ -285,6 +309,11 @@ func runDaemon(args *docopt.Args) {
 		kv := strings.SplitN(s, "=", 2)
 		h.Metadata[kv[0]] = kv[1]
 	}
+	if max, ok := h.Metadata[schedutil.MetaMaxJobs]; ok {
+		if n, err := strconv.Atoi(max); err != nil || n <= 0 {
+			shutdown.Fatal(fmt.Errorf("host: %s must be a positive number of jobs, got %q", schedutil.MetaMaxJobs, max))
+		}
+	}
 
 	for {
 		newLeader := cluster.NewLeaderSignal()
@@ -309,6 +338,12 @@ func runDaemon(args *docopt.Args) {
 				job.Config.Env["EXTERNAL_IP"] = externalAddr
 				job.Config.Env["DISCOVERD"] = discURL
 			}
+			if err := volumes.ResolveMounts(job); err != nil {
+				// add the job so that the failure is reported to the scheduler
+				state.AddJob(job, "")
+				state.SetStatusFailed(job.ID, err)
+				continue
+			}
 			if err := backend.Run(job); err != nil {
 				state.SetStatusFailed(job.ID, err)
 			}
@@ -3,11 +3,14 @@ package main
 import (
 	"encoding/json"
 	"errors"
+	"io"
 	"net"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/julienschmidt/httprouter"
+	"github.com/flynn/flynn/host/logbuf"
 	"github.com/flynn/flynn/host/types"
 	"github.com/flynn/flynn/pkg/httphelper"
 	"github.com/flynn/flynn/pkg/sse"
@@ -16,6 +19,9 @@ import (
 type Host struct {
 	state   *State
 	backend Backend
+	volumes *VolumeManager
+	logs    *LogShipper
+	network *NetworkPolicyManager
 }
 
 func (h *Host) StopJob(id string) error {
@@ -34,6 +40,14 @@ func (h *Host) StopJob(id string) error {
 	}
 }
 
+func (h *Host) SetLogDrains(id string, drains []string) error {
+	if !h.state.SetLogDrains(id, drains) {
+		return httphelper.JSONError{Code: httphelper.ObjectNotFoundError, Message: "host: unknown job"}
+	}
+	h.logs.SetDrains(id, drains)
+	return nil
+}
+
 func (h *Host) streamEvents(id string, w http.ResponseWriter) error {
 	ch := h.state.AddListener(id)
 	go func() {
@@ -53,6 +67,156 @@ func (h *Host) streamEvents(id string, w http.ResponseWriter) error {
 	return nil
 }
 
+const (
+	// defaultStatsInterval is how often stats are sent to clients streaming
+	// job stats which don't specify an interval.
+	defaultStatsInterval = time.Second
+
+	// minStatsInterval is the shortest interval clients may request, as the
+	// stats are read from cgroup and /proc files each time.
+	minStatsInterval = 100 * time.Millisecond
+)
+
+func (h *Host) JobStats(id string) (*host.JobStats, error) {
+	job := h.state.GetJob(id)
+	if job == nil {
+		return nil, errors.New("host: unknown job")
+	}
+	if job.Status != host.StatusRunning {
+		return nil, errors.New("host: job is not running")
+	}
+	stats, err := h.backend.Stats(id)
+	if err != nil {
+		return nil, err
+	}
+	stats.JobID = id
+	stats.Time = time.Now().UTC()
+	return stats, nil
+}
+
+func (h *Host) streamStats(id string, interval time.Duration, w http.ResponseWriter) error {
+	stats, err := h.JobStats(id)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(sse.NewWriter(w))
+	w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+	w.WriteHeader(200)
+
+	closed := w.(http.CloseNotifier).CloseNotify()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := enc.Encode(stats); err != nil {
+			return nil
+		}
+		w.(http.Flusher).Flush()
+		select {
+		case <-closed:
+			return nil
+		case <-ticker.C:
+		}
+		// the stream ends when the job stops
+		if stats, err = h.JobStats(id); err != nil {
+			return nil
+		}
+	}
+}
+
+// streamLog streams the lines of a job log, following it for new lines after
+// sending an empty message if follow is set.
+func (h *Host) streamLog(id string, follow bool, w http.ResponseWriter) error {
+	if h.state.GetJob(id) == nil {
+		return httphelper.JSONError{Code: httphelper.ObjectNotFoundError, Message: "host: unknown job"}
+	}
+	log := h.backend.OpenLog(id)
+
+	w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+	w.WriteHeader(200)
+	w.(http.Flusher).Flush()
+	enc := json.NewEncoder(sse.NewWriter(w))
+	closed := w.(http.CloseNotifier).CloseNotify()
+
+	var sendErr error
+	send := func(msg *host.LogMessage) {
+		if sendErr != nil {
+			return
+		}
+		if sendErr = enc.Encode(msg); sendErr == nil {
+			w.(http.Flusher).Flush()
+		}
+	}
+	// the existing lines are followed by an empty message when following,
+	// which is sent from the same read as the new lines so that none are
+	// missed in between
+	read := func(follow bool) error {
+		var timestamp time.Time
+		streams := make(map[int]*lineWriter, 2)
+		for n, name := range map[int]string{1: "stdout", 2: "stderr"} {
+			name := name
+			streams[n] = newLineWriter(func(line string) {
+				send(&host.LogMessage{Stream: name, Timestamp: timestamp, Message: line})
+			})
+		}
+		defer func() {
+			for _, s := range streams {
+				s.Close()
+			}
+		}()
+
+		ch := make(chan logbuf.Data)
+		done := make(chan struct{})
+		errc := make(chan error, 1)
+		var existing chan struct{}
+		if follow {
+			existing = make(chan struct{})
+			go func() { errc <- log.ReadAll(ch, existing, done) }()
+		} else {
+			go func() { errc <- log.Read(-1, false, ch, done) }()
+		}
+		endExisting := func() {
+			send(&host.LogMessage{})
+			existing = nil
+		}
+		for {
+			select {
+			case data, ok := <-ch:
+				if !ok {
+					return <-errc
+				}
+				// existing is closed before the first new line is
+				// received
+				select {
+				case <-existing:
+					endExisting()
+				default:
+				}
+				if s, ok := streams[data.Stream]; ok {
+					timestamp = data.Timestamp.UTC()
+					s.Write([]byte(data.Message))
+				}
+				if sendErr != nil {
+					close(done)
+					for range ch {
+					}
+					return sendErr
+				}
+			case <-existing:
+				endExisting()
+			case err := <-errc:
+				return err
+			case <-closed:
+				close(done)
+				for range ch {
+				}
+				return nil
+			}
+		}
+	}
+
+	return read(follow)
+}
+
 type jobAPI struct {
 	host *Host
 }
@@ -69,6 +233,20 @@ func (h *jobAPI) ListJobs(w http.ResponseWriter, r *http.Request, ps httprouter.
 	httphelper.JSON(w, 200, res)
 }
 
+// ListJobHistory lists the jobs which have finished on the host, most
+// recently finished first.
+func (h *jobAPI) ListJobHistory(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	jobs, err := h.host.state.History()
+	if err != nil {
+		httphelper.Error(w, err)
+		return
+	}
+	if jobs == nil {
+		jobs = []host.ActiveJob{}
+	}
+	httphelper.JSON(w, 200, jobs)
+}
+
 func (h *jobAPI) GetJob(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	id := ps.ByName("id")
 
@@ -82,6 +260,42 @@ func (h *jobAPI) GetJob(w http.ResponseWriter, r *http.Request, ps httprouter.Pa
 	httphelper.JSON(w, 200, job)
 }
 
+func (h *jobAPI) GetJobStats(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	id := ps.ByName("id")
+
+	if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		interval := defaultStatsInterval
+		if s := r.FormValue("interval"); s != "" {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				http.Error(w, "invalid interval", 400)
+				return
+			}
+			if d < minStatsInterval {
+				http.Error(w, "interval must be at least "+minStatsInterval.String(), 400)
+				return
+			}
+			interval = d
+		}
+		if err := h.host.streamStats(id, interval, w); err != nil {
+			httphelper.Error(w, err)
+		}
+		return
+	}
+	stats, err := h.host.JobStats(id)
+	if err != nil {
+		httphelper.Error(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, stats)
+}
+
+func (h *jobAPI) GetJobLog(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if err := h.host.streamLog(ps.ByName("id"), r.FormValue("follow") == "true", w); err != nil {
+		httphelper.Error(w, err)
+	}
+}
+
 func (h *jobAPI) StopJob(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	id := ps.ByName("id")
 	if err := h.host.StopJob(id); err != nil {
@@ -91,14 +305,137 @@ func (h *jobAPI) StopJob(w http.ResponseWriter, r *http.Request, ps httprouter.P
 	w.WriteHeader(200)
 }
 
+func (h *jobAPI) SetLogDrains(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var drains []string
+	if err := httphelper.DecodeJSON(r, &drains); err != nil {
+		httphelper.Error(w, err)
+		return
+	}
+	if err := h.host.SetLogDrains(ps.ByName("id"), drains); err != nil {
+		httphelper.Error(w, err)
+		return
+	}
+	w.WriteHeader(200)
+}
+
+func (h *jobAPI) SetNetworkPolicies(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var policies []*host.NetworkPolicy
+	if err := httphelper.DecodeJSON(r, &policies); err != nil {
+		httphelper.Error(w, err)
+		return
+	}
+	if err := h.host.network.Set(policies); err != nil {
+		httphelper.Error(w, err)
+		return
+	}
+	w.WriteHeader(200)
+}
+
+func (h *jobAPI) CopyFromJob(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	archive, err := h.host.CopyFrom(ps.ByName("id"), r.FormValue("path"))
+	if err != nil {
+		httphelper.Error(w, err)
+		return
+	}
+	defer archive.Close()
+	w.Header().Set("Content-Type", "application/x-tar")
+	w.WriteHeader(200)
+	io.Copy(w, archive)
+}
+
+func (h *jobAPI) CopyToJob(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if err := h.host.CopyTo(ps.ByName("id"), r.FormValue("path"), r.Body); err != nil {
+		httphelper.Error(w, err)
+		return
+	}
+	w.WriteHeader(200)
+}
+
 func (h *jobAPI) RegisterRoutes(r *httprouter.Router) error {
 	r.GET("/host/jobs", h.ListJobs)
 	r.GET("/host/jobs/:id", h.GetJob)
+	r.GET("/host/history", h.ListJobHistory)
+	r.GET("/host/jobs/:id/stats", h.GetJobStats)
+	r.GET("/host/jobs/:id/log", h.GetJobLog)
+	r.PUT("/host/jobs/:id/log_drains", h.SetLogDrains)
+	r.GET("/host/jobs/:id/files", h.CopyFromJob)
+	r.PUT("/host/jobs/:id/files", h.CopyToJob)
 	r.DELETE("/host/jobs/:id", h.StopJob)
+	r.PUT("/host/network/policies", h.SetNetworkPolicies)
 	return nil
 }
 
-func serveHTTP(host *Host, attach *attachHandler) (*httprouter.Router, error) {
+type volumeAPI struct {
+	volumes *VolumeManager
+}
+
+func volumeError(w http.ResponseWriter, err error) {
+	switch err {
+	case ErrVolumeNotFound:
+		httphelper.Error(w, httphelper.JSONError{Code: httphelper.ObjectNotFoundError, Message: err.Error()})
+	case ErrVolumeExists:
+		httphelper.Error(w, httphelper.JSONError{Code: httphelper.ObjectExistsError, Message: err.Error()})
+	case ErrVolumeInUse, ErrInvalidVolume:
+		httphelper.Error(w, httphelper.JSONError{Code: httphelper.ValidationError, Message: err.Error()})
+	default:
+		httphelper.Error(w, err)
+	}
+}
+
+func (h *volumeAPI) ListVolumes(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	httphelper.JSON(w, 200, h.volumes.List())
+}
+
+func (h *volumeAPI) GetVolume(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	vol := h.volumes.Get(ps.ByName("name"))
+	if vol == nil {
+		volumeError(w, ErrVolumeNotFound)
+		return
+	}
+	httphelper.JSON(w, 200, vol)
+}
+
+func (h *volumeAPI) CreateVolume(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var req host.Volume
+	if err := httphelper.DecodeJSON(r, &req); err != nil {
+		httphelper.Error(w, err)
+		return
+	}
+	vol, err := h.volumes.Create(req.Name)
+	if err != nil {
+		volumeError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, vol)
+}
+
+func (h *volumeAPI) DeleteVolume(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	if err := h.volumes.Delete(ps.ByName("name")); err != nil {
+		volumeError(w, err)
+		return
+	}
+	w.WriteHeader(200)
+}
+
+func (h *volumeAPI) CreateSnapshot(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	snapshot, err := h.volumes.Snapshot(ps.ByName("name"))
+	if err != nil {
+		volumeError(w, err)
+		return
+	}
+	httphelper.JSON(w, 200, snapshot)
+}
+
+func (h *volumeAPI) RegisterRoutes(r *httprouter.Router) error {
+	r.GET("/host/volumes", h.ListVolumes)
+	r.POST("/host/volumes", h.CreateVolume)
+	r.GET("/host/volumes/:name", h.GetVolume)
+	r.DELETE("/host/volumes/:name", h.DeleteVolume)
+	r.POST("/host/volumes/:name/snapshots", h.CreateSnapshot)
+	return nil
+}
+
+func serveHTTP(host *Host, attach *attachHandler, exec *execHandler) (*httprouter.Router, error) {
 	l, err := net.Listen("tcp", ":1113")
 	if err != nil {
 		return nil, err
@@ -107,10 +444,14 @@ func serveHTTP(host *Host, attach *attachHandler) (*httprouter.Router, error) {
 	r := httprouter.New()
 
 	r.POST("/attach", attach.ServeHTTP)
+	r.POST("/exec", exec.ServeHTTP)
 
 	jobAPI := &jobAPI{host}
 	jobAPI.RegisterRoutes(r)
 
+	volumeAPI := &volumeAPI{host.volumes}
+	volumeAPI.RegisterRoutes(r)
+
 	go http.Serve(l, r)
 
 	return r, nil
@@ -205,7 +205,11 @@ func (l *LibvirtLXCBackend) ConfigureNetworking(strategy NetworkStrategy, job st
 		return nil, err
 	}
 
+	var overlayNet string
 	for _, line := range bytes.Split(data, []byte("\n")) {
+		if bytes.HasPrefix(line, []byte("FLANNEL_NETWORK=")) {
+			overlayNet = string(line[16:])
+		}
 		if bytes.HasPrefix(line, []byte("FLANNEL_MTU=")) {
 			l.ifaceMTU, err = strconv.Atoi(string(line[12:]))
 			if err != nil {
@@ -313,7 +317,12 @@ func (l *LibvirtLXCBackend) ConfigureNetworking(strategy NetworkStrategy, job st
 		return nil, err
 	}
 
-	return &NetworkInfo{BridgeAddr: l.bridgeAddr.String(), Nameservers: dnsConf.Servers}, nil
+	return &NetworkInfo{
+		BridgeAddr:  l.bridgeAddr.String(),
+		Nameservers: dnsConf.Servers,
+		Network:     overlayNet,
+		Subnet:      l.bridgeNet.String(),
+	}, nil
 }
 
 func (l *LibvirtLXCBackend) Run(job *host.Job) (err error) {
@@ -549,6 +558,10 @@ func (l *LibvirtLXCBackend) Run(job *host.Job) (err error) {
 	return nil
 }
 
+func (l *LibvirtLXCBackend) OpenLog(id string) *logbuf.Log {
+	return l.openLog(id)
+}
+
 func (l *LibvirtLXCBackend) openLog(id string) *logbuf.Log {
 	l.logsMtx.Lock()
 	defer l.logsMtx.Unlock()
@@ -657,6 +670,10 @@ func (c *libvirtContainer) watch(ready chan<- error) error {
 			}
 		case containerinit.StateExited:
 			g.Log(grohl.Data{"at": "exited", "status": change.ExitStatus})
+			if cgroupOOMKilled(c.cgroupDir("memory")) {
+				g.Log(grohl.Data{"at": "oom_killed"})
+				c.l.state.SetOOMKilled(c.job.ID)
+			}
 			c.Client.Resume()
 			c.l.state.SetStatusDone(c.job.ID, change.ExitStatus)
 			return nil
@@ -711,12 +728,32 @@ func (c *libvirtContainer) WaitStop(timeout time.Duration) error {
 	}
 }
 
+// Stop sends the stop signal of the job to the container, killing it if it
+// doesn't exit within the stop timeout. It doesn't wait for the container to
+// exit, so that jobs with long stop timeouts don't block the caller.
 func (c *libvirtContainer) Stop() error {
-	if err := c.Signal(int(syscall.SIGTERM)); err != nil {
+	return c.stop(false)
+}
+
+// stop stops the container like Stop, and if wait is set, returns once it has
+// exited or has been killed.
+func (c *libvirtContainer) stop(wait bool) error {
+	sig, timeout := stopConfig(c.job)
+	if err := c.Signal(sig); err != nil {
 		return err
 	}
-	if err := c.WaitStop(10 * time.Second); err != nil {
-		return c.Signal(int(syscall.SIGKILL))
+	kill := func() {
+		if err := c.WaitStop(timeout); err != nil {
+			c.Signal(int(syscall.SIGKILL))
+			if wait {
+				c.WaitStop(killTimeout)
+			}
+		}
+	}
+	if wait {
+		kill()
+	} else {
+		go kill()
 	}
 	return nil
 }
@@ -850,6 +887,89 @@ func (l *LibvirtLXCBackend) Attach(req *AttachRequest) (err error) {
 	return io.EOF
 }
 
+func (l *LibvirtLXCBackend) Exec(req *ExecRequest) (ExecProcess, error) {
+	container, err := l.getContainer(req.Job.Job.ID)
+	if err != nil {
+		return nil, err
+	}
+	id := random.String(16)
+	files, err := container.Client.Exec(&containerinit.ExecConfig{
+		ID:   id,
+		Args: req.Cmd,
+		Env:  req.Env,
+		TTY:  req.TTY,
+	})
+	if err != nil {
+		return nil, err
+	}
+	p := &libvirtExecProcess{id: id, container: container}
+	if req.TTY {
+		p.pty = files[0]
+	}
+	if p.done, err = copyExecStreams(req, files); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+type libvirtExecProcess struct {
+	id        string
+	container *libvirtContainer
+	pty       *os.File
+	done      <-chan struct{}
+}
+
+func (p *libvirtExecProcess) Signal(sig int) error {
+	return p.container.SignalExec(p.id, sig)
+}
+
+func (p *libvirtExecProcess) ResizeTTY(height, width uint16) error {
+	if p.pty == nil {
+		return errors.New("process doesn't have a TTY")
+	}
+	return term.SetWinsize(p.pty.Fd(), &term.Winsize{Height: height, Width: width})
+}
+
+func (p *libvirtExecProcess) Wait() (int, error) {
+	status, err := p.container.WaitExec(p.id)
+	if err != nil {
+		return 0, err
+	}
+	<-p.done
+	return status, nil
+}
+
+func (l *LibvirtLXCBackend) Stats(id string) (*host.JobStats, error) {
+	container, err := l.getContainer(id)
+	if err != nil {
+		return nil, err
+	}
+	stats := &host.JobStats{}
+	if err := readCgroupStats(container.cgroupDir, stats); err != nil {
+		return nil, err
+	}
+	if !container.job.Config.HostNetwork {
+		pid, err := cgroupPID(container.cgroupDir("memory"))
+		if err != nil {
+			return nil, err
+		}
+		if stats.Network, err = readNetworkStats(pid); err != nil {
+			return nil, err
+		}
+	}
+	return stats, nil
+}
+
+// cgroupDir returns the cgroup directory libvirt created for the container in
+// the given subsystem, which depends on whether the host uses systemd.
+func (c *libvirtContainer) cgroupDir(subsystem string) string {
+	dir := filepath.Join(cgroupRoot, subsystem, "machine", c.job.ID+".libvirt-lxc")
+	if _, err := os.Stat(dir); err == nil {
+		return dir
+	}
+	return filepath.Join(cgroupRoot, subsystem, "machine.slice", `machine-lxc\x2d`+c.job.ID+".scope")
+}
+
 func (l *LibvirtLXCBackend) Cleanup() error {
 	g := grohl.NewContext(grohl.Data{"backend": "libvirt-lxc", "fn": "Cleanup"})
 	l.containersMtx.Lock()
@@ -863,7 +983,12 @@ func (l *LibvirtLXCBackend) Cleanup() error {
 	for _, id := range ids {
 		go func(id string) {
 			g.Log(grohl.Data{"at": "stop", "job.id": id})
-			err := l.Stop(id)
+			// wait for the container to exit, as flynn-host may exit
+			// as soon as Cleanup returns
+			c, err := l.getContainer(id)
+			if err == nil {
+				err = c.stop(true)
+			}
 			if err != nil {
 				g.Log(grohl.Data{"at": "error", "job.id": id, "err": err.Error()})
 			}
@@ -0,0 +1,489 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/technoweenie/grohl"
+	"github.com/flynn/flynn/host/types"
+)
+
+const (
+	// logDrainBuffer is the number of messages buffered for each drain, new
+	// messages are dropped when a drain falls this far behind.
+	logDrainBuffer = 10000
+
+	// logDrainBatch is the maximum number of messages sent in one request to
+	// a HTTP drain.
+	logDrainBatch = 500
+
+	logDrainMinBackoff = time.Second
+	logDrainMaxBackoff = 30 * time.Second
+	logDrainTimeout    = 10 * time.Second
+
+	// logDrainFlushTimeout is how long a drain which is no longer used by
+	// any job keeps trying to send its queued messages.
+	logDrainFlushTimeout = time.Minute
+
+	// maxLogLine is the length at which partial lines are sent without
+	// waiting for a newline.
+	maxLogLine = 64 * 1024
+)
+
+// logMessage is a single line of job output, it is the format of the JSON
+// objects sent to HTTP drains.
+type logMessage struct {
+	Timestamp time.Time `json:"timestamp"`
+	HostID    string    `json:"host"`
+	AppID     string    `json:"app,omitempty"`
+	AppName   string    `json:"app_name,omitempty"`
+	ReleaseID string    `json:"release,omitempty"`
+	Type      string    `json:"type,omitempty"`
+	JobID     string    `json:"job"`
+	Stream    string    `json:"stream"`
+	Message   string    `json:"message"`
+}
+
+// LogShipper forwards the output of jobs to the log drains set in the job
+// config. Drains with the same URL are shared by all jobs on the host.
+type LogShipper struct {
+	hostID  string
+	state   *State
+	backend Backend
+
+	mtx    sync.Mutex
+	jobs   map[string][]*logDrain
+	drains map[string]*logDrain
+}
+
+func NewLogShipper(hostID string, state *State, backend Backend) *LogShipper {
+	return &LogShipper{
+		hostID:  hostID,
+		state:   state,
+		backend: backend,
+		jobs:    make(map[string][]*logDrain),
+		drains:  make(map[string]*logDrain),
+	}
+}
+
+// Run ships the output of running jobs and jobs as they start, it does not
+// return.
+func (s *LogShipper) Run() {
+	events := s.state.AddListener("all")
+
+	// jobs restored from a previous run only ship new output, as the
+	// existing output was shipped by the previous process
+	for _, job := range s.state.Get() {
+		if job.Status == host.StatusRunning {
+			s.ship(job.Job, false)
+		}
+	}
+
+	// jobs are unshipped once their output has been read to the end rather
+	// than when they stop, so that their last lines are not lost
+	for event := range events {
+		if event.Event == "start" {
+			s.ship(event.Job.Job, true)
+		}
+	}
+}
+
+// SetDrains changes the drains of a job, starting to ship its output if it
+// had no drains before.
+func (s *LogShipper) SetDrains(jobID string, urls []string) {
+	job := s.state.GetJob(jobID)
+	if job == nil {
+		return
+	}
+	s.mtx.Lock()
+	_, shipping := s.jobs[jobID]
+	if shipping {
+		s.releaseDrains(s.jobs[jobID])
+		s.jobs[jobID] = s.acquireDrains(urls)
+	}
+	s.mtx.Unlock()
+	if !shipping && job.Status == host.StatusRunning {
+		s.ship(job.Job, false)
+	}
+}
+
+func (s *LogShipper) ship(job *host.Job, logs bool) {
+	if len(job.LogDrains) == 0 || job.Config.TTY {
+		// the output of TTY jobs is only available to attached clients
+		return
+	}
+
+	s.mtx.Lock()
+	if _, ok := s.jobs[job.ID]; ok {
+		s.mtx.Unlock()
+		return
+	}
+	s.jobs[job.ID] = s.acquireDrains(job.LogDrains)
+	s.mtx.Unlock()
+
+	g := grohl.NewContext(grohl.Data{"fn": "ship_logs", "job.id": job.ID})
+	g.Log(grohl.Data{"at": "start", "drains": len(job.LogDrains)})
+
+	newMessage := func(stream string) func(string) {
+		return func(line string) {
+			s.send(&logMessage{
+				Timestamp: time.Now().UTC(),
+				HostID:    s.hostID,
+				AppID:     job.Metadata["flynn-controller.app"],
+				AppName:   job.Metadata["flynn-controller.app_name"],
+				ReleaseID: job.Metadata["flynn-controller.release"],
+				Type:      job.Metadata["flynn-controller.type"],
+				JobID:     job.ID,
+				Stream:    stream,
+				Message:   line,
+			})
+		}
+	}
+	stdout := newLineWriter(newMessage("stdout"))
+	stderr := newLineWriter(newMessage("stderr"))
+	go func() {
+		err := s.backend.Attach(&AttachRequest{
+			Job:    &host.ActiveJob{Job: job},
+			Logs:   logs,
+			Stream: true,
+			Stdout: stdout,
+			Stderr: stderr,
+		})
+		stdout.Close()
+		stderr.Close()
+		g.Log(grohl.Data{"at": "finish", "err": err})
+		s.unship(job.ID)
+	}()
+}
+
+func (s *LogShipper) unship(jobID string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	drains, ok := s.jobs[jobID]
+	if !ok {
+		return
+	}
+	s.releaseDrains(drains)
+	delete(s.jobs, jobID)
+}
+
+func (s *LogShipper) send(msg *logMessage) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	for _, d := range s.jobs[msg.JobID] {
+		d.Send(msg)
+	}
+}
+
+func (s *LogShipper) acquireDrains(urls []string) []*logDrain {
+	drains := make([]*logDrain, 0, len(urls))
+	for _, u := range urls {
+		d, ok := s.drains[u]
+		if !ok {
+			var err error
+			if d, err = newLogDrain(u); err != nil {
+				grohl.Log(grohl.Data{"fn": "acquire_drain", "url": u, "err": err})
+				continue
+			}
+			s.drains[u] = d
+			go d.Run()
+		}
+		d.refs++
+		drains = append(drains, d)
+	}
+	return drains
+}
+
+func (s *LogShipper) releaseDrains(drains []*logDrain) {
+	for _, d := range drains {
+		d.refs--
+		if d.refs == 0 {
+			delete(s.drains, d.url)
+			close(d.stop)
+		}
+	}
+}
+
+// drainSender delivers batches of messages to a drain.
+type drainSender interface {
+	Send(msgs []*logMessage) error
+	Close()
+}
+
+type logDrain struct {
+	url    string
+	sender drainSender
+	msgs   chan *logMessage
+	stop   chan struct{}
+
+	// refs is the number of jobs using the drain, it is protected by the
+	// LogShipper mutex
+	refs int
+}
+
+func newLogDrain(rawurl string) (*logDrain, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	d := &logDrain{
+		url:  rawurl,
+		msgs: make(chan *logMessage, logDrainBuffer),
+		stop: make(chan struct{}),
+	}
+	switch u.Scheme {
+	case "syslog+tcp", "syslog+tls":
+		d.sender = &syslogSender{addr: u.Host, tls: u.Scheme == "syslog+tls"}
+	case "http", "https":
+		d.sender = &httpSender{url: rawurl, client: &http.Client{Timeout: logDrainTimeout}}
+	default:
+		return nil, fmt.Errorf("host: unsupported log drain scheme %q", u.Scheme)
+	}
+	return d, nil
+}
+
+// Send queues a message for delivery, dropping it if the drain is too far
+// behind.
+func (d *logDrain) Send(msg *logMessage) {
+	select {
+	case d.msgs <- msg:
+	default:
+	}
+}
+
+// Run sends queued messages until the drain is stopped, it then keeps sending
+// the messages which are still queued for up to logDrainFlushTimeout.
+func (d *logDrain) Run() {
+	g := grohl.NewContext(grohl.Data{"fn": "log_drain", "url": d.url})
+	defer d.sender.Close()
+
+	// no messages are queued once the drain is stopped, as it has been
+	// released by every job
+	stop := d.stop
+	var deadline <-chan time.Time
+	stopped := func() {
+		stop = nil
+		deadline = time.After(logDrainFlushTimeout)
+	}
+
+	backoff := logDrainMinBackoff
+	for {
+		if deadline != nil && len(d.msgs) == 0 {
+			return
+		}
+		var msgs []*logMessage
+		select {
+		case msg := <-d.msgs:
+			msgs = append(msgs, msg)
+		case <-stop:
+			stopped()
+			continue
+		}
+	batch:
+		for len(msgs) < logDrainBatch {
+			select {
+			case msg := <-d.msgs:
+				msgs = append(msgs, msg)
+			default:
+				break batch
+			}
+		}
+
+		for {
+			err := d.sender.Send(msgs)
+			if err == nil {
+				backoff = logDrainMinBackoff
+				break
+			}
+			g.Log(grohl.Data{"at": "send_error", "err": err, "retry": backoff.String()})
+		wait:
+			for retry := time.After(backoff); ; {
+				select {
+				case <-retry:
+					break wait
+				case <-stop:
+					stopped()
+				case <-deadline:
+					g.Log(grohl.Data{"at": "flush_timeout", "dropped": len(msgs) + len(d.msgs)})
+					return
+				}
+			}
+			if backoff *= 2; backoff > logDrainMaxBackoff {
+				backoff = logDrainMaxBackoff
+			}
+		}
+	}
+}
+
+// syslogSender sends messages to a syslog server over TCP or TLS, using
+// RFC 5424 messages framed with octet counting as described in RFC 6587.
+type syslogSender struct {
+	addr string
+	tls  bool
+	conn net.Conn
+}
+
+func (s *syslogSender) Send(msgs []*logMessage) error {
+	if s.conn == nil {
+		dialer := &net.Dialer{Timeout: logDrainTimeout}
+		var err error
+		if s.tls {
+			s.conn, err = tls.DialWithDialer(dialer, "tcp", s.addr, nil)
+		} else {
+			s.conn, err = dialer.Dial("tcp", s.addr)
+		}
+		if err != nil {
+			s.conn = nil
+			return err
+		}
+	}
+	var buf bytes.Buffer
+	for _, msg := range msgs {
+		buf.Write(formatSyslog(msg))
+	}
+	s.conn.SetWriteDeadline(time.Now().Add(logDrainTimeout))
+	if _, err := s.conn.Write(buf.Bytes()); err != nil {
+		s.Close()
+		return err
+	}
+	return nil
+}
+
+func (s *syslogSender) Close() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+// formatSyslog returns msg as a framed RFC 5424 message. The severity is
+// informational for stdout and error for stderr, both with the user facility.
+func formatSyslog(msg *logMessage) []byte {
+	pri := 14
+	if msg.Stream == "stderr" {
+		pri = 11
+	}
+	procID := msg.JobID
+	if msg.Type != "" {
+		procID = msg.Type + "." + msg.JobID
+	}
+	line := fmt.Sprintf("<%d>1 %s %s %s %s - [flynn app=\"%s\" release=\"%s\" type=\"%s\" job=\"%s\"] %s",
+		pri,
+		msg.Timestamp.Format(time.RFC3339Nano),
+		syslogField(msg.HostID, 255),
+		syslogField(msg.AppName, 48),
+		syslogField(procID, 128),
+		escapeSDParam(msg.AppID),
+		escapeSDParam(msg.ReleaseID),
+		escapeSDParam(msg.Type),
+		escapeSDParam(msg.JobID),
+		msg.Message,
+	)
+	return []byte(fmt.Sprintf("%d %s", len(line), line))
+}
+
+// syslogField returns s as a syslog header field, which must be printable
+// ASCII without spaces and at most max characters long.
+func syslogField(s string, max int) string {
+	res := make([]byte, 0, len(s))
+	for i := 0; i < len(s) && len(res) < max; i++ {
+		if s[i] > 32 && s[i] < 127 {
+			res = append(res, s[i])
+		}
+	}
+	if len(res) == 0 {
+		return "-"
+	}
+	return string(res)
+}
+
+var sdParamEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+func escapeSDParam(s string) string {
+	return sdParamEscaper.Replace(s)
+}
+
+// httpSender posts batches of messages to a HTTP drain as a JSON array.
+type httpSender struct {
+	url    string
+	client *http.Client
+}
+
+func (s *httpSender) Send(msgs []*logMessage) error {
+	data, err := json.Marshal(msgs)
+	if err != nil {
+		return err
+	}
+	res, err := s.client.Post(s.url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("host: unexpected log drain status %d", res.StatusCode)
+	}
+	return nil
+}
+
+func (s *httpSender) Close() {}
+
+var errLineWriterClosed = errors.New("host: log writer closed")
+
+// lineWriter calls fn with each complete line written to it, without the
+// trailing newline.
+type lineWriter struct {
+	fn     func(string)
+	buf    []byte
+	mtx    sync.Mutex
+	closed bool
+}
+
+func newLineWriter(fn func(string)) *lineWriter {
+	return &lineWriter{fn: fn}
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	if w.closed {
+		return 0, errLineWriterClosed
+	}
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i == -1 {
+			break
+		}
+		w.fn(string(w.buf[:i]))
+		w.buf = w.buf[i+1:]
+	}
+	for len(w.buf) >= maxLogLine {
+		w.fn(string(w.buf[:maxLogLine]))
+		w.buf = w.buf[maxLogLine:]
+	}
+	return len(p), nil
+}
+
+// Close sends any remaining partial line.
+func (w *lineWriter) Close() error {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if len(w.buf) > 0 {
+		w.fn(string(w.buf))
+		w.buf = nil
+	}
+	return nil
+}
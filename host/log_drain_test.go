@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-check"
+)
+
+func (S) TestFormatSyslog(c *C) {
+	msg := &logMessage{
+		Timestamp: time.Date(2015, 4, 1, 12, 30, 0, 5000, time.UTC),
+		HostID:    "host1",
+		AppID:     "app-id",
+		AppName:   "my app",
+		ReleaseID: `release"]\`,
+		Type:      "web",
+		JobID:     "job1",
+		Stream:    "stdout",
+		Message:   "hello world",
+	}
+	line := `<14>1 2015-04-01T12:30:00.000005Z host1 myapp web.job1 - [flynn app="app-id" release="release\"\]\\" type="web" job="job1"] hello world`
+	c.Assert(string(formatSyslog(msg)), Equals, "135 "+line)
+	c.Assert(len(line), Equals, 135)
+
+	msg.Stream = "stderr"
+	msg.AppName = ""
+	msg.Type = ""
+	c.Assert(strings.HasPrefix(string(formatSyslog(msg)), "124 <11>1 2015-04-01T12:30:00.000005Z host1 - job1 - "), Equals, true)
+}
+
+func (S) TestLineWriter(c *C) {
+	var lines []string
+	w := newLineWriter(func(line string) { lines = append(lines, line) })
+
+	w.Write([]byte("foo\nba"))
+	c.Assert(lines, DeepEquals, []string{"foo"})
+	w.Write([]byte("r\n\nbaz"))
+	c.Assert(lines, DeepEquals, []string{"foo", "bar", ""})
+
+	// partial lines are sent on close, and writes fail after closing
+	c.Assert(w.Close(), IsNil)
+	c.Assert(lines, DeepEquals, []string{"foo", "bar", "", "baz"})
+	_, err := w.Write([]byte("qux\n"))
+	c.Assert(err, Equals, errLineWriterClosed)
+
+	// long lines are split
+	lines = nil
+	w = newLineWriter(func(line string) { lines = append(lines, line) })
+	w.Write([]byte(strings.Repeat("a", maxLogLine+1)))
+	c.Assert(lines, HasLen, 1)
+	c.Assert(lines[0], HasLen, maxLogLine)
+}
+
+type fakeDrainSender struct {
+	mtx   sync.Mutex
+	fails int
+	msgs  []*logMessage
+}
+
+func (s *fakeDrainSender) Send(msgs []*logMessage) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.fails > 0 {
+		s.fails--
+		return errors.New("drain down")
+	}
+	s.msgs = append(s.msgs, msgs...)
+	return nil
+}
+
+func (s *fakeDrainSender) Close() {}
+
+func (S) TestLogDrainFlush(c *C) {
+	sender := &fakeDrainSender{fails: 1}
+	d := &logDrain{
+		url:    "fake://",
+		sender: sender,
+		msgs:   make(chan *logMessage, logDrainBuffer),
+		stop:   make(chan struct{}),
+	}
+	done := make(chan struct{})
+	go func() {
+		d.Run()
+		close(done)
+	}()
+
+	// messages queued while the drain is down are sent after it is stopped
+	for _, line := range []string{"foo", "bar"} {
+		d.Send(&logMessage{JobID: "job1", Message: line})
+	}
+	close(d.stop)
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		c.Fatal("timed out waiting for drain to stop")
+	}
+	c.Assert(sender.msgs, HasLen, 2)
+	c.Assert(sender.msgs[0].Message, Equals, "foo")
+	c.Assert(sender.msgs[1].Message, Equals, "bar")
+}
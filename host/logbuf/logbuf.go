@@ -89,8 +89,30 @@ func (l *Log) Write(data Data) error {
 
 // Read old log lines from a logfile.
 func (l *Log) Read(lines int, follow bool, ch chan Data, done chan struct{}) error {
+	return l.read(lines, follow, ch, nil, done)
+}
+
+// ReadAll sends all lines of a logfile and then follows new lines, closing
+// existing once the lines written before it was called have been sent and
+// before any later line is sent.
+func (l *Log) ReadAll(ch chan Data, existing chan struct{}, done chan struct{}) error {
+	return l.read(-1, true, ch, existing, done)
+}
+
+func (l *Log) read(lines int, follow bool, ch chan Data, existing chan struct{}, done chan struct{}) error {
 	name := l.l.Filename
 
+	// the size of the current file is the offset at which the existing
+	// lines end
+	var size int64
+	if existing != nil {
+		info, err := os.Stat(name)
+		if err != nil {
+			return err
+		}
+		size = info.Size()
+	}
+
 	var seek int64
 	if lines == 0 {
 		f, err := os.Open(name)
@@ -145,6 +167,11 @@ func (l *Log) Read(lines int, follow bool, ch chan Data, done chan struct{}) err
 		return err
 	}
 	defer t.Stop()
+	var offset int64
+	if existing != nil && size == 0 {
+		close(existing)
+		existing = nil
+	}
 	closed := l.closed
 outer:
 	for {
@@ -158,6 +185,14 @@ outer:
 				return err
 			}
 			ch <- data
+			if existing != nil {
+				// lines are written with a trailing newline
+				offset += int64(len(line.Text)) + 1
+				if offset >= size {
+					close(existing)
+					existing = nil
+				}
+			}
 		case <-done:
 			break outer
 		case <-closed:
@@ -154,3 +154,45 @@ func (s *S) TestClose(c *C) {
 		c.Error("timed out")
 	}
 }
+
+func (s *S) TestReadAll(c *C) {
+	l := NewLog(&lumberjack.Logger{})
+	defer l.Close()
+	for _, msg := range []string{"1", "2"} {
+		c.Assert(l.Write(Data{Stream: 1, Timestamp: UnixTime{time.Now()}, Message: msg}), IsNil)
+	}
+	l.l.Rotate()
+	c.Assert(l.Write(Data{Stream: 1, Timestamp: UnixTime{time.Now()}, Message: "3"}), IsNil)
+
+	ch := make(chan Data)
+	existing := make(chan struct{})
+	done := make(chan struct{})
+	defer close(done)
+	go l.ReadAll(ch, existing, done)
+
+	read := func(expected string) {
+		select {
+		case data := <-ch:
+			c.Assert(data.Message, Equals, expected)
+		case <-time.After(time.Second):
+			c.Fatal("timed out")
+		}
+	}
+	for _, msg := range []string{"1", "2", "3"} {
+		select {
+		case <-existing:
+			c.Fatal("existing closed before the existing lines were read")
+		default:
+		}
+		read(msg)
+	}
+	select {
+	case <-existing:
+	case <-time.After(time.Second):
+		c.Fatal("timed out waiting for existing to be closed")
+	}
+
+	// lines written later are followed
+	c.Assert(l.Write(Data{Stream: 1, Timestamp: UnixTime{time.Now()}, Message: "4"}), IsNil)
+	read("4")
+}
@@ -78,7 +78,9 @@ type manifestRunner struct {
 	bindAddr     string
 	backend      Backend
 	state        *State
+	volumes      *VolumeManager
 	ports        map[string]*ports.Allocator
+	network      *NetworkPolicyManager
 }
 
 type manifestService struct {
@@ -233,6 +235,9 @@ func (m *manifestRunner) runManifest(r io.Reader) (map[string]*ManifestData, err
 			job.Config.Ports = []host.Port{{Proto: "tcp"}}
 		}
 
+		if err := m.volumes.ResolveMounts(job); err != nil {
+			return nil, err
+		}
 		if err := m.backend.Run(job); err != nil {
 			return nil, err
 		}
@@ -249,6 +254,11 @@ func (m *manifestRunner) runManifest(r io.Reader) (map[string]*ManifestData, err
 				return nil, err
 			}
 			netInfo = *ni
+			if ni.Network != "" {
+				if err := m.network.Configure(ni.Network, ni.Subnet); err != nil {
+					return nil, err
+				}
+			}
 		}
 	}
 
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"sort"
+	"sync"
+
+	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/technoweenie/grohl"
+	"github.com/flynn/flynn/host/types"
+	"github.com/flynn/flynn/pkg/httphelper"
+	"github.com/flynn/flynn/pkg/iptables"
+)
+
+// networkPolicyChain is the iptables chain which enforces network policies,
+// all traffic forwarded to the container bridge passes through it.
+const networkPolicyChain = "FLYNN-ISOLATION"
+
+// NetworkPolicyManager isolates the containers of apps with a network policy
+// so they only accept new connections from the allowed addresses, from hosts
+// and from outside the overlay network. The rules are rebuilt whenever the
+// policies change or a job starts or stops.
+type NetworkPolicyManager struct {
+	state *State
+
+	mtx      sync.Mutex
+	policies map[string]*host.NetworkPolicy
+
+	// network is the overlay network and hosts matches the addresses hosts
+	// use on it, both are unset until networking is configured
+	network *net.IPNet
+	hosts   string
+}
+
+func NewNetworkPolicyManager(state *State) *NetworkPolicyManager {
+	return &NetworkPolicyManager{state: state, policies: make(map[string]*host.NetworkPolicy)}
+}
+
+// Configure sets up the policy chain for the overlay network and the subnet
+// of this host, after which policies are enforced. Hosts use the first two
+// addresses of their subnets (the overlay interface and the bridge), which
+// is the same for all subnets as they are the same size.
+func (m *NetworkPolicyManager) Configure(network, subnet string) error {
+	_, n, err := net.ParseCIDR(network)
+	if err != nil {
+		return err
+	}
+	_, s, err := net.ParseCIDR(subnet)
+	if err != nil {
+		return err
+	}
+	n.IP = n.IP.To4()
+	if n.IP == nil || len(s.Mask) != len(n.Mask) {
+		return fmt.Errorf("host: network policies require an IPv4 network, got %s", network)
+	}
+
+	// bridged traffic between containers on this host only passes through
+	// iptables if the bridge netfilter module is enabled
+	ioutil.WriteFile("/proc/sys/net/bridge/bridge-nf-call-iptables", []byte("1"), 0644)
+
+	if _, err := iptables.Raw("-n", "-L", networkPolicyChain); err != nil {
+		if _, err := iptables.Raw("-N", networkPolicyChain); err != nil {
+			return err
+		}
+	}
+	jump := []string{"FORWARD", "-o", bridgeName, "-j", networkPolicyChain}
+	if !iptables.Exists(jump...) {
+		if output, err := iptables.Raw(append([]string{"-I"}, jump...)...); err != nil {
+			return err
+		} else if len(output) != 0 {
+			return &iptables.ChainError{Chain: "FORWARD", Output: output}
+		}
+	}
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.network = n
+	m.hosts = hostAddrs(n, s)
+	return m.apply()
+}
+
+// hostAddrs returns an iptables address matching the first two addresses of
+// every subnet of network.
+func hostAddrs(network, subnet *net.IPNet) string {
+	mask := make(net.IP, len(network.Mask))
+	for i := range mask {
+		mask[i] = network.Mask[i] | ^subnet.Mask[i]
+	}
+	mask[len(mask)-1] &^= 1
+	return fmt.Sprintf("%s/%s", network.IP, mask)
+}
+
+// Set replaces the policies of all isolated apps.
+func (m *NetworkPolicyManager) Set(policies []*host.NetworkPolicy) error {
+	if err := validateNetworkPolicies(policies); err != nil {
+		return err
+	}
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.policies = make(map[string]*host.NetworkPolicy, len(policies))
+	for _, p := range policies {
+		m.policies[p.AppID] = p
+	}
+	return m.apply()
+}
+
+// validateNetworkPolicies checks that the allowed addresses are IPv4
+// addresses or CIDR blocks, as they are written into the iptables rules.
+func validateNetworkPolicies(policies []*host.NetworkPolicy) error {
+	for _, p := range policies {
+		if p == nil {
+			return httphelper.JSONError{Code: httphelper.ValidationError, Message: "host: network policy must not be null"}
+		}
+		for _, addr := range p.AllowedIPs {
+			ip := net.ParseIP(addr)
+			if ip == nil {
+				ip, _, _ = net.ParseCIDR(addr)
+			}
+			if ip == nil || ip.To4() == nil {
+				return httphelper.JSONError{
+					Code:    httphelper.ValidationError,
+					Message: fmt.Sprintf("host: invalid allowed IP %q for app %s", addr, p.AppID),
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Run rebuilds the rules as jobs are created and stop.
+func (m *NetworkPolicyManager) Run() {
+	g := grohl.NewContext(grohl.Data{"fn": "NetworkPolicyManager.Run"})
+	for event := range m.state.AddListener("all") {
+		switch event.Event {
+		case "create", "stop", "error":
+		default:
+			continue
+		}
+		m.mtx.Lock()
+		if err := m.apply(); err != nil {
+			g.Log(grohl.Data{"at": "error", "job.id": event.JobID, "err": err})
+		}
+		m.mtx.Unlock()
+	}
+}
+
+func (m *NetworkPolicyManager) apply() error {
+	if m.network == nil {
+		return nil
+	}
+	return iptables.ReplaceChain(networkPolicyChain, networkPolicyRules(m.network, m.hosts, m.policies, m.state.Get()))
+}
+
+// networkPolicyRules returns the rules of the policy chain. Replies to
+// existing connections are always allowed, then for each local job of an
+// isolated app new connections from the allowed addresses and from hosts are
+// allowed and those from the rest of the overlay network are dropped.
+func networkPolicyRules(network *net.IPNet, hosts string, policies map[string]*host.NetworkPolicy, jobs map[string]host.ActiveJob) [][]string {
+	rules := [][]string{{"-m", "conntrack", "--ctstate", "RELATED,ESTABLISHED", "-j", "RETURN"}}
+
+	ids := make([]string, 0, len(jobs))
+	for id := range jobs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		job := jobs[id]
+		if job.InternalIP == "" || job.Status != host.StatusStarting && job.Status != host.StatusRunning {
+			continue
+		}
+		policy, ok := policies[job.Job.Metadata["flynn-controller.app"]]
+		if !ok {
+			continue
+		}
+		rules = append(rules, []string{"-d", job.InternalIP, "-s", hosts, "-j", "RETURN"})
+		for _, ip := range policy.AllowedIPs {
+			rules = append(rules, []string{"-d", job.InternalIP, "-s", ip, "-j", "RETURN"})
+		}
+		rules = append(rules, []string{"-d", job.InternalIP, "-s", network.String(), "-j", "DROP"})
+	}
+	return rules
+}
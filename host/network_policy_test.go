@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net"
+
+	. "github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-check"
+	"github.com/flynn/flynn/host/types"
+	"github.com/flynn/flynn/pkg/httphelper"
+)
+
+func (S) TestHostAddrs(c *C) {
+	_, network, _ := net.ParseCIDR("100.100.0.0/16")
+	_, subnet, _ := net.ParseCIDR("100.100.42.0/24")
+	c.Assert(hostAddrs(network, subnet), Equals, "100.100.0.0/255.255.0.254")
+}
+
+func (S) TestNetworkPolicyRules(c *C) {
+	_, network, _ := net.ParseCIDR("100.100.0.0/16")
+	hosts := "100.100.0.0/255.255.0.254"
+	job := func(appID, ip string, status host.JobStatus) host.ActiveJob {
+		return host.ActiveJob{
+			Job:        &host.Job{Metadata: map[string]string{"flynn-controller.app": appID}},
+			InternalIP: ip,
+			Status:     status,
+		}
+	}
+	jobs := map[string]host.ActiveJob{
+		"a": job("db", "100.100.1.2", host.StatusRunning),
+		"b": job("db", "100.100.1.3", host.StatusDone),
+		"c": job("web", "100.100.1.4", host.StatusRunning),
+		"d": job("db", "", host.StatusRunning),
+	}
+	policies := map[string]*host.NetworkPolicy{
+		"db": {AppID: "db", AllowedIPs: []string{"100.100.1.4", "100.100.2.2"}},
+	}
+
+	c.Assert(networkPolicyRules(network, hosts, policies, jobs), DeepEquals, [][]string{
+		{"-m", "conntrack", "--ctstate", "RELATED,ESTABLISHED", "-j", "RETURN"},
+		{"-d", "100.100.1.2", "-s", hosts, "-j", "RETURN"},
+		{"-d", "100.100.1.2", "-s", "100.100.1.4", "-j", "RETURN"},
+		{"-d", "100.100.1.2", "-s", "100.100.2.2", "-j", "RETURN"},
+		{"-d", "100.100.1.2", "-s", "100.100.0.0/16", "-j", "DROP"},
+	})
+
+	// jobs of apps without a policy are not restricted
+	c.Assert(networkPolicyRules(network, hosts, nil, jobs), HasLen, 1)
+}
+
+func (S) TestValidateNetworkPolicies(c *C) {
+	valid := []*host.NetworkPolicy{
+		{AppID: "db", AllowedIPs: []string{"100.100.1.4", "100.100.2.0/24"}},
+		{AppID: "web"},
+	}
+	c.Assert(validateNetworkPolicies(valid), IsNil)
+
+	for _, addr := range []string{
+		"",
+		"100.100.1.4 -j ACCEPT",
+		"100.100.1.4\n-A FORWARD -j ACCEPT",
+		"100.100.2.0/33",
+		"fd00::1",
+		"example.com",
+	} {
+		err := validateNetworkPolicies([]*host.NetworkPolicy{{AppID: "db", AllowedIPs: []string{addr}}})
+		c.Assert(err, NotNil, Commentf("addr = %q", addr))
+		c.Assert(err.(httphelper.JSONError).Code, Equals, httphelper.ValidationError)
+	}
+	c.Assert(validateNetworkPolicies([]*host.NetworkPolicy{nil}), NotNil)
+}
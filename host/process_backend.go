@@ -0,0 +1,904 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/docker/docker/pkg/term"
+	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/kr/pty"
+	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/miekg/dns"
+	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/natefinch/lumberjack"
+	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/technoweenie/grohl"
+	"github.com/flynn/flynn/host/logbuf"
+	"github.com/flynn/flynn/host/ports"
+	"github.com/flynn/flynn/host/types"
+	"github.com/flynn/flynn/pkg/cluster"
+)
+
+// NewProcessBackend returns a Backend which runs jobs as child processes of
+// flynn-host rather than in containers, which is useful for development and
+// testing as it does not require libvirt, flannel or root.
+//
+// Jobs with a file artifact (e.g. file:///var/lib/rootfs/redis) use the
+// referenced directory as their root, all other jobs run against the host
+// filesystem. If namespaces is true, jobs are run in new mount, PID, IPC and
+// UTS namespaces (and a user namespace if flynn-host is not running as root)
+// and are chrooted into their root directory.
+//
+// All jobs share the host network, so ports are allocated from portAlloc.
+func NewProcessBackend(state *State, volPath, logPath string, portAlloc *ports.Allocator, namespaces bool) (Backend, error) {
+	if err := os.MkdirAll(logPath, 0755); err != nil {
+		return nil, err
+	}
+	return &ProcessBackend{
+		LogPath:    logPath,
+		VolPath:    volPath,
+		Namespaces: namespaces,
+		state:      state,
+		ports:      portAlloc,
+		logs:       make(map[string]*logbuf.Log),
+		processes:  make(map[string]*process),
+	}, nil
+}
+
+type ProcessBackend struct {
+	LogPath    string
+	VolPath    string
+	Namespaces bool
+	state      *State
+	ports      *ports.Allocator
+
+	logsMtx sync.Mutex
+	logs    map[string]*logbuf.Log
+
+	processesMtx sync.RWMutex
+	processes    map[string]*process
+}
+
+type process struct {
+	PID      int    `json:"pid"`
+	RootPath string `json:"root_path,omitempty"`
+
+	// Ports are the ports allocated to the job by the backend, they are
+	// released when the job exits
+	Ports []uint16 `json:"ports,omitempty"`
+
+	job   *host.Job
+	b     *ProcessBackend
+	cmd   *exec.Cmd // nil if the process was started by a previous flynn-host
+	pty   *os.File
+	stdin io.WriteCloser
+	done  chan struct{}
+
+	// stopLogs is closed once the process has exited to stop following its
+	// output, logsDone is done once all of the output is in the job log
+	stopLogs chan struct{}
+	logsDone sync.WaitGroup
+
+	// childFiles are the files passed to the process which are closed in
+	// flynn-host once it has started
+	childFiles []*os.File
+}
+
+// ConfigureNetworking does not set up any networking as jobs run in the host
+// network namespace, it just returns the loopback address and the host
+// nameservers.
+func (b *ProcessBackend) ConfigureNetworking(strategy NetworkStrategy, job string) (*NetworkInfo, error) {
+	dnsConf, err := dns.ClientConfigFromFile("/etc/resolv.conf")
+	if err != nil {
+		return nil, err
+	}
+	return &NetworkInfo{BridgeAddr: "127.0.0.1", Nameservers: dnsConf.Servers}, nil
+}
+
+func (b *ProcessBackend) Run(job *host.Job) (err error) {
+	g := grohl.NewContext(grohl.Data{"backend": "process", "fn": "run", "job.id": job.ID})
+	g.Log(grohl.Data{"at": "start", "job.artifact.uri": job.Artifact.URI, "job.cmd": job.Config.Cmd})
+
+	p := &process{
+		b:        b,
+		job:      job,
+		done:     make(chan struct{}),
+		RootPath: artifactRootPath(job.Artifact),
+	}
+	defer func() {
+		if err != nil {
+			p.cleanup()
+		}
+	}()
+
+	args := append(append([]string{}, job.Config.Entrypoint...), job.Config.Cmd...)
+	if len(args) == 0 {
+		return errors.New("process: job has no command")
+	}
+
+	if job.Config.Env == nil {
+		job.Config.Env = make(map[string]string)
+	}
+	for i, port := range job.Config.Ports {
+		if port.Proto != "tcp" && port.Proto != "udp" {
+			return fmt.Errorf("unknown port proto %q", port.Proto)
+		}
+		if port.Port == 0 {
+			n, err := b.ports.Get()
+			if err != nil {
+				g.Log(grohl.Data{"at": "allocate_port", "status": "error", "err": err})
+				return err
+			}
+			p.Ports = append(p.Ports, n)
+			job.Config.Ports[i].Port = int(n)
+		}
+		if i == 0 {
+			job.Config.Env["PORT"] = strconv.Itoa(job.Config.Ports[i].Port)
+		}
+		job.Config.Env[fmt.Sprintf("PORT_%d", i)] = strconv.Itoa(job.Config.Ports[i].Port)
+	}
+
+	if len(job.Config.Mounts) > 0 && p.RootPath == "" {
+		return errors.New("process: mounts are only supported for jobs with a file artifact")
+	}
+	for i, m := range job.Config.Mounts {
+		if m.Target == "" {
+			m.Target = filepath.Join(b.VolPath, cluster.RandomJobID(""))
+			job.Config.Mounts[i].Target = m.Target
+			if err := os.MkdirAll(m.Target, 0755); err != nil {
+				g.Log(grohl.Data{"at": "mkdir_vol", "dir": m.Target, "status": "error", "err": err})
+				return err
+			}
+		}
+		if err := bindMount(m.Target, filepath.Join(p.RootPath, m.Location), m.Writeable, true); err != nil {
+			g.Log(grohl.Data{"at": "mount", "target": m.Target, "location": m.Location, "status": "error", "err": err})
+			return err
+		}
+	}
+
+	cmd, err := p.command(args, nil)
+	if err != nil {
+		g.Log(grohl.Data{"at": "lookup_cmd", "status": "error", "err": err})
+		return err
+	}
+	if b.Namespaces {
+		cmd.SysProcAttr.Cloneflags = syscall.CLONE_NEWNS | syscall.CLONE_NEWPID | syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS
+		if uid := os.Getuid(); uid != 0 {
+			cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWUSER
+			cmd.SysProcAttr.UidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: uid, Size: 1}}
+			cmd.SysProcAttr.GidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}}
+		}
+	}
+	if job.Config.TTY {
+		var tty *os.File
+		p.pty, tty, err = pty.Open()
+		if err != nil {
+			g.Log(grohl.Data{"at": "open_pty", "status": "error", "err": err})
+			return err
+		}
+		p.childFiles = append(p.childFiles, tty)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = tty, tty, tty
+		cmd.SysProcAttr.Setsid = true
+		cmd.SysProcAttr.Setctty = true
+	} else {
+		// write output to files rather than pipes so that the job keeps
+		// running if flynn-host is restarted
+		stdout, stderr, err := b.openOutput(job.ID, os.O_CREATE|os.O_TRUNC|os.O_WRONLY)
+		if err != nil {
+			g.Log(grohl.Data{"at": "open_output", "status": "error", "err": err})
+			return err
+		}
+		p.childFiles = append(p.childFiles, stdout, stderr)
+		cmd.Stdout, cmd.Stderr = stdout, stderr
+		if job.Config.Stdin {
+			if p.stdin, err = cmd.StdinPipe(); err != nil {
+				return err
+			}
+		}
+		// put the job in its own process group so that it does not
+		// receive signals sent to flynn-host from the terminal
+		cmd.SysProcAttr.Setpgid = true
+	}
+	p.cmd = cmd
+
+	b.processesMtx.Lock()
+	b.processes[job.ID] = p
+	b.processesMtx.Unlock()
+
+	ip := job.Config.Env["EXTERNAL_IP"]
+	if ip == "" {
+		ip = "127.0.0.1"
+	}
+	b.state.AddJob(job, ip)
+
+	go p.run()
+
+	g.Log(grohl.Data{"at": "finish"})
+	return nil
+}
+
+// command returns a command which runs args with the environment, root and
+// working directory of the job, with extraEnv added to the environment.
+func (p *process) command(args []string, extraEnv map[string]string) (*exec.Cmd, error) {
+	job := p.job
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Env = p.environ(extraEnv)
+	cmd.SysProcAttr = &syscall.SysProcAttr{}
+	if p.b.Namespaces && p.RootPath != "" {
+		// exec.Command looks up the command on the host PATH, but it
+		// needs to be looked up in the root of the job
+		path, err := lookPathIn(p.RootPath, args[0], p.jobPath(extraEnv))
+		if err != nil {
+			return nil, err
+		}
+		cmd.Path = path
+		cmd.SysProcAttr.Chroot = p.RootPath
+		cmd.Dir = job.Config.WorkingDir
+		if cmd.Dir == "" {
+			cmd.Dir = "/"
+		}
+	} else {
+		cmd.Dir = filepath.Join(p.RootPath, job.Config.WorkingDir)
+	}
+	if job.Config.Uid > 0 && os.Getuid() == 0 && !p.b.Namespaces {
+		cmd.SysProcAttr.Credential = &syscall.Credential{Uid: uint32(job.Config.Uid)}
+	}
+	return cmd, nil
+}
+
+// environ returns the environment of the job with extraEnv added.
+func (p *process) environ(extraEnv map[string]string) []string {
+	env := map[string]string{
+		"PATH": "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin",
+		"TERM": "xterm",
+		"HOME": "/",
+	}
+	for k, v := range p.job.Config.Env {
+		env[k] = v
+	}
+	env["HOSTNAME"] = p.job.ID
+	for k, v := range extraEnv {
+		env[k] = v
+	}
+	res := make([]string, 0, len(env))
+	for k, v := range env {
+		res = append(res, k+"="+v)
+	}
+	return res
+}
+
+// jobPath returns the PATH used to look up commands run in the job.
+func (p *process) jobPath(extraEnv map[string]string) string {
+	if path, ok := extraEnv["PATH"]; ok {
+		return path
+	}
+	if path, ok := p.job.Config.Env["PATH"]; ok {
+		return path
+	}
+	return "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+}
+
+// artifactRootPath returns the directory referenced by a file artifact, or an
+// empty string if the job should run against the host filesystem.
+func artifactRootPath(artifact host.Artifact) string {
+	if artifact.Type != "file" && !strings.HasPrefix(artifact.URI, "file://") {
+		return ""
+	}
+	return strings.TrimPrefix(artifact.URI, "file://")
+}
+
+// lookPathIn returns the path of the executable name relative to root,
+// searching the directories in path if name does not contain a slash.
+func lookPathIn(root, name, path string) (string, error) {
+	if strings.Contains(name, "/") {
+		return name, nil
+	}
+	for _, dir := range filepath.SplitList(path) {
+		p := filepath.Join(dir, name)
+		if info, err := os.Stat(filepath.Join(root, p)); err == nil && !info.IsDir() && info.Mode()&0111 != 0 {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("process: executable %q not found in %s", name, root)
+}
+
+func (b *ProcessBackend) openOutput(id string, flag int) (stdout, stderr *os.File, err error) {
+	dir := filepath.Join(b.LogPath, id)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, nil, err
+	}
+	stdout, err = os.OpenFile(filepath.Join(dir, "stdout"), flag, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+	stderr, err = os.OpenFile(filepath.Join(dir, "stderr"), flag, 0644)
+	if err != nil {
+		stdout.Close()
+		return nil, nil, err
+	}
+	return stdout, stderr, nil
+}
+
+func (b *ProcessBackend) OpenLog(id string) *logbuf.Log {
+	return b.openLog(id)
+}
+
+func (b *ProcessBackend) openLog(id string) *logbuf.Log {
+	b.logsMtx.Lock()
+	defer b.logsMtx.Unlock()
+	if _, ok := b.logs[id]; !ok {
+		// TODO: configure retention and log size
+		b.logs[id] = logbuf.NewLog(&lumberjack.Logger{Filename: filepath.Join(b.LogPath, id, id+".log")})
+	}
+	// TODO: do reference counting and remove logs that are not in use from memory
+	return b.logs[id]
+}
+
+// run starts the process once any attach requests have been handled and then
+// waits for it to exit.
+func (p *process) run() {
+	g := grohl.NewContext(grohl.Data{"backend": "process", "fn": "run_process", "job.id": p.job.ID})
+
+	g.Log(grohl.Data{"at": "wait_attach"})
+	p.b.state.WaitAttach(p.job.ID)
+
+	g.Log(grohl.Data{"at": "start"})
+	err := p.cmd.Start()
+	p.closeChildFiles()
+	if err != nil {
+		g.Log(grohl.Data{"at": "start", "status": "error", "err": err})
+		p.b.state.SetStatusFailed(p.job.ID, err)
+		p.exit()
+		return
+	}
+	p.PID = p.cmd.Process.Pid
+	p.b.state.SetContainerID(p.job.ID, strconv.Itoa(p.PID))
+	p.followLogs(os.SEEK_SET)
+
+	g.Log(grohl.Data{"at": "running", "pid": p.PID})
+	p.b.state.SetStatusRunning(p.job.ID)
+
+	// if the job was stopped before it started, exit
+	if p.b.state.GetJob(p.job.ID).ForceStop {
+		go p.Stop()
+	}
+
+	// the status is set before exiting so that it is known to attached
+	// clients waiting for the process to exit
+	status, err := exitStatus(p.cmd.Wait())
+	if err != nil {
+		g.Log(grohl.Data{"at": "wait", "status": "error", "err": err})
+		p.b.state.SetStatusFailed(p.job.ID, err)
+		p.exit()
+		return
+	}
+	g.Log(grohl.Data{"at": "exited", "status": status})
+	p.b.state.SetStatusDone(p.job.ID, status)
+	p.exit()
+}
+
+// watch polls a process started by a previous flynn-host until it exits. The
+// exit status of such processes is unknown as they are not children of this
+// flynn-host, so they are marked as failed.
+func (p *process) watch() {
+	g := grohl.NewContext(grohl.Data{"backend": "process", "fn": "watch_process", "job.id": p.job.ID, "pid": p.PID})
+	g.Log(grohl.Data{"at": "start"})
+	for p.alive() {
+		time.Sleep(time.Second)
+	}
+	g.Log(grohl.Data{"at": "exited"})
+	p.b.state.SetStatusFailed(p.job.ID, errors.New("process exited while flynn-host was restarting"))
+	p.exit()
+}
+
+func (p *process) alive() bool {
+	return syscall.Kill(p.PID, 0) != syscall.ESRCH
+}
+
+// followLogs copies the output of the process into the job log, starting from
+// the given location in the output files.
+func (p *process) followLogs(whence int) {
+	if p.job.Config.TTY {
+		return
+	}
+	log := p.b.openLog(p.job.ID)
+	stop := make(chan struct{})
+	p.stopLogs = stop
+	for stream, name := range map[int]string{1: "stdout", 2: "stderr"} {
+		f, err := os.Open(filepath.Join(p.b.LogPath, p.job.ID, name))
+		if err == nil {
+			if _, err = f.Seek(0, whence); err != nil {
+				f.Close()
+			}
+		}
+		if err != nil {
+			grohl.Log(grohl.Data{"backend": "process", "fn": "follow_logs", "job.id": p.job.ID, "status": "error", "err": err})
+			continue
+		}
+		p.logsDone.Add(1)
+		go func(stream int, f *os.File) {
+			defer p.logsDone.Done()
+			defer f.Close()
+			followOutput(f, stream, log, stop)
+		}(stream, f)
+	}
+}
+
+// outputPollInterval is how often the output files of processes are checked
+// for new lines.
+const outputPollInterval = 100 * time.Millisecond
+
+// followOutput writes the lines appended to r to the job log until stop is
+// closed, after which it writes the rest of r, ending a partial last line
+// with a newline.
+func followOutput(r io.Reader, stream int, log *logbuf.Log, stop <-chan struct{}) {
+	br := bufio.NewReader(r)
+	var line string
+	var stopped bool
+	for {
+		s, err := br.ReadString('\n')
+		line += s
+		if err == io.EOF && !stopped {
+			// wait for more output, reading to the end once more when
+			// stopped as the process may have written more before
+			// exiting
+			select {
+			case <-stop:
+				stopped = true
+			case <-time.After(outputPollInterval):
+			}
+			continue
+		}
+		if line != "" {
+			if err != nil {
+				line += "\n"
+			}
+			log.Write(logbuf.Data{
+				Stream:    stream,
+				Timestamp: logbuf.UnixTime{Time: time.Now()},
+				Message:   line,
+			})
+			line = ""
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// exit releases the resources of the process once it has exited.
+func (p *process) exit() {
+	if p.stopLogs != nil {
+		close(p.stopLogs)
+		p.logsDone.Wait()
+	}
+	if !p.job.Config.TTY {
+		p.b.openLog(p.job.ID).Close()
+	}
+	p.b.processesMtx.Lock()
+	delete(p.b.processes, p.job.ID)
+	p.b.processesMtx.Unlock()
+	p.cleanup()
+	close(p.done)
+}
+
+func (p *process) cleanup() {
+	g := grohl.NewContext(grohl.Data{"backend": "process", "fn": "cleanup", "job.id": p.job.ID})
+	g.Log(grohl.Data{"at": "start"})
+
+	p.closeChildFiles()
+	if p.pty != nil {
+		p.pty.Close()
+	}
+	if p.stdin != nil {
+		p.stdin.Close()
+	}
+	if p.RootPath != "" {
+		for _, m := range p.job.Config.Mounts {
+			if err := syscall.Unmount(filepath.Join(p.RootPath, m.Location), 0); err != nil {
+				g.Log(grohl.Data{"at": "unmount", "location": m.Location, "status": "error", "err": err})
+			}
+		}
+	}
+	for _, port := range p.Ports {
+		p.b.ports.Put(port)
+	}
+	g.Log(grohl.Data{"at": "finish"})
+}
+
+func (p *process) closeChildFiles() {
+	for _, f := range p.childFiles {
+		f.Close()
+	}
+	p.childFiles = nil
+}
+
+func (p *process) Signal(sig int) error {
+	if p.PID == 0 {
+		// the process has not started yet, ForceStop is checked once it
+		// has
+		return nil
+	}
+	return syscall.Kill(p.PID, syscall.Signal(sig))
+}
+
+func (p *process) WaitStop(timeout time.Duration) error {
+	select {
+	case <-p.done:
+		return nil
+	case <-time.After(timeout):
+		return fmt.Errorf("Timed out: %v", timeout)
+	}
+}
+
+// Stop sends the stop signal of the job to the process, killing it if it
+// doesn't exit within the stop timeout.
+func (p *process) Stop() error {
+	return p.stop(false)
+}
+
+// stop stops the process like Stop, and if wait is set, returns once it has
+// exited or has been killed.
+func (p *process) stop(wait bool) error {
+	sig, timeout := stopConfig(p.job)
+	if err := p.Signal(sig); err != nil {
+		return err
+	}
+	kill := func() {
+		if err := p.WaitStop(timeout); err != nil {
+			p.Signal(int(syscall.SIGKILL))
+			if wait {
+				p.WaitStop(killTimeout)
+			}
+		}
+	}
+	if wait {
+		kill()
+	} else {
+		go kill()
+	}
+	return nil
+}
+
+func (b *ProcessBackend) getProcess(id string) (*process, error) {
+	b.processesMtx.RLock()
+	defer b.processesMtx.RUnlock()
+	p := b.processes[id]
+	if p == nil {
+		return nil, errors.New("process: unknown job")
+	}
+	return p, nil
+}
+
+func (b *ProcessBackend) Stop(id string) error {
+	p, err := b.getProcess(id)
+	if err != nil {
+		return err
+	}
+	return p.Stop()
+}
+
+func (b *ProcessBackend) Signal(id string, sig int) error {
+	p, err := b.getProcess(id)
+	if err != nil {
+		return err
+	}
+	return p.Signal(sig)
+}
+
+// Stats returns the resource usage of the main process of the job. Jobs don't
+// have their own cgroups or network namespace, so the usage of child
+// processes and network stats are not included.
+func (b *ProcessBackend) Stats(id string) (*host.JobStats, error) {
+	p, err := b.getProcess(id)
+	if err != nil {
+		return nil, err
+	}
+	if p.PID == 0 {
+		return nil, errors.New("process: job is not running")
+	}
+	stats := &host.JobStats{}
+	if err := readProcessStats(p.PID, stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+func (b *ProcessBackend) ResizeTTY(id string, height, width uint16) error {
+	p, err := b.getProcess(id)
+	if err != nil {
+		return err
+	}
+	if p.pty == nil {
+		return errors.New("job doesn't have a TTY")
+	}
+	return term.SetWinsize(p.pty.Fd(), &term.Winsize{Height: height, Width: width})
+}
+
+func (b *ProcessBackend) Attach(req *AttachRequest) (err error) {
+	var p *process
+	if req.Stdin != nil || req.Job.Job.Config.TTY {
+		p, err = b.getProcess(req.Job.Job.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	defer func() {
+		if p != nil && (req.Job.Job.Config.TTY || req.Stream) && err == io.EOF {
+			<-p.done
+			job := b.state.GetJob(req.Job.Job.ID)
+			if job.Status == host.StatusDone || job.Status == host.StatusCrashed {
+				err = ExitError(job.ExitStatus)
+				return
+			}
+			if job.Error != nil {
+				err = errors.New(*job.Error)
+			}
+		}
+	}()
+
+	if req.Job.Job.Config.TTY {
+		if p.pty == nil {
+			return errors.New("process: TTY is not available")
+		}
+		if err := term.SetWinsize(p.pty.Fd(), &term.Winsize{Height: req.Height, Width: req.Width}); err != nil {
+			return err
+		}
+		if req.Attached != nil {
+			req.Attached <- struct{}{}
+		}
+		if req.Stdin != nil && req.Stdout != nil {
+			go io.Copy(p.pty, req.Stdin)
+		} else if req.Stdin != nil {
+			io.Copy(p.pty, req.Stdin)
+		}
+		if req.Stdout != nil {
+			io.Copy(req.Stdout, p.pty)
+		}
+		return io.EOF
+	}
+	if req.Stdin != nil {
+		if p.stdin == nil {
+			return errors.New("process: stdin is not available")
+		}
+		go func() {
+			io.Copy(p.stdin, req.Stdin)
+			p.stdin.Close()
+		}()
+	}
+
+	if req.Attached != nil {
+		req.Attached <- struct{}{}
+	}
+
+	lines := -1
+	if !req.Logs {
+		lines = 0
+	}
+
+	log := b.openLog(req.Job.Job.ID)
+	ch := make(chan logbuf.Data)
+	done := make(chan struct{})
+	go log.Read(lines, req.Stream, ch, done)
+	defer close(done)
+
+	for data := range ch {
+		var w io.Writer
+		switch data.Stream {
+		case 1:
+			w = req.Stdout
+		case 2:
+			w = req.Stderr
+		}
+		if w == nil {
+			continue
+		}
+		if _, err := w.Write([]byte(data.Message)); err != nil {
+			return nil
+		}
+	}
+
+	return io.EOF
+}
+
+// Exec runs a process with the environment and root of a running job. If the
+// backend uses namespaces, nsenter is used to run the process in the
+// namespaces of the job.
+func (b *ProcessBackend) Exec(req *ExecRequest) (ExecProcess, error) {
+	p, err := b.getProcess(req.Job.Job.ID)
+	if err != nil {
+		return nil, err
+	}
+	var cmd *exec.Cmd
+	if b.Namespaces {
+		args := []string{"--target", strconv.Itoa(p.PID), "--mount", "--pid", "--ipc", "--uts", "--root", "--wd"}
+		if os.Getuid() != 0 {
+			args = append(args, "--user", "--preserve-credentials")
+		}
+		cmd = exec.Command("nsenter", append(append(args, "--"), req.Cmd...)...)
+		cmd.Env = p.environ(req.Env)
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	} else if cmd, err = p.command(req.Cmd, req.Env); err != nil {
+		return nil, err
+	}
+
+	// child contains the job side of the process stdio, which is closed
+	// once the process has started
+	var child, files []*os.File
+	defer func() {
+		for _, f := range child {
+			f.Close()
+		}
+	}()
+	if req.TTY {
+		master, slave, err := pty.Open()
+		if err != nil {
+			return nil, err
+		}
+		child, files = []*os.File{slave}, []*os.File{master}
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = slave, slave, slave
+		cmd.SysProcAttr.Setsid = true
+		cmd.SysProcAttr.Setctty = true
+	} else {
+		for i := 0; i < 3; i++ {
+			r, w, err := os.Pipe()
+			if err != nil {
+				return nil, err
+			}
+			if i == 0 {
+				child, files = append(child, r), append(files, w)
+			} else {
+				child, files = append(child, w), append(files, r)
+			}
+		}
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = child[0], child[1], child[2]
+	}
+	if err := cmd.Start(); err != nil {
+		for _, f := range files {
+			f.Close()
+		}
+		return nil, err
+	}
+	e := &processExec{cmd: cmd}
+	if req.TTY {
+		e.pty = files[0]
+	}
+	if e.done, err = copyExecStreams(req, files); err != nil {
+		cmd.Process.Kill()
+		return nil, err
+	}
+	return e, nil
+}
+
+type processExec struct {
+	cmd  *exec.Cmd
+	pty  *os.File
+	done <-chan struct{}
+}
+
+func (e *processExec) Signal(sig int) error {
+	return e.cmd.Process.Signal(syscall.Signal(sig))
+}
+
+func (e *processExec) ResizeTTY(height, width uint16) error {
+	if e.pty == nil {
+		return errors.New("process doesn't have a TTY")
+	}
+	return term.SetWinsize(e.pty.Fd(), &term.Winsize{Height: height, Width: width})
+}
+
+func (e *processExec) Wait() (int, error) {
+	err := e.cmd.Wait()
+	<-e.done
+	return exitStatus(err)
+}
+
+// exitStatus returns the exit status of a process given the error returned
+// from exec.Cmd.Wait, processes killed by a signal have an exit status of 128
+// plus the signal number.
+func exitStatus(err error) (int, error) {
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok {
+		return 0, err
+	}
+	ws := exitErr.Sys().(syscall.WaitStatus)
+	if ws.Signaled() {
+		return 128 + int(ws.Signal()), nil
+	}
+	return ws.ExitStatus(), nil
+}
+
+func (b *ProcessBackend) Cleanup() error {
+	g := grohl.NewContext(grohl.Data{"backend": "process", "fn": "Cleanup"})
+	b.processesMtx.Lock()
+	ids := make([]string, 0, len(b.processes))
+	for id := range b.processes {
+		ids = append(ids, id)
+	}
+	b.processesMtx.Unlock()
+	g.Log(grohl.Data{"at": "start", "count": len(ids)})
+	errs := make(chan error)
+	for _, id := range ids {
+		go func(id string) {
+			g.Log(grohl.Data{"at": "stop", "job.id": id})
+			// wait for the process to exit, as flynn-host may exit as
+			// soon as Cleanup returns
+			p, err := b.getProcess(id)
+			if err == nil {
+				err = p.stop(true)
+			}
+			if err != nil {
+				g.Log(grohl.Data{"at": "error", "job.id": id, "err": err.Error()})
+			}
+			errs <- err
+		}(id)
+	}
+	var err error
+	for i := 0; i < len(ids); i++ {
+		if stopErr := <-errs; stopErr != nil {
+			err = stopErr
+		}
+	}
+	g.Log(grohl.Data{"at": "finish"})
+	return err
+}
+
+// UnmarshalState adopts the processes of jobs which were started by a previous
+// flynn-host and are still running. TTY jobs cannot be adopted as the pty is
+// closed when flynn-host exits.
+func (b *ProcessBackend) UnmarshalState(jobs map[string]*host.ActiveJob, jobBackendStates map[string][]byte, backendGlobalState []byte) error {
+	g := grohl.NewContext(grohl.Data{"backend": "process", "fn": "UnmarshalState"})
+	for _, j := range jobs {
+		data, ok := jobBackendStates[j.Job.ID]
+		if !ok {
+			continue
+		}
+		p := &process{}
+		if err := json.Unmarshal(data, p); err != nil {
+			return fmt.Errorf("failed to deserialize backend process state: %s", err)
+		}
+		p.b = b
+		p.job = j.Job
+		p.done = make(chan struct{})
+		// the ports were allocated by a previous flynn-host, so only keep
+		// those which are allocated again below for cleanup to release
+		ports := p.Ports
+		p.Ports = nil
+		if p.PID == 0 || j.Job.Config.TTY || !p.alive() {
+			g.Log(grohl.Data{"at": "remove", "job.id": j.Job.ID, "pid": p.PID})
+			b.state.RemoveJob(j.Job.ID)
+			p.cleanup()
+			continue
+		}
+		for _, port := range ports {
+			if _, err := b.ports.GetPort(port); err != nil {
+				g.Log(grohl.Data{"at": "get_port", "job.id": j.Job.ID, "port": port, "status": "error", "err": err})
+				continue
+			}
+			p.Ports = append(p.Ports, port)
+		}
+		g.Log(grohl.Data{"at": "adopt", "job.id": j.Job.ID, "pid": p.PID})
+		b.processes[j.Job.ID] = p
+		// output written while flynn-host was not running is skipped
+		p.followLogs(os.SEEK_END)
+		go p.watch()
+	}
+	return nil
+}
+
+func (b *ProcessBackend) MarshalJobState(jobID string) ([]byte, error) {
+	b.processesMtx.RLock()
+	defer b.processesMtx.RUnlock()
+	if p, exists := b.processes[jobID]; exists {
+		return json.Marshal(p)
+	}
+	return nil, nil
+}
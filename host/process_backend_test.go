@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	. "github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-check"
+	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/natefinch/lumberjack"
+	"github.com/flynn/flynn/host/logbuf"
+	"github.com/flynn/flynn/host/ports"
+	"github.com/flynn/flynn/host/types"
+	"github.com/flynn/flynn/pkg/cluster"
+)
+
+func newTestProcessBackend(c *C, dir, name string, portAlloc *ports.Allocator) (*ProcessBackend, *State) {
+	state := NewState("test-host", filepath.Join(dir, name+"-state-db"))
+	b, err := NewProcessBackend(state, filepath.Join(dir, "volumes"), filepath.Join(dir, "logs"), portAlloc, false)
+	c.Assert(err, IsNil)
+	return b.(*ProcessBackend), state
+}
+
+func newTestProcessJob(script string) *host.Job {
+	return &host.Job{
+		ID:     cluster.RandomJobID(""),
+		Config: host.ContainerConfig{Cmd: []string{"sh", "-c", script}},
+	}
+}
+
+func waitJobStatus(c *C, state *State, id string, status host.JobStatus) *host.ActiveJob {
+	timeout := time.After(10 * time.Second)
+	for {
+		job := state.GetJob(id)
+		if job != nil && job.Status == status {
+			return job
+		}
+		select {
+		case <-timeout:
+			c.Fatalf("timed out waiting for job %s to be %s", id, status)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+type outputBuffer struct {
+	bytes.Buffer
+}
+
+func (outputBuffer) Close() error { return nil }
+
+// waitJobLog attaches to the logs of a job until its output is stdout and
+// stderr, as output is copied into the log asynchronously.
+func waitJobLog(c *C, b *ProcessBackend, job *host.Job, stdout, stderr string) {
+	timeout := time.After(10 * time.Second)
+	for {
+		var out, errOut outputBuffer
+		err := b.Attach(&AttachRequest{
+			Job:    &host.ActiveJob{Job: job},
+			Logs:   true,
+			Stdout: &out,
+			Stderr: &errOut,
+		})
+		c.Assert(err, Equals, io.EOF)
+		if out.String() == stdout && errOut.String() == stderr {
+			return
+		}
+		select {
+		case <-timeout:
+			c.Fatalf("timed out waiting for job log, got stdout %q and stderr %q", out.String(), errOut.String())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func (S) TestProcessBackendRun(c *C) {
+	alloc := ports.NewAllocator(50000, 50010)
+	b, state := newTestProcessBackend(c, c.MkDir(), "host", alloc)
+	defer state.persistenceDBClose()
+
+	job := newTestProcessJob("echo $PORT; echo $FOO >&2; exit 3")
+	job.Config.Env = map[string]string{"FOO": "bar"}
+	job.Config.Ports = []host.Port{{Proto: "tcp"}}
+	c.Assert(b.Run(job), IsNil)
+	port := job.Config.Ports[0].Port
+	c.Assert(port, Equals, 50000)
+
+	active := waitJobStatus(c, state, job.ID, host.StatusCrashed)
+	c.Assert(active.ExitStatus, Equals, 3)
+	c.Assert(active.ContainerID, Not(Equals), "")
+	waitJobLog(c, b, job, strconv.Itoa(port)+"\n", "bar\n")
+
+	// the port is released once the job exits
+	_, err := alloc.GetPort(uint16(port))
+	c.Assert(err, IsNil)
+
+	job = newTestProcessJob("exit 0")
+	c.Assert(b.Run(job), IsNil)
+	c.Assert(waitJobStatus(c, state, job.ID, host.StatusDone).ExitStatus, Equals, 0)
+
+	job = newTestProcessJob("")
+	job.Config.Cmd = []string{"/nonexistent"}
+	c.Assert(b.Run(job), IsNil)
+	c.Assert(*waitJobStatus(c, state, job.ID, host.StatusFailed).Error, Not(Equals), "")
+}
+
+func (S) TestProcessBackendStop(c *C) {
+	b, state := newTestProcessBackend(c, c.MkDir(), "host", ports.NewAllocator(50000, 50010))
+	defer state.persistenceDBClose()
+
+	// the job is sent its stop signal
+	job := newTestProcessJob(`trap "echo stopping; exit 0" USR1; while true; do sleep 0.1; done`)
+	job.Config.StopSignal = "SIGUSR1"
+	c.Assert(b.Run(job), IsNil)
+	waitJobStatus(c, state, job.ID, host.StatusRunning)
+	c.Assert(b.Stop(job.ID), IsNil)
+	waitJobStatus(c, state, job.ID, host.StatusDone)
+	waitJobLog(c, b, job, "stopping\n", "")
+
+	// jobs which don't exit within the stop timeout are killed
+	job = newTestProcessJob(`trap "" TERM; while true; do sleep 0.1; done`)
+	job.Config.StopTimeout = 1
+	c.Assert(b.Run(job), IsNil)
+	waitJobStatus(c, state, job.ID, host.StatusRunning)
+	start := time.Now()
+	c.Assert(b.Stop(job.ID), IsNil)
+	active := waitJobStatus(c, state, job.ID, host.StatusCrashed)
+	c.Assert(active.ExitStatus, Equals, 128+int(syscall.SIGKILL))
+	c.Assert(time.Since(start) >= time.Second, Equals, true)
+
+	c.Assert(b.Stop(job.ID), NotNil)
+}
+
+func (S) TestProcessBackendAttach(c *C) {
+	b, state := newTestProcessBackend(c, c.MkDir(), "host", ports.NewAllocator(50000, 50010))
+	defer state.persistenceDBClose()
+
+	// the job waits before and after replying so that the reply is only
+	// written once the client is following the log, and is read before the
+	// log is closed
+	job := newTestProcessJob("echo before; echo error >&2; read line; sleep 0.5; echo after $line; sleep 0.5")
+	job.Config.Stdin = true
+	c.Assert(b.Run(job), IsNil)
+
+	// attaching with logs sends the existing output
+	waitJobLog(c, b, job, "before\n", "error\n")
+
+	// attaching without logs only streams new output, until the job exits
+	var stdout, stderr outputBuffer
+	err := b.Attach(&AttachRequest{
+		Job:    &host.ActiveJob{Job: job},
+		Stream: true,
+		Stdin:  strings.NewReader("foo\n"),
+		Stdout: &stdout,
+		Stderr: &stderr,
+	})
+	c.Assert(err, Equals, ExitError(0))
+	c.Assert(stdout.String(), Equals, "after foo\n")
+	c.Assert(stderr.String(), Equals, "")
+	waitJobStatus(c, state, job.ID, host.StatusDone)
+
+	// the log of a job is available once it has exited
+	waitJobLog(c, b, job, "before\nafter foo\n", "error\n")
+}
+
+func (S) TestFollowOutput(c *C) {
+	log := logbuf.NewLog(&lumberjack.Logger{Filename: filepath.Join(c.MkDir(), "job.log")})
+	stop := make(chan struct{})
+	close(stop)
+
+	// once stopped, all of the output is written, including a partial last
+	// line
+	followOutput(strings.NewReader("foo\nbar\nbaz"), 2, log, stop)
+	c.Assert(log.Close(), IsNil)
+	ch := make(chan logbuf.Data)
+	go log.Read(-1, false, ch, nil)
+	var lines []string
+	for data := range ch {
+		c.Assert(data.Stream, Equals, 2)
+		lines = append(lines, data.Message)
+	}
+	c.Assert(lines, DeepEquals, []string{"foo\n", "bar\n", "baz\n"})
+}
+
+func (S) TestProcessBackendRestore(c *C) {
+	dir := c.MkDir()
+	b, state := newTestProcessBackend(c, dir, "host", ports.NewAllocator(50000, 50010))
+	defer state.persistenceDBClose()
+	defer b.Cleanup()
+
+	run := func() (*host.Job, []byte) {
+		job := newTestProcessJob("while true; do sleep 0.1; done")
+		job.Config.Ports = []host.Port{{Proto: "tcp"}}
+		c.Assert(b.Run(job), IsNil)
+		waitJobStatus(c, state, job.ID, host.StatusRunning)
+		data, err := b.MarshalJobState(job.ID)
+		c.Assert(err, IsNil)
+		return job, data
+	}
+	// a and b are still running when the backend restarts, and their
+	// ports are free and in use by another job respectively, the
+	// process of c has exited and its port is also in use
+	jobA, stateA := run()
+	jobB, stateB := run()
+	jobC, stateC := run()
+	c.Assert(b.Stop(jobC.ID), IsNil)
+	waitJobStatus(c, state, jobC.ID, host.StatusCrashed)
+
+	var p process
+	c.Assert(json.Unmarshal(stateA, &p), IsNil)
+	c.Assert(p.Ports, DeepEquals, []uint16{uint16(jobA.Config.Ports[0].Port)})
+	pid := p.PID
+	c.Assert(pid, Not(Equals), 0)
+
+	alloc := ports.NewAllocator(50000, 50010)
+	portA, portB, portC := uint16(jobA.Config.Ports[0].Port), uint16(jobB.Config.Ports[0].Port), uint16(jobC.Config.Ports[0].Port)
+	_, err := alloc.GetPort(portB)
+	c.Assert(err, IsNil)
+	_, err = alloc.GetPort(portC)
+	c.Assert(err, IsNil)
+
+	restored, restoredState := newTestProcessBackend(c, dir, "restored", alloc)
+	defer restoredState.persistenceDBClose()
+	jobs := make(map[string]*host.ActiveJob)
+	for _, job := range []*host.Job{jobA, jobB, jobC} {
+		restoredState.AddJob(job, "127.0.0.1")
+		jobs[job.ID] = &host.ActiveJob{Job: job}
+	}
+	c.Assert(restored.UnmarshalState(jobs, map[string][]byte{
+		jobA.ID: stateA,
+		jobB.ID: stateB,
+		jobC.ID: stateC,
+	}, nil), IsNil)
+
+	// the running processes are adopted with the ports which could be
+	// allocated, and the exited job is removed without releasing the port
+	// it held before the restart
+	procA, err := restored.getProcess(jobA.ID)
+	c.Assert(err, IsNil)
+	procB, err := restored.getProcess(jobB.ID)
+	c.Assert(err, IsNil)
+	c.Assert(restoredState.GetJob(jobC.ID), IsNil)
+	for _, port := range []uint16{portA, portB, portC} {
+		_, err = alloc.GetPort(port)
+		c.Assert(err, FitsTypeOf, ports.InUseError{})
+	}
+
+	// adopted jobs fail when their process exits, only releasing the
+	// ports allocated when they were restored
+	c.Assert(syscall.Kill(pid, syscall.SIGKILL), IsNil)
+	c.Assert(b.Signal(jobB.ID, int(syscall.SIGKILL)), IsNil)
+	for _, p := range []*process{procA, procB} {
+		c.Assert(p.WaitStop(10*time.Second), IsNil)
+	}
+	waitJobStatus(c, restoredState, jobA.ID, host.StatusFailed)
+	waitJobStatus(c, restoredState, jobB.ID, host.StatusFailed)
+	// the original backend also sees the processes exit, as it started them
+	waitJobStatus(c, state, jobA.ID, host.StatusCrashed)
+	waitJobStatus(c, state, jobB.ID, host.StatusCrashed)
+	_, err = alloc.GetPort(portA)
+	c.Assert(err, IsNil)
+	_, err = alloc.GetPort(portB)
+	c.Assert(err, FitsTypeOf, ports.InUseError{})
+	_, err = restored.getProcess(jobA.ID)
+	c.Assert(err, NotNil)
+}
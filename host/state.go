@@ -1,7 +1,9 @@
 package main
 
 import (
+	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -15,6 +17,9 @@ import (
 
 // TODO: prune old jobs?
 
+// jobHistorySize is the number of finished jobs kept in the job history.
+const jobHistorySize = 1000
+
 type State struct {
 	id string
 
@@ -107,6 +112,8 @@ func (s *State) initializePersistence() {
 		tx.CreateBucketIfNotExists([]byte("jobs"))
 		tx.CreateBucketIfNotExists([]byte("backend-jobs"))
 		tx.CreateBucketIfNotExists([]byte("backend-global"))
+		tx.CreateBucketIfNotExists([]byte("volumes"))
+		tx.CreateBucketIfNotExists([]byte("job-history"))
 		return nil
 	}); err != nil {
 		panic(fmt.Errorf("could not initialize host persistence db: %s", err))
@@ -173,6 +180,94 @@ func (s *State) persist(jobID string) {
 	}
 }
 
+// persistHistory adds a finished job to the job history, removing the oldest
+// jobs once there are more than jobHistorySize. Unlike the jobs bucket, the
+// history is kept after jobs are removed.
+func (s *State) persistHistory(job *host.ActiveJob) {
+	b, err := json.Marshal(job)
+	if err != nil {
+		panic(fmt.Errorf("failed to serialize job history: %s", err))
+	}
+	if err := s.stateDB.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte("job-history"))
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, seq)
+		if err := bucket.Put(key, b); err != nil {
+			return err
+		}
+		if seq <= jobHistorySize {
+			return nil
+		}
+		var old [][]byte
+		c := bucket.Cursor()
+		for k, _ := c.First(); k != nil && binary.BigEndian.Uint64(k) <= seq-jobHistorySize; k, _ = c.Next() {
+			old = append(old, append([]byte{}, k...))
+		}
+		for _, k := range old {
+			if err := bucket.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		panic(fmt.Errorf("could not persist job history to boltdb: %s", err))
+	}
+}
+
+// History returns the finished jobs in the job history, most recently
+// finished first.
+func (s *State) History() ([]host.ActiveJob, error) {
+	var jobs []host.ActiveJob
+	err := s.stateDB.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte("job-history")).Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var job host.ActiveJob
+			if err := json.Unmarshal(v, &job); err != nil {
+				return err
+			}
+			jobs = append(jobs, job)
+		}
+		return nil
+	})
+	return jobs, err
+}
+
+// Volumes returns the persisted named volumes.
+func (s *State) Volumes() (map[string]*host.Volume, error) {
+	volumes := make(map[string]*host.Volume)
+	err := s.stateDB.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte("volumes")).ForEach(func(k, v []byte) error {
+			vol := &host.Volume{}
+			if err := json.Unmarshal(v, vol); err != nil {
+				return err
+			}
+			volumes[string(k)] = vol
+			return nil
+		})
+	})
+	return volumes, err
+}
+
+func (s *State) PersistVolume(vol *host.Volume) error {
+	b, err := json.Marshal(vol)
+	if err != nil {
+		return err
+	}
+	return s.stateDB.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte("volumes")).Put([]byte(vol.Name), b)
+	})
+}
+
+func (s *State) DeleteVolume(name string) error {
+	return s.stateDB.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte("volumes")).Delete([]byte(name))
+	})
+}
+
 /*
 	Close the DB that persists the host state.
 	This is not called in typical flow because there's no need to release this file descriptor,
@@ -202,13 +297,28 @@ func (s *State) GetJob(id string) *host.ActiveJob {
 	return &jobCopy
 }
 
+// RemoveJob forgets a job, jobs which haven't finished are recorded as failed
+// in the job history.
 func (s *State) RemoveJob(jobID string) {
 	s.mtx.Lock()
 	defer s.mtx.Unlock()
+	if job, ok := s.jobs[jobID]; ok && !jobFinished(job) {
+		job.Status = host.StatusFailed
+		job.EndedAt = time.Now().UTC()
+		errStr := errJobRemoved.Error()
+		job.Error = &errStr
+		s.persistHistory(job)
+	}
 	delete(s.jobs, jobID)
 	s.persist(jobID)
 }
 
+var errJobRemoved = errors.New("host: job removed before it finished")
+
+func jobFinished(job *host.ActiveJob) bool {
+	return job.Status == host.StatusDone || job.Status == host.StatusCrashed || job.Status == host.StatusFailed
+}
+
 func (s *State) Get() map[string]host.ActiveJob {
 	s.mtx.RLock()
 	defer s.mtx.RUnlock()
@@ -245,6 +355,69 @@ func (s *State) SetManifestID(jobID, manifestID string) {
 	s.persist(jobID)
 }
 
+// SetLogDrains replaces the log drains of a job, returning false if the job
+// doesn't exist.
+func (s *State) SetLogDrains(jobID string, drains []string) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	job, ok := s.jobs[jobID]
+	if !ok {
+		return false
+	}
+
+	// the job may be shared with event listeners, so update a copy
+	j := job.Job.Dup()
+	j.LogDrains = drains
+	job.Job = j
+	s.persist(jobID)
+	return true
+}
+
+// SetOOMKilled records that a job was killed after running out of memory,
+// backends call it before setting the job as done.
+func (s *State) SetOOMKilled(jobID string) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	job, ok := s.jobs[jobID]
+	if !ok {
+		return
+	}
+	job.OOMKilled = true
+	s.persist(jobID)
+}
+
+// SetHealth records the result of a running job's health check, sending a
+// healthy event the first time it passes, an unhealthy event when it starts
+// failing and a recovered event when it passes again. The result is persisted
+// so that checks restarted with the host don't send the events again.
+func (s *State) SetHealth(jobID string, healthy bool) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	job, ok := s.jobs[jobID]
+	if !ok || job.Status != host.StatusRunning {
+		return
+	}
+	var event string
+	switch {
+	case healthy && job.Health == "":
+		event = "healthy"
+		job.Health = host.HealthStatusHealthy
+	case healthy && job.Health == host.HealthStatusUnhealthy:
+		event = "recovered"
+		job.Health = host.HealthStatusHealthy
+	case !healthy && job.Health != host.HealthStatusUnhealthy:
+		event = "unhealthy"
+		job.Health = host.HealthStatusUnhealthy
+	default:
+		return
+	}
+	s.sendEvent(job, event)
+	s.persist(jobID)
+}
+
 func (s *State) SetForceStop(jobID string) {
 	s.mtx.Lock()
 	defer s.mtx.Unlock()
@@ -295,7 +468,7 @@ func (s *State) SetStatusDone(jobID string, exitCode int) {
 }
 
 func (s *State) setStatusDone(job *host.ActiveJob, exitStatus int) {
-	if job.Status == host.StatusDone || job.Status == host.StatusCrashed || job.Status == host.StatusFailed {
+	if jobFinished(job) {
 		return
 	}
 	job.EndedAt = time.Now().UTC()
@@ -307,6 +480,7 @@ func (s *State) setStatusDone(job *host.ActiveJob, exitStatus int) {
 	}
 	s.sendEvent(job, "stop")
 	s.persist(job.Job.ID)
+	s.persistHistory(job)
 }
 
 func (s *State) SetStatusFailed(jobID string, err error) {
@@ -314,7 +488,7 @@ func (s *State) SetStatusFailed(jobID string, err error) {
 	defer s.mtx.Unlock()
 
 	job, ok := s.jobs[jobID]
-	if !ok || job.Status == host.StatusDone || job.Status == host.StatusCrashed || job.Status == host.StatusFailed {
+	if !ok || jobFinished(job) {
 		return
 	}
 	job.Status = host.StatusFailed
@@ -323,6 +497,7 @@ func (s *State) SetStatusFailed(jobID string, err error) {
 	job.Error = &errStr
 	s.sendEvent(job, "error")
 	s.persist(jobID)
+	s.persistHistory(job)
 	go s.WaitAttach(jobID)
 }
 
@@ -1,10 +1,14 @@
 package main
 
 import (
+	"errors"
 	"path/filepath"
+	"strconv"
 	"testing"
+	"time"
 
 	. "github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-check"
+	"github.com/flynn/flynn/host/logbuf"
 	"github.com/flynn/flynn/host/types"
 )
 
@@ -33,6 +37,9 @@ func (MockBackend) Stop(string) error                               { return nil
 func (MockBackend) Signal(string, int) error                        { return nil }
 func (MockBackend) ResizeTTY(id string, height, width uint16) error { return nil }
 func (MockBackend) Attach(*AttachRequest) error                     { return nil }
+func (MockBackend) Exec(*ExecRequest) (ExecProcess, error)          { return nil, nil }
+func (MockBackend) Stats(string) (*host.JobStats, error)            { return nil, nil }
+func (MockBackend) OpenLog(string) *logbuf.Log                      { return nil }
 func (MockBackend) Cleanup() error                                  { return nil }
 func (MockBackend) UnmarshalState(map[string]*host.ActiveJob, map[string][]byte, []byte) error {
 	return nil
@@ -58,3 +65,83 @@ func (S) TestStatePersistRestore(c *C) {
 		c.Errorf("expected job.HostID to equal %s, got %s", hostID, job.HostID)
 	}
 }
+
+func (S) TestStateJobHistory(c *C) {
+	workdir := c.MkDir()
+	state := NewState("abc123", filepath.Join(workdir, "host-state-db"))
+	state.AddJob(&host.Job{ID: "a"}, "1.1.1.1")
+	state.AddJob(&host.Job{ID: "b"}, "1.1.1.2")
+	state.AddJob(&host.Job{ID: "c"}, "1.1.1.3")
+	state.SetOOMKilled("a")
+	state.SetStatusDone("a", 137)
+	state.SetStatusFailed("b", errors.New("container failed to start"))
+	state.RemoveJob("c")
+	state.persistenceDBClose()
+
+	// the history is kept across restarts, even for removed jobs
+	state = NewState("abc123", filepath.Join(workdir, "host-state-db"))
+	defer state.persistenceDBClose()
+	history, err := state.History()
+	c.Assert(err, IsNil)
+	c.Assert(history, HasLen, 3)
+	c.Assert(history[0].Job.ID, Equals, "c")
+	c.Assert(history[0].Status, Equals, host.StatusFailed)
+	c.Assert(history[1].Job.ID, Equals, "b")
+	c.Assert(*history[1].Error, Equals, "container failed to start")
+	c.Assert(history[2].Job.ID, Equals, "a")
+	c.Assert(history[2].Status, Equals, host.StatusCrashed)
+	c.Assert(history[2].ExitStatus, Equals, 137)
+	c.Assert(history[2].OOMKilled, Equals, true)
+
+	// only the most recent jobs are kept
+	for i := 0; i < jobHistorySize; i++ {
+		id := strconv.Itoa(i)
+		state.AddJob(&host.Job{ID: id}, "")
+		state.SetStatusDone(id, 0)
+	}
+	history, err = state.History()
+	c.Assert(err, IsNil)
+	c.Assert(history, HasLen, jobHistorySize)
+	c.Assert(history[0].Job.ID, Equals, strconv.Itoa(jobHistorySize-1))
+	c.Assert(history[jobHistorySize-1].Job.ID, Equals, "0")
+}
+
+func (S) TestStateSetHealth(c *C) {
+	workdir := c.MkDir()
+	state := NewState("abc123", filepath.Join(workdir, "host-state-db"))
+	state.AddJob(&host.Job{ID: "a"}, "1.1.1.1")
+	state.SetStatusRunning("a")
+	events := state.AddListener("a")
+
+	// events are only sent when the health of the job changes
+	for _, healthy := range []bool{true, true, false, false, true} {
+		state.SetHealth("a", healthy)
+	}
+	c.Assert(state.GetJob("a").Health, Equals, host.HealthStatusHealthy)
+	received := make(map[string]int)
+	for i := 0; i < 3; i++ {
+		select {
+		case e := <-events:
+			received[e.Event]++
+		case <-time.After(time.Second):
+			c.Fatal("timed out waiting for health event")
+		}
+	}
+	c.Assert(received, DeepEquals, map[string]int{"healthy": 1, "unhealthy": 1, "recovered": 1})
+	state.RemoveListener("a", events)
+	state.persistenceDBClose()
+
+	// checks restarted with the host don't report the job healthy again
+	state = NewState("abc123", filepath.Join(workdir, "host-state-db"))
+	defer state.persistenceDBClose()
+	state.Restore(&MockBackend{})
+	c.Assert(state.GetJob("a").Health, Equals, host.HealthStatusHealthy)
+	events = state.AddListener("a")
+	defer state.RemoveListener("a", events)
+	state.SetHealth("a", true)
+	select {
+	case e := <-events:
+		c.Fatalf("unexpected %s event", e.Event)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
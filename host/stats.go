@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/flynn/flynn/host/types"
+)
+
+const cgroupRoot = "/sys/fs/cgroup"
+
+// clockTicks is the number of USER_HZ ticks per second used by the kernel in
+// /proc/<pid>/stat and cpuacct.stat, it is 100 on all supported platforms.
+const clockTicks = 100
+
+// readCgroupStats reads the memory, CPU and block IO usage of a job from its
+// cgroups, dir returns the cgroup directory of the job for a subsystem.
+func readCgroupStats(dir func(subsystem string) string, stats *host.JobStats) error {
+	mem := dir("memory")
+	var err error
+	if stats.Memory.Usage, err = readUintFile(filepath.Join(mem, "memory.usage_in_bytes")); err != nil {
+		return err
+	}
+	if stats.Memory.MaxUsage, err = readUintFile(filepath.Join(mem, "memory.max_usage_in_bytes")); err != nil {
+		return err
+	}
+	if stats.Memory.Limit, err = readUintFile(filepath.Join(mem, "memory.limit_in_bytes")); err != nil {
+		return err
+	}
+	memStat, err := readKeyValueFile(filepath.Join(mem, "memory.stat"))
+	if err != nil {
+		return err
+	}
+	stats.Memory.Cache = memStat["cache"]
+	stats.Memory.RSS = memStat["rss"]
+
+	cpu := dir("cpuacct")
+	if stats.CPU.Usage, err = readUintFile(filepath.Join(cpu, "cpuacct.usage")); err != nil {
+		return err
+	}
+	cpuStat, err := readKeyValueFile(filepath.Join(cpu, "cpuacct.stat"))
+	if err != nil {
+		return err
+	}
+	stats.CPU.User = ticksToNanoseconds(cpuStat["user"])
+	stats.CPU.System = ticksToNanoseconds(cpuStat["system"])
+
+	blkio := dir("blkio")
+	bytes, err := readBlkioFile(filepath.Join(blkio, "blkio.throttle.io_service_bytes"))
+	if err != nil {
+		return err
+	}
+	ops, err := readBlkioFile(filepath.Join(blkio, "blkio.throttle.io_serviced"))
+	if err != nil {
+		return err
+	}
+	stats.BlockIO = host.BlockIOStats{
+		ReadBytes:  bytes["Read"],
+		WriteBytes: bytes["Write"],
+		ReadOps:    ops["Read"],
+		WriteOps:   ops["Write"],
+	}
+	return nil
+}
+
+// cgroupPID returns a process in the cgroup directory dir, which can be used
+// to inspect the namespaces of the job.
+func cgroupPID(dir string) (int, error) {
+	f, err := os.Open(filepath.Join(dir, "cgroup.procs"))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	if !s.Scan() {
+		if err := s.Err(); err != nil {
+			return 0, err
+		}
+		return 0, fmt.Errorf("stats: no processes in %s", dir)
+	}
+	return strconv.Atoi(strings.TrimSpace(s.Text()))
+}
+
+// cgroupOOMKilled returns whether the OOM killer killed a process in the
+// memory cgroup directory dir. Older kernels don't count OOM kills, in which
+// case a cgroup which is still out of memory is taken to mean the same.
+func cgroupOOMKilled(dir string) bool {
+	oom, err := readKeyValueFile(filepath.Join(dir, "memory.oom_control"))
+	if err != nil {
+		return false
+	}
+	if n, ok := oom["oom_kill"]; ok {
+		return n > 0
+	}
+	return oom["under_oom"] > 0
+}
+
+// readNetworkStats sums the counters of all interfaces except loopback in the
+// network namespace of pid.
+func readNetworkStats(pid int) (host.NetworkStats, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/net/dev", pid))
+	if err != nil {
+		return host.NetworkStats{}, err
+	}
+	defer f.Close()
+	return parseNetDev(f)
+}
+
+func parseNetDev(r io.Reader) (host.NetworkStats, error) {
+	var stats host.NetworkStats
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		i := strings.Index(s.Text(), ":")
+		if i == -1 {
+			// header line
+			continue
+		}
+		if strings.TrimSpace(s.Text()[:i]) == "lo" {
+			continue
+		}
+		fields := strings.Fields(s.Text()[i+1:])
+		if len(fields) < 10 {
+			return stats, fmt.Errorf("stats: invalid net/dev line %q", s.Text())
+		}
+		values := make([]uint64, len(fields))
+		for j, f := range fields {
+			n, err := strconv.ParseUint(f, 10, 64)
+			if err != nil {
+				return stats, err
+			}
+			values[j] = n
+		}
+		stats.RxBytes += values[0]
+		stats.RxPackets += values[1]
+		stats.TxBytes += values[8]
+		stats.TxPackets += values[9]
+	}
+	return stats, s.Err()
+}
+
+// readProcessStats reads the CPU, memory and IO usage of a single process from
+// /proc, it is used when a job does not have its own cgroups.
+func readProcessStats(pid int, stats *host.JobStats) error {
+	stat, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return err
+	}
+	// the command name may contain spaces, so skip past it before splitting
+	i := strings.LastIndex(string(stat), ")")
+	if i == -1 {
+		return fmt.Errorf("stats: invalid stat for pid %d", pid)
+	}
+	fields := strings.Fields(string(stat[i+1:]))
+	if len(fields) < 13 {
+		return fmt.Errorf("stats: invalid stat for pid %d", pid)
+	}
+	// utime and stime are fields 14 and 15 of the stat file
+	utime, err := strconv.ParseUint(fields[11], 10, 64)
+	if err != nil {
+		return err
+	}
+	stime, err := strconv.ParseUint(fields[12], 10, 64)
+	if err != nil {
+		return err
+	}
+	stats.CPU.User = ticksToNanoseconds(utime)
+	stats.CPU.System = ticksToNanoseconds(stime)
+	stats.CPU.Usage = stats.CPU.User + stats.CPU.System
+
+	status, err := readKeyValueFile(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return err
+	}
+	stats.Memory.Usage = status["VmRSS:"] * 1024
+	stats.Memory.MaxUsage = status["VmHWM:"] * 1024
+	stats.Memory.RSS = stats.Memory.Usage
+
+	procIO, err := readKeyValueFile(fmt.Sprintf("/proc/%d/io", pid))
+	if err != nil {
+		// /proc/<pid>/io is only readable by the owner of the process
+		return nil
+	}
+	stats.BlockIO = host.BlockIOStats{
+		ReadBytes:  procIO["read_bytes:"],
+		WriteBytes: procIO["write_bytes:"],
+		ReadOps:    procIO["syscr:"],
+		WriteOps:   procIO["syscw:"],
+	}
+	return nil
+}
+
+func ticksToNanoseconds(ticks uint64) uint64 {
+	return ticks * (1e9 / clockTicks)
+}
+
+func readUintFile(path string) (uint64, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// readKeyValueFile reads a file of whitespace separated keys and numeric
+// values, lines which don't have a numeric value are skipped.
+func readKeyValueFile(path string) (map[string]uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseKeyValues(f)
+}
+
+func parseKeyValues(r io.Reader) (map[string]uint64, error) {
+	res := make(map[string]uint64)
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		n, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		res[fields[0]] = n
+	}
+	return res, s.Err()
+}
+
+// readBlkioFile sums the per-device values of a blkio stats file by operation.
+func readBlkioFile(path string) (map[string]uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseBlkio(f)
+}
+
+func parseBlkio(r io.Reader) (map[string]uint64, error) {
+	res := make(map[string]uint64)
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		// lines are of the form "8:0 Read 1234", apart from the final
+		// "Total 1234" line
+		fields := strings.Fields(s.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		n, err := strconv.ParseUint(fields[2], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		res[fields[1]] += n
+	}
+	return res, s.Err()
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+
+	. "github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-check"
+	"github.com/flynn/flynn/host/types"
+)
+
+func (S) TestParseNetDev(c *C) {
+	netDev := `Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo:    1000      10    0    0    0     0          0         0     1000      10    0    0    0     0       0          0
+  eth0:    2048      16    0    0    0     0          0         0      512       4    0    0    0     0       0          0
+  eth1:     100       1    0    0    0     0          0         0      200       2    0    0    0     0       0          0
+`
+	stats, err := parseNetDev(strings.NewReader(netDev))
+	c.Assert(err, IsNil)
+	c.Assert(stats, DeepEquals, host.NetworkStats{RxBytes: 2148, RxPackets: 17, TxBytes: 712, TxPackets: 6})
+}
+
+func (S) TestParseBlkio(c *C) {
+	blkio := `8:0 Read 4096
+8:0 Write 1024
+8:0 Sync 0
+8:16 Read 512
+8:16 Write 0
+Total 5632
+`
+	res, err := parseBlkio(strings.NewReader(blkio))
+	c.Assert(err, IsNil)
+	c.Assert(res["Read"], Equals, uint64(4608))
+	c.Assert(res["Write"], Equals, uint64(1024))
+}
+
+func (S) TestParseKeyValues(c *C) {
+	res, err := parseKeyValues(strings.NewReader("cache 4096\nrss 8192\nName:\tfoo\nVmRSS:\t  100 kB\n"))
+	c.Assert(err, IsNil)
+	c.Assert(res, DeepEquals, map[string]uint64{"cache": 4096, "rss": 8192, "VmRSS:": 100})
+}
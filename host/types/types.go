@@ -13,6 +13,10 @@ type Job struct {
 	Resources JobResources `json:"resources,omitempty"`
 
 	Config ContainerConfig `json:"config,omitempty"`
+
+	// LogDrains are the URLs of log drains that the output of the job is
+	// forwarded to, see the host README for the supported schemes.
+	LogDrains []string `json:"log_drains,omitempty"`
 }
 
 func (j *Job) Dup() *Job {
@@ -37,6 +41,7 @@ func (j *Job) Dup() *Job {
 		return res
 	}
 	job.Metadata = dupMap(j.Metadata)
+	job.LogDrains = dupSlice(j.LogDrains)
 	job.Config.Entrypoint = dupSlice(j.Config.Entrypoint)
 	job.Config.Cmd = dupSlice(j.Config.Cmd)
 	job.Config.Env = dupMap(j.Config.Env)
@@ -72,6 +77,68 @@ type ContainerConfig struct {
 	WorkingDir  string            `json:"working_dir,omitempty"`
 	Uid         int               `json:"uid,omitempty"`
 	HostNetwork bool              `json:"host_network,omitempty"`
+
+	// StopSignal is the name of the signal sent to stop the job, and
+	// StopTimeout is the number of seconds to wait for the job to exit
+	// before killing it. They default to SIGTERM and DefaultStopTimeout.
+	StopSignal  string `json:"stop_signal,omitempty"`
+	StopTimeout int    `json:"stop_timeout,omitempty"`
+
+	// HealthCheck is run by the host while the job is running, see
+	// HealthCheck.
+	HealthCheck *HealthCheck `json:"health_check,omitempty"`
+}
+
+// HealthCheck checks that a running job is working. Jobs with a health check
+// send a healthy event once the check first passes, an unhealthy event if it
+// fails Threshold times in a row or doesn't pass within StartTimeout, and a
+// recovered event if it passes again after failing.
+type HealthCheck struct {
+	// Type is tcp, http or exec.
+	Type string `json:"type,omitempty"`
+
+	// Port is the job port connected to by tcp and http checks, it defaults
+	// to the first TCP port of the job.
+	Port int `json:"port,omitempty"`
+
+	// Path, Host, Status and Match configure http checks, Status defaults
+	// to 200 and Match is a string the response body must contain.
+	Path   string `json:"path,omitempty"`
+	Host   string `json:"host,omitempty"`
+	Status int    `json:"status,omitempty"`
+	Match  string `json:"match,omitempty"`
+
+	// Cmd is run inside the job by exec checks, which pass if it exits with
+	// a zero status.
+	Cmd []string `json:"cmd,omitempty"`
+
+	// Interval, Timeout and StartTimeout are in seconds, they default to 2,
+	// 2 and DefaultHealthCheckStartTimeout. Threshold defaults to 2.
+	Interval     int `json:"interval,omitempty"`
+	Timeout      int `json:"timeout,omitempty"`
+	Threshold    int `json:"threshold,omitempty"`
+	StartTimeout int `json:"start_timeout,omitempty"`
+}
+
+// DefaultHealthCheckStartTimeout is how long jobs are given to pass their
+// health check after starting if they don't set StartTimeout.
+const DefaultHealthCheckStartTimeout = 30 * time.Second
+
+// DefaultStopTimeout is how long jobs are given to exit after being sent their
+// stop signal if they don't set StopTimeout.
+const DefaultStopTimeout = 10 * time.Second
+
+// StopSignals maps the names of the signals which may be used as a job stop
+// signal to their Linux signal numbers.
+var StopSignals = map[string]int{
+	"SIGHUP":   1,
+	"SIGINT":   2,
+	"SIGQUIT":  3,
+	"SIGKILL":  9,
+	"SIGUSR1":  10,
+	"SIGUSR2":  12,
+	"SIGTERM":  15,
+	"SIGWINCH": 28,
 }
 
 type Port struct {
@@ -84,6 +151,27 @@ type Mount struct {
 	Location  string `json:"location,omitempty"`
 	Target    string `json:"target,omitempty"`
 	Writeable bool   `json:"writeable,omitempty"`
+
+	// Volume is the name of a persistent volume managed by the host which is
+	// mounted at Location instead of Target. The volume is created if it
+	// doesn't exist.
+	Volume string `json:"volume,omitempty"`
+}
+
+// Volume is a named persistent volume on a host, it outlives the jobs that
+// use it.
+type Volume struct {
+	Name      string            `json:"name,omitempty"`
+	Path      string            `json:"path,omitempty"`
+	CreatedAt time.Time         `json:"created_at,omitempty"`
+	Snapshots []*VolumeSnapshot `json:"snapshots,omitempty"`
+}
+
+// VolumeSnapshot is a point in time copy of a volume.
+type VolumeSnapshot struct {
+	ID        string    `json:"id,omitempty"`
+	Path      string    `json:"path,omitempty"`
+	CreatedAt time.Time `json:"created_at,omitempty"`
 }
 
 type Artifact struct {
@@ -120,7 +208,72 @@ type ActiveJob struct {
 	EndedAt     time.Time `json:"ended_at,omitempty"`
 	ExitStatus  int       `json:"exit_status,omitempty"`
 	Error       *string   `json:"error,omitempty"`
+	OOMKilled   bool      `json:"oom_killed,omitempty"`
 	ManifestID  string    `json:"manifest_id,omitempty"`
+
+	// Health is the result of the job's health check, it is empty until the
+	// check first passes or fails.
+	Health HealthStatus `json:"health,omitempty"`
+}
+
+type HealthStatus string
+
+const (
+	HealthStatusHealthy   HealthStatus = "healthy"
+	HealthStatusUnhealthy HealthStatus = "unhealthy"
+)
+
+// LogMessage is a line of job output read from the job log.
+type LogMessage struct {
+	Stream    string    `json:"stream,omitempty"`
+	Timestamp time.Time `json:"timestamp,omitempty"`
+	Message   string    `json:"message"`
+}
+
+// NetworkPolicy isolates the containers of an app so they only accept new
+// connections from the listed addresses and from hosts.
+type NetworkPolicy struct {
+	AppID      string   `json:"app_id,omitempty"`
+	AllowedIPs []string `json:"allowed_ips,omitempty"`
+}
+
+// JobStats is a snapshot of the resources used by a job. Counters are
+// cumulative since the job started.
+type JobStats struct {
+	JobID   string       `json:"job_id,omitempty"`
+	Time    time.Time    `json:"time,omitempty"`
+	Memory  MemoryStats  `json:"memory"`
+	CPU     CPUStats     `json:"cpu"`
+	Network NetworkStats `json:"network"`
+	BlockIO BlockIOStats `json:"block_io"`
+}
+
+type MemoryStats struct {
+	Usage    uint64 `json:"usage"` // in bytes
+	MaxUsage uint64 `json:"max_usage,omitempty"`
+	Limit    uint64 `json:"limit,omitempty"`
+	Cache    uint64 `json:"cache,omitempty"`
+	RSS      uint64 `json:"rss,omitempty"`
+}
+
+type CPUStats struct {
+	Usage  uint64 `json:"usage"` // total CPU time in nanoseconds
+	User   uint64 `json:"user"`
+	System uint64 `json:"system"`
+}
+
+type NetworkStats struct {
+	RxBytes   uint64 `json:"rx_bytes"`
+	RxPackets uint64 `json:"rx_packets"`
+	TxBytes   uint64 `json:"tx_bytes"`
+	TxPackets uint64 `json:"tx_packets"`
+}
+
+type BlockIOStats struct {
+	ReadBytes  uint64 `json:"read_bytes"`
+	WriteBytes uint64 `json:"write_bytes"`
+	ReadOps    uint64 `json:"read_ops"`
+	WriteOps   uint64 `json:"write_ops"`
 }
 
 type AttachReq struct {
@@ -130,6 +283,18 @@ type AttachReq struct {
 	Width  uint16     `json:"width,omitempty"`
 }
 
+// ExecReq is a request to run an extra process inside a running job. Only the
+// stdin, stdout and stderr attach flags are used.
+type ExecReq struct {
+	JobID  string            `json:"job_id,omitempty"`
+	Cmd    []string          `json:"cmd,omitempty"`
+	Env    map[string]string `json:"env,omitempty"`
+	TTY    bool              `json:"tty,omitempty"`
+	Flags  AttachFlag        `json:"flags,omitempty"`
+	Height uint16            `json:"height,omitempty"`
+	Width  uint16            `json:"width,omitempty"`
+}
+
 type AttachFlag uint8
 
 const (
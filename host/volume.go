@@ -0,0 +1,205 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/technoweenie/grohl"
+	"github.com/flynn/flynn/host/types"
+	"github.com/flynn/flynn/pkg/random"
+)
+
+var (
+	ErrVolumeExists   = errors.New("host: volume already exists")
+	ErrVolumeNotFound = errors.New("host: volume not found")
+	ErrVolumeInUse    = errors.New("host: volume is in use by a job")
+	ErrInvalidVolume  = errors.New("host: invalid volume name")
+)
+
+var volumeNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,63}$`)
+
+// VolumeManager manages named persistent volumes, which are directories under
+// root that are bind mounted into the jobs that reference them.
+type VolumeManager struct {
+	root  string
+	state *State
+
+	mtx     sync.Mutex
+	volumes map[string]*host.Volume
+}
+
+func NewVolumeManager(root string, state *State) (*VolumeManager, error) {
+	volumes, err := state.Volumes()
+	if err != nil {
+		return nil, err
+	}
+	return &VolumeManager{root: root, state: state, volumes: volumes}, nil
+}
+
+func (m *VolumeManager) List() []*host.Volume {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	res := make(sortVolumes, 0, len(m.volumes))
+	for _, v := range m.volumes {
+		res = append(res, v)
+	}
+	sort.Sort(res)
+	return res
+}
+
+func (m *VolumeManager) Get(name string) *host.Volume {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return m.volumes[name]
+}
+
+func (m *VolumeManager) Create(name string) (*host.Volume, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if _, ok := m.volumes[name]; ok {
+		return nil, ErrVolumeExists
+	}
+	return m.create(name)
+}
+
+func (m *VolumeManager) create(name string) (*host.Volume, error) {
+	if !volumeNamePattern.MatchString(name) {
+		return nil, ErrInvalidVolume
+	}
+	vol := &host.Volume{
+		Name:      name,
+		Path:      filepath.Join(m.root, "volumes", name),
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := os.MkdirAll(vol.Path, 0755); err != nil {
+		return nil, err
+	}
+	if err := m.state.PersistVolume(vol); err != nil {
+		return nil, err
+	}
+	m.volumes[name] = vol
+	grohl.Log(grohl.Data{"fn": "create_volume", "volume": name, "path": vol.Path})
+	return vol, nil
+}
+
+// Delete removes a volume and its snapshots, volumes which are mounted by a
+// job that hasn't stopped can't be deleted.
+func (m *VolumeManager) Delete(name string) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	vol, ok := m.volumes[name]
+	if !ok {
+		return ErrVolumeNotFound
+	}
+	if m.inUse(name) {
+		return ErrVolumeInUse
+	}
+	if err := m.state.DeleteVolume(name); err != nil {
+		return err
+	}
+	delete(m.volumes, name)
+	grohl.Log(grohl.Data{"fn": "delete_volume", "volume": name})
+	if err := os.RemoveAll(m.snapshotDir(name)); err != nil {
+		return err
+	}
+	return os.RemoveAll(vol.Path)
+}
+
+// Snapshot copies the current contents of a volume. The copy is not atomic,
+// so jobs should be stopped or quiesced to get a consistent snapshot.
+func (m *VolumeManager) Snapshot(name string) (*host.VolumeSnapshot, error) {
+	m.mtx.Lock()
+	vol, ok := m.volumes[name]
+	m.mtx.Unlock()
+	if !ok {
+		return nil, ErrVolumeNotFound
+	}
+
+	// the volume is copied without holding the lock so that jobs can be
+	// started while it is copied
+	snapshot := &host.VolumeSnapshot{ID: random.UUID()}
+	snapshot.Path = filepath.Join(m.snapshotDir(name), snapshot.ID)
+	if err := os.MkdirAll(snapshot.Path, 0755); err != nil {
+		return nil, err
+	}
+	if out, err := exec.Command("cp", "-a", vol.Path+"/.", snapshot.Path).CombinedOutput(); err != nil {
+		os.RemoveAll(snapshot.Path)
+		return nil, fmt.Errorf("host: error copying volume: %s: %s", err, out)
+	}
+	snapshot.CreatedAt = time.Now().UTC()
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	// the volume may have been deleted, recreated or snapshotted again while
+	// it was being copied
+	current, ok := m.volumes[name]
+	if !ok || !current.CreatedAt.Equal(vol.CreatedAt) {
+		os.RemoveAll(snapshot.Path)
+		return nil, ErrVolumeNotFound
+	}
+	vol = current
+
+	// update a copy of the volume so that concurrent readers of the
+	// snapshot list are not affected
+	updated := *vol
+	updated.Snapshots = append(append([]*host.VolumeSnapshot{}, vol.Snapshots...), snapshot)
+	if err := m.state.PersistVolume(&updated); err != nil {
+		os.RemoveAll(snapshot.Path)
+		return nil, err
+	}
+	m.volumes[name] = &updated
+	grohl.Log(grohl.Data{"fn": "snapshot_volume", "volume": name, "snapshot": snapshot.ID})
+	return snapshot, nil
+}
+
+// ResolveMounts sets the target of each job mount which references a named
+// volume to the path of the volume, creating volumes that don't exist.
+func (m *VolumeManager) ResolveMounts(job *host.Job) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	for i, mount := range job.Config.Mounts {
+		if mount.Volume == "" {
+			continue
+		}
+		vol, ok := m.volumes[mount.Volume]
+		if !ok {
+			var err error
+			if vol, err = m.create(mount.Volume); err != nil {
+				return err
+			}
+		}
+		job.Config.Mounts[i].Target = vol.Path
+	}
+	return nil
+}
+
+func (m *VolumeManager) inUse(name string) bool {
+	for _, job := range m.state.Get() {
+		if job.Status != host.StatusStarting && job.Status != host.StatusRunning {
+			continue
+		}
+		for _, mount := range job.Job.Config.Mounts {
+			if mount.Volume == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (m *VolumeManager) snapshotDir(name string) string {
+	return filepath.Join(m.root, "snapshots", name)
+}
+
+type sortVolumes []*host.Volume
+
+func (s sortVolumes) Len() int           { return len(s) }
+func (s sortVolumes) Less(i, j int) bool { return s[i].Name < s[j].Name }
+func (s sortVolumes) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-check"
+	"github.com/flynn/flynn/host/types"
+)
+
+func (S) TestVolumeManager(c *C) {
+	workdir := c.MkDir()
+	state := NewState("host1", filepath.Join(workdir, "host-state-db"))
+	defer state.persistenceDBClose()
+	m, err := NewVolumeManager(filepath.Join(workdir, "volumes"), state)
+	c.Assert(err, IsNil)
+
+	_, err = m.Create("../foo")
+	c.Assert(err, Equals, ErrInvalidVolume)
+
+	vol, err := m.Create("foo")
+	c.Assert(err, IsNil)
+	c.Assert(vol.Name, Equals, "foo")
+	_, err = m.Create("foo")
+	c.Assert(err, Equals, ErrVolumeExists)
+	c.Assert(ioutil.WriteFile(filepath.Join(vol.Path, "file"), []byte("data"), 0644), IsNil)
+
+	// mounts of named volumes are resolved, creating missing volumes
+	job := &host.Job{ID: "a", Config: host.ContainerConfig{Mounts: []host.Mount{
+		{Location: "/data", Volume: "foo"},
+		{Location: "/other", Volume: "bar"},
+		{Location: "/tmp"},
+	}}}
+	c.Assert(m.ResolveMounts(job), IsNil)
+	c.Assert(job.Config.Mounts[0].Target, Equals, vol.Path)
+	c.Assert(job.Config.Mounts[1].Target, Equals, m.Get("bar").Path)
+	c.Assert(job.Config.Mounts[2].Target, Equals, "")
+	c.Assert(m.List(), HasLen, 2)
+
+	snapshot, err := m.Snapshot("foo")
+	c.Assert(err, IsNil)
+	data, err := ioutil.ReadFile(filepath.Join(snapshot.Path, "file"))
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "data")
+	c.Assert(m.Get("foo").Snapshots, HasLen, 1)
+
+	// volumes used by running jobs can't be deleted
+	state.AddJob(job, "")
+	c.Assert(m.Delete("foo"), Equals, ErrVolumeInUse)
+	state.SetStatusDone(job.ID, 0)
+	c.Assert(m.Delete("foo"), IsNil)
+	_, err = os.Stat(vol.Path)
+	c.Assert(os.IsNotExist(err), Equals, true)
+	c.Assert(m.Delete("foo"), Equals, ErrVolumeNotFound)
+
+	// volumes are restored from the state db
+	m, err = NewVolumeManager(filepath.Join(workdir, "volumes"), state)
+	c.Assert(err, IsNil)
+	c.Assert(m.List(), HasLen, 1)
+	c.Assert(m.Get("bar"), NotNil)
+}
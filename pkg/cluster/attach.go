@@ -34,23 +34,7 @@ func (c *hostClient) Attach(req *host.AttachReq, wait bool) (AttachClient, error
 	}
 
 	handleState := func() error {
-		switch attachState[0] {
-		case host.AttachSuccess:
-			return nil
-		case host.AttachError:
-			errBytes, err := ioutil.ReadAll(rwc)
-			rwc.Close()
-			if err != nil {
-				return err
-			}
-			if len(errBytes) >= 4 {
-				errBytes = errBytes[4:]
-			}
-			return errors.New(string(errBytes))
-		default:
-			rwc.Close()
-			return fmt.Errorf("cluster: unknown attach state: %d", attachState)
-		}
+		return handleAttachState(attachState[0], rwc)
 	}
 
 	if attachState[0] == host.AttachWaiting {
@@ -77,6 +61,48 @@ func (c *hostClient) Attach(req *host.AttachReq, wait bool) (AttachClient, error
 	return NewAttachClient(rwc), handleState()
 }
 
+// Exec starts the process specified in req inside a running job and returns
+// an attach client connected to the process. The exit status of the process
+// is returned by the Receive method of the client.
+func (c *hostClient) Exec(req *host.ExecReq) (AttachClient, error) {
+	rwc, err := c.c.Hijack("POST", "/exec", http.Header{"Upgrade": {"flynn-attach/0"}}, req)
+	if err != nil {
+		return nil, err
+	}
+
+	state := make([]byte, 1)
+	if _, err := rwc.Read(state); err != nil {
+		rwc.Close()
+		return nil, err
+	}
+	if err := handleAttachState(state[0], rwc); err != nil {
+		return nil, err
+	}
+	return NewAttachClient(rwc), nil
+}
+
+// handleAttachState returns an error if state is not AttachSuccess, closing
+// conn and reading the error message from it if there is one.
+func handleAttachState(state byte, conn io.ReadWriteCloser) error {
+	switch state {
+	case host.AttachSuccess:
+		return nil
+	case host.AttachError:
+		errBytes, err := ioutil.ReadAll(conn)
+		conn.Close()
+		if err != nil {
+			return err
+		}
+		if len(errBytes) >= 4 {
+			errBytes = errBytes[4:]
+		}
+		return errors.New(string(errBytes))
+	default:
+		conn.Close()
+		return fmt.Errorf("cluster: unknown attach state: %d", state)
+	}
+}
+
 // NewAttachClient wraps conn in an implementation of AttachClient.
 func NewAttachClient(conn io.ReadWriteCloser) AttachClient {
 	return &attachClient{conn: conn, w: bufio.NewWriter(conn)}
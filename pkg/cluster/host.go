@@ -2,7 +2,10 @@ package cluster
 
 import (
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"time"
 
 	"github.com/flynn/flynn/host/types"
 	"github.com/flynn/flynn/pkg/httpclient"
@@ -14,6 +17,11 @@ type Host interface {
 	// ListJobs lists the jobs running on the host.
 	ListJobs() (map[string]host.ActiveJob, error)
 
+	// ListJobHistory lists the jobs which have finished on the host, most
+	// recently finished first. The host keeps a bounded number of jobs,
+	// including those it no longer lists.
+	ListJobHistory() ([]host.ActiveJob, error)
+
 	// GetJob retrieves job details by ID.
 	GetJob(id string) (*host.ActiveJob, error)
 
@@ -24,9 +32,54 @@ type Host interface {
 	// job ID.
 	StreamEvents(id string, ch chan<- *host.Event) (stream.Stream, error)
 
+	// GetJobStats retrieves the resource usage of a running job.
+	GetJobStats(id string) (*host.JobStats, error)
+
+	// StreamJobStats streams the resource usage of a running job to ch every
+	// interval until the job stops.
+	StreamJobStats(id string, interval time.Duration, ch chan<- *host.JobStats) (stream.Stream, error)
+
+	// ListVolumes lists the named volumes on the host.
+	ListVolumes() ([]*host.Volume, error)
+
+	// GetVolume retrieves a named volume.
+	GetVolume(name string) (*host.Volume, error)
+
+	// CreateVolume creates a named volume.
+	CreateVolume(name string) (*host.Volume, error)
+
+	// DeleteVolume deletes a named volume and its snapshots.
+	DeleteVolume(name string) error
+
+	// CreateSnapshot snapshots the current contents of a named volume.
+	CreateSnapshot(volume string) (*host.VolumeSnapshot, error)
+
+	// StreamLog streams the lines of a job log to ch. If follow is set, an
+	// empty message is sent after the existing lines and new lines are
+	// streamed until the job stops.
+	StreamLog(id string, follow bool, ch chan<- *host.LogMessage) (stream.Stream, error)
+
+	// SetLogDrains replaces the log drains of a running job.
+	SetLogDrains(id string, drains []string) error
+
+	// CopyFrom returns a tar archive of path inside a running job.
+	CopyFrom(id, path string) (io.ReadCloser, error)
+
+	// CopyTo extracts a tar archive into the directory path inside a
+	// running job.
+	CopyTo(id, path string, archive io.Reader) error
+
+	// SetNetworkPolicies replaces the network policies of all isolated
+	// apps, which the host enforces for the jobs it runs.
+	SetNetworkPolicies(policies []*host.NetworkPolicy) error
+
 	// Attach attaches to a job, optionally waiting for it to start before
 	// attaching.
 	Attach(req *host.AttachReq, wait bool) (AttachClient, error)
+
+	// Exec runs an extra process inside a running job, the returned client
+	// is connected to the process rather than the job.
+	Exec(req *host.ExecReq) (AttachClient, error)
 }
 
 type hostClient struct {
@@ -52,6 +105,12 @@ func (c *hostClient) ListJobs() (map[string]host.ActiveJob, error) {
 	return jobs, err
 }
 
+func (c *hostClient) ListJobHistory() ([]host.ActiveJob, error) {
+	var jobs []host.ActiveJob
+	err := c.c.Get("/host/history", &jobs)
+	return jobs, err
+}
+
 func (c *hostClient) GetJob(id string) (*host.ActiveJob, error) {
 	var res host.ActiveJob
 	err := c.c.Get(fmt.Sprintf("/host/jobs/%s", id), &res)
@@ -69,3 +128,70 @@ func (c *hostClient) StreamEvents(id string, ch chan<- *host.Event) (stream.Stre
 	}
 	return c.c.Stream("GET", r, nil, ch)
 }
+
+func (c *hostClient) GetJobStats(id string) (*host.JobStats, error) {
+	var res host.JobStats
+	err := c.c.Get(fmt.Sprintf("/host/jobs/%s/stats", id), &res)
+	return &res, err
+}
+
+func (c *hostClient) StreamJobStats(id string, interval time.Duration, ch chan<- *host.JobStats) (stream.Stream, error) {
+	return c.c.Stream("GET", fmt.Sprintf("/host/jobs/%s/stats?interval=%s", id, interval), nil, ch)
+}
+
+func (c *hostClient) StreamLog(id string, follow bool, ch chan<- *host.LogMessage) (stream.Stream, error) {
+	return c.c.Stream("GET", fmt.Sprintf("/host/jobs/%s/log?follow=%t", id, follow), nil, ch)
+}
+
+func (c *hostClient) SetLogDrains(id string, drains []string) error {
+	return c.c.Put(fmt.Sprintf("/host/jobs/%s/log_drains", id), drains, nil)
+}
+
+func (c *hostClient) CopyFrom(id, path string) (io.ReadCloser, error) {
+	res, err := c.c.RawReq("GET", fmt.Sprintf("/host/jobs/%s/files?path=%s", id, url.QueryEscape(path)), nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+func (c *hostClient) CopyTo(id, path string, archive io.Reader) error {
+	header := http.Header{"Content-Type": {"application/x-tar"}}
+	res, err := c.c.RawReq("PUT", fmt.Sprintf("/host/jobs/%s/files?path=%s", id, url.QueryEscape(path)), header, archive, nil)
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+func (c *hostClient) SetNetworkPolicies(policies []*host.NetworkPolicy) error {
+	return c.c.Put("/host/network/policies", policies, nil)
+}
+
+func (c *hostClient) ListVolumes() ([]*host.Volume, error) {
+	var volumes []*host.Volume
+	err := c.c.Get("/host/volumes", &volumes)
+	return volumes, err
+}
+
+func (c *hostClient) GetVolume(name string) (*host.Volume, error) {
+	var res host.Volume
+	err := c.c.Get(fmt.Sprintf("/host/volumes/%s", name), &res)
+	return &res, err
+}
+
+func (c *hostClient) CreateVolume(name string) (*host.Volume, error) {
+	var res host.Volume
+	err := c.c.Post("/host/volumes", &host.Volume{Name: name}, &res)
+	return &res, err
+}
+
+func (c *hostClient) DeleteVolume(name string) error {
+	return c.c.Delete(fmt.Sprintf("/host/volumes/%s", name))
+}
+
+func (c *hostClient) CreateSnapshot(volume string) (*host.VolumeSnapshot, error) {
+	var res host.VolumeSnapshot
+	err := c.c.Post(fmt.Sprintf("/host/volumes/%s/snapshots", volume), nil, &res)
+	return &res, err
+}
@@ -163,17 +163,6 @@ func (c *Cmd) Start() error {
 		c.closeCluster = true
 	}
 
-	if c.HostID == "" {
-		hosts, err := c.cluster.ListHosts()
-		if err != nil {
-			return err
-		}
-		if len(hosts) == 0 {
-			return errors.New("exec: no hosts found")
-		}
-		c.HostID = schedutil.PickHost(hosts).ID
-	}
-
 	// Use the pre-defined host.Job configuration if provided;
 	// otherwise generate one from the fields on exec.Cmd that mirror stdlib's os.exec.
 	if c.Job == nil {
@@ -195,6 +184,21 @@ func (c *Cmd) Start() error {
 		c.Job.ID = cluster.RandomJobID("")
 	}
 
+	if c.HostID == "" {
+		hosts, err := c.cluster.ListHosts()
+		if err != nil {
+			return err
+		}
+		if len(hosts) == 0 {
+			return errors.New("exec: no hosts found")
+		}
+		h := schedutil.PickHost(hosts, c.Job)
+		if h == nil {
+			return schedutil.ErrNoCapacity
+		}
+		c.HostID = h.ID
+	}
+
 	var err error
 	c.host, err = c.cluster.DialHost(c.HostID)
 	if err != nil {
@@ -23,6 +23,7 @@ const (
 	ObjectExistsError   ErrorCode = "object_exists"
 	SyntaxError         ErrorCode = "syntax_error"
 	ValidationError     ErrorCode = "validation_error"
+	UnavailableError    ErrorCode = "service_unavailable"
 	UnknownError        ErrorCode = "unknown_error"
 )
 
@@ -32,6 +33,7 @@ var errorResponseCodes = map[ErrorCode]int{
 	ObjectExistsError:   409,
 	SyntaxError:         400,
 	ValidationError:     400,
+	UnavailableError:    503,
 	UnknownError:        500,
 }
 
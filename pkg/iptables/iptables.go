@@ -5,6 +5,7 @@ package iptables
 // details.
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"os/exec"
@@ -92,3 +93,28 @@ func Raw(args ...string) ([]byte, error) {
 
 	return output, err
 }
+
+// ReplaceChain atomically replaces the rules of a chain in the filter table
+// with iptables-restore, so packets are never matched against a partial list
+// of rules. Other chains are left untouched.
+func ReplaceChain(chain string, rules [][]string) error {
+	path, err := exec.LookPath("iptables-restore")
+	if err != nil {
+		return ErrIptablesNotFound
+	}
+
+	// declaring the chain flushes it, even with --noflush
+	var input bytes.Buffer
+	fmt.Fprintf(&input, "*filter\n:%s - [0:0]\n", chain)
+	for _, rule := range rules {
+		fmt.Fprintf(&input, "-A %s %s\n", chain, strings.Join(rule, " "))
+	}
+	input.WriteString("COMMIT\n")
+
+	cmd := exec.Command(path, "--noflush")
+	cmd.Stdin = &input
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("iptables-restore failed: %s (%s)", output, err)
+	}
+	return nil
+}
@@ -73,6 +73,13 @@ func (c *gobServerCodec) WriteResponse(r *rpcplus.Response, body interface{}, la
 	case *os.File:
 		defer f.Close()
 		body = &FD{c.fdWriter.AddFD(int(f.Fd()))}
+	case *[]*os.File:
+		fds := make([]FD, len(*f))
+		for i, file := range *f {
+			defer file.Close()
+			fds[i].FD = c.fdWriter.AddFD(int(file.Fd()))
+		}
+		body = &fds
 	}
 
 	if err = c.enc.Encode(r); err != nil {
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-docopt"
+	"github.com/flynn/flynn/host/types"
+	"github.com/flynn/flynn/pkg/schedutil"
+)
+
+func main() {
+	usage := `schedsim replays a cluster state and formation changes against a scheduling policy.
+
+Usage:
+  schedsim [options] <file>
+  schedsim -h | --help
+
+The file contains a JSON encoded simulation, for example:
+
+  {
+    "hosts": [{"id": "host1"}, {"id": "host2"}],
+    "changes": [
+      {"app": "app1", "release": "r1", "processes": {"web": 3, "worker": 1}},
+      {"app": "app2", "release": "r2", "processes": {"router": 1}, "omni": ["router"]},
+      {"app": "app1", "release": "r1", "processes": {"web": 1}}
+    ]
+  }
+
+Options:
+  -h, --help          show this message and exit
+  --policy=<name>     scheduling policy (least-jobs, spread or bin-pack) [default: spread]
+  --max-jobs=<n>      maximum number of jobs per host for the bin-pack policy [default: 0]
+  --seed=<n>          seed used to break ties between hosts [default: 1]
+  --json              emit json-formatted output
+`
+
+	args, _ := docopt.Parse(usage, nil, true, "", false)
+
+	seed, err := strconv.ParseInt(args.String["--seed"], 10, 64)
+	if err != nil {
+		log.Fatalf("invalid seed: %s", err)
+	}
+	maxJobs, err := strconv.Atoi(args.String["--max-jobs"])
+	if err != nil {
+		log.Fatalf("invalid max jobs: %s", err)
+	}
+	r := rand.New(rand.NewSource(seed))
+
+	var policy schedutil.Policy
+	switch name := args.String["--policy"]; name {
+	case schedutil.PolicyLeastJobs:
+		policy = schedutil.LeastJobs{Rand: r}
+	case schedutil.PolicySpread:
+		policy = schedutil.Spread{Rand: r}
+	case schedutil.PolicyBinPack:
+		policy = schedutil.BinPack{MaxJobs: maxJobs, Rand: r}
+	default:
+		log.Fatalf("unknown policy %q", name)
+	}
+
+	f, err := os.Open(args.String["<file>"])
+	if err != nil {
+		log.Fatal(err)
+	}
+	sim := &schedutil.Simulation{}
+	err = json.NewDecoder(f).Decode(sim)
+	f.Close()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	placements, hosts := schedutil.Simulate(policy, sim)
+
+	if args.Bool["--json"] {
+		json.NewEncoder(os.Stdout).Encode(struct {
+			Placements []*schedutil.Placement `json:"placements"`
+			Hosts      []host.Host            `json:"hosts"`
+		}{placements, hosts})
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 1, 2, 2, ' ', 0)
+	fmt.Fprintln(w, "STEP\tACTION\tHOST\tJOB\tAPP\tRELEASE\tTYPE")
+	for _, p := range placements {
+		hostID := p.HostID
+		if p.Error != "" {
+			hostID = "(" + p.Error + ")"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", p.Step, p.Action, hostID, p.JobID, p.AppID, p.ReleaseID, p.Type)
+	}
+	w.Flush()
+
+	fmt.Println()
+	sort.Sort(sortHosts(hosts))
+	w = tabwriter.NewWriter(os.Stdout, 1, 2, 2, ' ', 0)
+	fmt.Fprintln(w, "HOST\tJOBS")
+	for _, h := range hosts {
+		fmt.Fprintf(w, "%s\t%d\n", h.ID, len(h.Jobs))
+	}
+	w.Flush()
+}
+
+type sortHosts []host.Host
+
+func (h sortHosts) Len() int           { return len(h) }
+func (h sortHosts) Less(i, j int) bool { return h[i].ID < h[j].ID }
+func (h sortHosts) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
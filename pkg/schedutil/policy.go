@@ -0,0 +1,210 @@
+package schedutil
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+
+	"github.com/flynn/flynn/host/types"
+	"github.com/flynn/flynn/pkg/random"
+)
+
+// A Policy decides which host a job should be placed on.
+type Policy interface {
+	// PickHost returns a pointer to the element of hosts that job should be
+	// placed on, or nil if none of the hosts are suitable.
+	PickHost(hosts []host.Host, job *host.Job) *host.Host
+}
+
+const (
+	PolicyLeastJobs = "least-jobs"
+	PolicySpread    = "spread"
+	PolicyBinPack   = "bin-pack"
+)
+
+// DefaultPolicy is the policy used when no policy is configured.
+var DefaultPolicy Policy = Spread{}
+
+// LookupPolicy returns the policy with the given name, or DefaultPolicy if name
+// is empty.
+func LookupPolicy(name string) (Policy, error) {
+	switch name {
+	case "":
+		return DefaultPolicy, nil
+	case PolicyLeastJobs:
+		return LeastJobs{}, nil
+	case PolicySpread:
+		return Spread{}, nil
+	case PolicyBinPack:
+		return BinPack{}, nil
+	default:
+		return nil, fmt.Errorf("schedutil: unknown policy %q", name)
+	}
+}
+
+// ErrNoCapacity is returned when every host is full.
+var ErrNoCapacity = errors.New("schedutil: no hosts have capacity for the job")
+
+// PickHost picks a host for job using DefaultPolicy.
+func PickHost(hosts []host.Host, job *host.Job) *host.Host {
+	return DefaultPolicy.PickHost(hosts, job)
+}
+
+// Place picks a host for job using p and adds the job to the picked host so
+// that subsequent placements against the same hosts take it into account.
+func Place(p Policy, hosts []host.Host, job *host.Job) *host.Host {
+	h := p.PickHost(hosts, job)
+	if h != nil {
+		h.Jobs = append(h.Jobs, job)
+	}
+	return h
+}
+
+// MetaMaxJobs is the host metadata key which limits the number of jobs that
+// will be placed on a host (e.g. flynn-host daemon --meta max_jobs=20).
+const MetaMaxJobs = "max_jobs"
+
+// HostFull returns whether h has reached the job limit set in its metadata.
+// Hosts which are full are never picked by a Policy. There is no limit for
+// hosts which don't set one, flynn-host refuses to start with an invalid
+// limit.
+func HostFull(h *host.Host) bool {
+	max, err := strconv.Atoi(h.Metadata[MetaMaxJobs])
+	if err != nil || max <= 0 {
+		return false
+	}
+	return len(h.Jobs) >= max
+}
+
+// JobPriority returns the priority of job, jobs with a higher priority may
+// preempt jobs with a lower priority when there is no capacity for them.
+func JobPriority(job *host.Job) int {
+	n, _ := strconv.Atoi(job.Metadata["flynn-controller.priority"])
+	return n
+}
+
+// LeastJobs places jobs on the host with the fewest jobs.
+type LeastJobs struct {
+	// Rand is used to break ties, random.Math is used if nil.
+	Rand *rand.Rand
+}
+
+func (p LeastJobs) PickHost(hosts []host.Host, job *host.Job) *host.Host {
+	return pickLowest(hosts, p.Rand, func(h *host.Host) []int {
+		return []int{len(h.Jobs)}
+	})
+}
+
+// Spread places jobs on the host with the fewest jobs of the same app and
+// process type, falling back to the total number of jobs on each host.
+type Spread struct {
+	// Rand is used to break ties, random.Math is used if nil.
+	Rand *rand.Rand
+}
+
+func (p Spread) PickHost(hosts []host.Host, job *host.Job) *host.Host {
+	return pickLowest(hosts, p.Rand, func(h *host.Host) []int {
+		var n int
+		for _, j := range h.Jobs {
+			if sameProcessType(j, job) {
+				n++
+			}
+		}
+		return []int{n, len(h.Jobs)}
+	})
+}
+
+// BinPack places jobs on the host with the most jobs so that as few hosts as
+// possible are used.
+type BinPack struct {
+	// MaxJobs is the maximum number of jobs placed on a single host, zero
+	// means there is no limit.
+	MaxJobs int
+
+	// Rand is used to break ties, random.Math is used if nil.
+	Rand *rand.Rand
+}
+
+func (p BinPack) PickHost(hosts []host.Host, job *host.Job) *host.Host {
+	return pickLowest(hosts, p.Rand, func(h *host.Host) []int {
+		if p.MaxJobs > 0 && len(h.Jobs) >= p.MaxJobs {
+			return nil
+		}
+		return []int{-len(h.Jobs)}
+	})
+}
+
+func sameProcessType(a, b *host.Job) bool {
+	if b == nil {
+		return false
+	}
+	app := a.Metadata["flynn-controller.app"]
+	if app == "" {
+		return false
+	}
+	return app == b.Metadata["flynn-controller.app"] &&
+		a.Metadata["flynn-controller.type"] == b.Metadata["flynn-controller.type"]
+}
+
+// pickLowest returns the host with the lowest score, comparing scores
+// lexicographically and picking randomly between hosts that are tied. Hosts
+// which are full or have a nil score are not considered.
+func pickLowest(hosts []host.Host, r *rand.Rand, score func(*host.Host) []int) *host.Host {
+	if r == nil {
+		r = random.Math
+	}
+
+	var lowest []int
+	var lowestScore []int
+	for i := range hosts {
+		if HostFull(&hosts[i]) {
+			continue
+		}
+		s := score(&hosts[i])
+		if s == nil {
+			continue
+		}
+		if lowest == nil {
+			lowest, lowestScore = []int{i}, s
+			continue
+		}
+		switch compareScores(s, lowestScore) {
+		case -1:
+			lowest, lowestScore = []int{i}, s
+		case 0:
+			lowest = append(lowest, i)
+		}
+	}
+	switch len(lowest) {
+	case 0:
+		return nil
+	case 1:
+		return &hosts[lowest[0]]
+	}
+	// sort by host ID so that a seeded Rand gives reproducible results
+	sort.Sort(hostIndex{hosts, lowest})
+	return &hosts[lowest[r.Intn(len(lowest))]]
+}
+
+func compareScores(a, b []int) int {
+	for i := range a {
+		switch {
+		case a[i] < b[i]:
+			return -1
+		case a[i] > b[i]:
+			return 1
+		}
+	}
+	return 0
+}
+
+type hostIndex struct {
+	hosts []host.Host
+	index []int
+}
+
+func (h hostIndex) Len() int           { return len(h.index) }
+func (h hostIndex) Swap(i, j int)      { h.index[i], h.index[j] = h.index[j], h.index[i] }
+func (h hostIndex) Less(i, j int) bool { return h.hosts[h.index[i]].ID < h.hosts[h.index[j]].ID }
@@ -0,0 +1,185 @@
+package schedutil
+
+import (
+	"math/rand"
+	"testing"
+
+	. "github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-check"
+	"github.com/flynn/flynn/host/types"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type S struct{}
+
+var _ = Suite(&S{})
+
+func newJob(app, typ string) *host.Job {
+	return &host.Job{Metadata: map[string]string{
+		"flynn-controller.app":     app,
+		"flynn-controller.release": app + "-release",
+		"flynn-controller.type":    typ,
+	}}
+}
+
+func newHost(id string, jobs ...*host.Job) host.Host {
+	return host.Host{ID: id, Jobs: jobs}
+}
+
+func (S) TestLeastJobs(c *C) {
+	hosts := []host.Host{
+		newHost("host1", newJob("a", "web"), newJob("b", "web")),
+		newHost("host2", newJob("a", "web")),
+		newHost("host3", newJob("a", "web"), newJob("b", "web"), newJob("c", "web")),
+	}
+	h := LeastJobs{}.PickHost(hosts, newJob("a", "web"))
+	c.Assert(h, NotNil)
+	c.Assert(h.ID, Equals, "host2")
+	c.Assert(LeastJobs{}.PickHost(nil, newJob("a", "web")), IsNil)
+}
+
+func (S) TestSpread(c *C) {
+	hosts := []host.Host{
+		newHost("host1", newJob("a", "web")),
+		newHost("host2", newJob("b", "web"), newJob("b", "worker")),
+		newHost("host3", newJob("a", "web"), newJob("a", "worker")),
+	}
+	// host2 has the most jobs but none of the same type
+	h := Spread{}.PickHost(hosts, newJob("a", "web"))
+	c.Assert(h, NotNil)
+	c.Assert(h.ID, Equals, "host2")
+
+	// ties between hosts are broken by the total number of jobs
+	h = Spread{}.PickHost(hosts, newJob("c", "web"))
+	c.Assert(h, NotNil)
+	c.Assert(h.ID, Equals, "host1")
+}
+
+func (S) TestBinPack(c *C) {
+	hosts := []host.Host{
+		newHost("host1", newJob("a", "web")),
+		newHost("host2", newJob("a", "web"), newJob("b", "web")),
+		newHost("host3"),
+	}
+	p := BinPack{MaxJobs: 3}
+	h := Place(p, hosts, newJob("c", "web"))
+	c.Assert(h, NotNil)
+	c.Assert(h.ID, Equals, "host2")
+
+	// host2 is now full
+	h = Place(p, hosts, newJob("c", "web"))
+	c.Assert(h, NotNil)
+	c.Assert(h.ID, Equals, "host1")
+	h = Place(p, hosts, newJob("c", "web"))
+	c.Assert(h, NotNil)
+	c.Assert(h.ID, Equals, "host1")
+
+	h = Place(p, hosts, newJob("c", "web"))
+	c.Assert(h, NotNil)
+	c.Assert(h.ID, Equals, "host3")
+
+	c.Assert(BinPack{MaxJobs: 1}.PickHost(hosts, newJob("c", "web")), IsNil)
+}
+
+func (S) TestLookupPolicy(c *C) {
+	for name, expected := range map[string]Policy{
+		"":              DefaultPolicy,
+		PolicyLeastJobs: LeastJobs{},
+		PolicySpread:    Spread{},
+		PolicyBinPack:   BinPack{},
+	} {
+		p, err := LookupPolicy(name)
+		c.Assert(err, IsNil)
+		c.Assert(p, DeepEquals, expected)
+	}
+	_, err := LookupPolicy("foo")
+	c.Assert(err, NotNil)
+}
+
+func (S) TestSimulate(c *C) {
+	sim := &Simulation{
+		Hosts: []host.Host{
+			newHost("host1", newJob("b", "web")),
+			newHost("host2"),
+			newHost("host3"),
+		},
+		Changes: []*FormationChange{
+			{AppID: "a", ReleaseID: "a-release", Processes: map[string]int{"web": 3}},
+			{AppID: "r", ReleaseID: "r-release", Processes: map[string]int{"router": 1}, Omni: []string{"router"}},
+			{AppID: "a", ReleaseID: "a-release", Processes: map[string]int{"web": 1}},
+			{AppID: "b", ReleaseID: "b-release", Processes: map[string]int{}},
+		},
+	}
+	placements, hosts := Simulate(Spread{Rand: rand.New(rand.NewSource(1))}, sim)
+
+	type count struct{ start, stop int }
+	counts := make(map[int]*count)
+	hostsByJob := make(map[string]string)
+	for _, p := range placements {
+		c.Assert(p.Error, Equals, "")
+		if counts[p.Step] == nil {
+			counts[p.Step] = &count{}
+		}
+		switch p.Action {
+		case ActionStart:
+			counts[p.Step].start++
+			hostsByJob[p.JobID] = p.HostID
+		case ActionStop:
+			counts[p.Step].stop++
+		}
+	}
+	c.Assert(counts[1], DeepEquals, &count{start: 3})
+	c.Assert(counts[2], DeepEquals, &count{start: 3})
+	c.Assert(counts[3], DeepEquals, &count{stop: 2})
+	c.Assert(counts[4], DeepEquals, &count{stop: 1})
+
+	// the web jobs should have been spread across all hosts
+	seen := make(map[string]bool)
+	for _, p := range placements {
+		if p.Step == 1 {
+			seen[p.HostID] = true
+		}
+	}
+	c.Assert(seen, HasLen, 3)
+
+	// the oldest web job should remain
+	for _, p := range placements {
+		if p.Step == 3 {
+			c.Assert(p.JobID, Not(Equals), "sim-job-1")
+		}
+	}
+
+	var total int
+	for _, h := range hosts {
+		total += len(h.Jobs)
+	}
+	c.Assert(total, Equals, 4)
+
+	// the initial state should not be modified
+	c.Assert(sim.Hosts[0].Jobs, HasLen, 1)
+	c.Assert(sim.Hosts[1].Jobs, HasLen, 0)
+}
+
+func (S) TestHostFull(c *C) {
+	hosts := []host.Host{
+		newHost("host1"),
+		newHost("host2", newJob("a", "web"), newJob("a", "web")),
+	}
+	hosts[0].Metadata = map[string]string{MetaMaxJobs: "0"}
+	hosts[1].Metadata = map[string]string{MetaMaxJobs: "2"}
+	c.Assert(HostFull(&hosts[0]), Equals, false)
+	c.Assert(HostFull(&hosts[1]), Equals, true)
+
+	// full hosts are never picked, even by bin-pack
+	h := BinPack{}.PickHost(hosts, newJob("b", "web"))
+	c.Assert(h, NotNil)
+	c.Assert(h.ID, Equals, "host1")
+	c.Assert(LeastJobs{}.PickHost(hosts[1:], newJob("b", "web")), IsNil)
+}
+
+func (S) TestJobPriority(c *C) {
+	job := newJob("a", "web")
+	c.Assert(JobPriority(job), Equals, 0)
+	job.Metadata["flynn-controller.priority"] = "100"
+	c.Assert(JobPriority(job), Equals, 100)
+}
@@ -0,0 +1,210 @@
+package schedutil
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/flynn/flynn/host/types"
+)
+
+// Simulation describes an initial cluster state and a sequence of formation
+// changes to replay against a Policy.
+type Simulation struct {
+	Hosts   []host.Host        `json:"hosts"`
+	Changes []*FormationChange `json:"changes"`
+}
+
+// FormationChange sets the number of processes of each type for a formation.
+// Process types not present in Processes are scaled down to zero.
+type FormationChange struct {
+	AppID     string         `json:"app"`
+	ReleaseID string         `json:"release"`
+	Processes map[string]int `json:"processes"`
+
+	// Omni lists the omnipresent process types, which are scaled per host.
+	Omni []string `json:"omni,omitempty"`
+}
+
+const (
+	ActionStart = "start"
+	ActionStop  = "stop"
+)
+
+// A Placement is a single decision made while running a Simulation.
+type Placement struct {
+	Step      int    `json:"step"`
+	Action    string `json:"action"`
+	HostID    string `json:"host_id,omitempty"`
+	JobID     string `json:"job_id,omitempty"`
+	AppID     string `json:"app"`
+	ReleaseID string `json:"release"`
+	Type      string `json:"type"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Simulate replays the formation changes in s against p and returns the
+// resulting placements along with the final state of the hosts. Like the
+// scheduler, the most recently started jobs are stopped first when scaling
+// down. The hosts in s are not modified.
+func Simulate(p Policy, s *Simulation) ([]*Placement, []host.Host) {
+	sim := &simulator{
+		policy: p,
+		hosts:  make([]host.Host, len(s.Hosts)),
+		seq:    make(map[*host.Job]int),
+	}
+	for i, h := range s.Hosts {
+		sim.hosts[i] = h
+		sim.hosts[i].Jobs = append([]*host.Job(nil), h.Jobs...)
+	}
+	for i, change := range s.Changes {
+		sim.apply(i+1, change)
+	}
+	return sim.placements, sim.hosts
+}
+
+type simulator struct {
+	policy     Policy
+	hosts      []host.Host
+	placements []*Placement
+
+	// seq records the order in which jobs were started by the simulator,
+	// jobs which are part of the initial cluster state are not present
+	seq    map[*host.Job]int
+	nextID int
+}
+
+func (s *simulator) apply(step int, change *FormationChange) {
+	omni := make(map[string]bool, len(change.Omni))
+	for _, typ := range change.Omni {
+		omni[typ] = true
+	}
+	seen := make(map[string]struct{})
+	for typ := range change.Processes {
+		seen[typ] = struct{}{}
+	}
+	for _, h := range s.hosts {
+		for _, job := range h.Jobs {
+			// ignore one-off jobs which have no type
+			if typ := job.Metadata["flynn-controller.type"]; typ != "" && isFormationJob(job, change) {
+				seen[typ] = struct{}{}
+			}
+		}
+	}
+	// process types are handled in a stable order so that simulations are
+	// reproducible
+	types := make([]string, 0, len(seen))
+	for typ := range seen {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+
+	for _, typ := range types {
+		expected := change.Processes[typ]
+		if omni[typ] {
+			for i := range s.hosts {
+				diff := expected - s.count(change, typ, s.hosts[i].ID)
+				for ; diff > 0; diff-- {
+					s.start(step, change, typ, &s.hosts[i])
+				}
+				for ; diff < 0; diff++ {
+					s.stop(step, change, typ, s.hosts[i].ID)
+				}
+			}
+			continue
+		}
+		diff := expected - s.count(change, typ, "")
+		for ; diff > 0; diff-- {
+			s.start(step, change, typ, nil)
+		}
+		for ; diff < 0; diff++ {
+			s.stop(step, change, typ, "")
+		}
+	}
+}
+
+func (s *simulator) count(change *FormationChange, typ, hostID string) int {
+	var n int
+	for _, h := range s.hosts {
+		if hostID != "" && h.ID != hostID {
+			continue
+		}
+		for _, job := range h.Jobs {
+			if isFormationJob(job, change) && job.Metadata["flynn-controller.type"] == typ {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func (s *simulator) start(step int, change *FormationChange, typ string, h *host.Host) {
+	s.nextID++
+	job := &host.Job{
+		ID: fmt.Sprintf("sim-job-%d", s.nextID),
+		Metadata: map[string]string{
+			"flynn-controller.app":     change.AppID,
+			"flynn-controller.release": change.ReleaseID,
+			"flynn-controller.type":    typ,
+		},
+	}
+	placement := &Placement{
+		Step:      step,
+		Action:    ActionStart,
+		AppID:     change.AppID,
+		ReleaseID: change.ReleaseID,
+		Type:      typ,
+	}
+	s.seq[job] = s.nextID
+	if h != nil {
+		h.Jobs = append(h.Jobs, job)
+	} else {
+		h = Place(s.policy, s.hosts, job)
+	}
+	if h == nil {
+		placement.Error = "no suitable host"
+	} else {
+		placement.HostID = h.ID
+		placement.JobID = job.ID
+	}
+	s.placements = append(s.placements, placement)
+}
+
+func (s *simulator) stop(step int, change *FormationChange, typ, hostID string) {
+	// find the most recently started job
+	var stopHost *host.Host
+	stopIndex := -1
+	var newest int
+	for i := range s.hosts {
+		h := &s.hosts[i]
+		if hostID != "" && h.ID != hostID {
+			continue
+		}
+		for j, job := range h.Jobs {
+			if !isFormationJob(job, change) || job.Metadata["flynn-controller.type"] != typ {
+				continue
+			}
+			if n := s.seq[job]; stopIndex == -1 || n > newest {
+				stopHost, stopIndex, newest = h, j, n
+			}
+		}
+	}
+	if stopHost == nil {
+		return
+	}
+	job := stopHost.Jobs[stopIndex]
+	stopHost.Jobs = append(stopHost.Jobs[:stopIndex], stopHost.Jobs[stopIndex+1:]...)
+	s.placements = append(s.placements, &Placement{
+		Step:      step,
+		Action:    ActionStop,
+		HostID:    stopHost.ID,
+		JobID:     job.ID,
+		AppID:     change.AppID,
+		ReleaseID: change.ReleaseID,
+		Type:      typ,
+	})
+}
+
+func isFormationJob(job *host.Job, change *FormationChange) bool {
+	return job.Metadata["flynn-controller.app"] == change.AppID &&
+		job.Metadata["flynn-controller.release"] == change.ReleaseID
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/flynn/flynn/router/types"
+)
+
+var (
+	ErrInvalidIPList    = errors.New("router: allow and deny lists must contain IP addresses or CIDR blocks")
+	ErrInvalidBasicAuth = errors.New("router: basic auth must be htpasswd lines with apr1 or SHA1 password hashes")
+)
+
+// basicAuthRealm is the realm clients are asked for credentials for.
+const basicAuthRealm = "Restricted"
+
+// accessControl enforces the IP allow and deny lists and the basic auth
+// credentials of a route.
+type accessControl struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+	users map[string]string // password hashes by user
+}
+
+// newAccessControl returns the access control of a route, or nil if it has
+// none.
+func newAccessControl(r *router.HTTPRoute) (*accessControl, error) {
+	if len(r.AllowIPs) == 0 && len(r.DenyIPs) == 0 && r.BasicAuth == "" {
+		return nil, nil
+	}
+	a := &accessControl{}
+	var err error
+	if a.allow, err = parseIPList(r.AllowIPs); err != nil {
+		return nil, err
+	}
+	if a.deny, err = parseIPList(r.DenyIPs); err != nil {
+		return nil, err
+	}
+	if a.users, err = parseHtpasswd(r.BasicAuth); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// parseIPList parses a list of CIDR blocks, single IP addresses are treated as
+// blocks containing only that address.
+func parseIPList(list []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(list))
+	for _, s := range list {
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, ErrInvalidIPList
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, ErrInvalidIPList
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// parseHtpasswd parses user:hash lines as written by htpasswd, ignoring blank
+// lines and comments.
+func parseHtpasswd(s string) (map[string]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	users := make(map[string]string)
+	scanner := bufio.NewScanner(strings.NewReader(s))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.Index(line, ":")
+		if i <= 0 {
+			return nil, ErrInvalidBasicAuth
+		}
+		hash := line[i+1:]
+		if !strings.HasPrefix(hash, apr1Magic) && !strings.HasPrefix(hash, sha1Prefix) {
+			return nil, ErrInvalidBasicAuth
+		}
+		users[line[:i]] = hash
+	}
+	if len(users) == 0 {
+		return nil, ErrInvalidBasicAuth
+	}
+	return users, nil
+}
+
+// AllowIP returns whether a client at addr may access the route. Denied
+// addresses are rejected, and if there is an allow list, addresses which are
+// not in it are rejected too.
+func (a *accessControl) AllowIP(addr string) bool {
+	if len(a.allow) == 0 && len(a.deny) == 0 {
+		return true
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	if containsIP(a.deny, ip) {
+		return false
+	}
+	return len(a.allow) == 0 || containsIP(a.allow, ip)
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticate returns whether a request has valid basic auth credentials, if
+// the route requires them.
+func (a *accessControl) Authenticate(req *http.Request) bool {
+	if a.users == nil {
+		return true
+	}
+	user, password, ok := req.BasicAuth()
+	if !ok {
+		return false
+	}
+	hash, ok := a.users[user]
+	return ok && checkPassword(hash, password)
+}
+
+const (
+	apr1Magic  = "$apr1$"
+	sha1Prefix = "{SHA}"
+)
+
+func checkPassword(hash, password string) bool {
+	var expected string
+	switch {
+	case strings.HasPrefix(hash, sha1Prefix):
+		sum := sha1.Sum([]byte(password))
+		expected = sha1Prefix + base64.StdEncoding.EncodeToString(sum[:])
+	case strings.HasPrefix(hash, apr1Magic):
+		salt := strings.TrimPrefix(hash, apr1Magic)
+		if i := strings.Index(salt, "$"); i != -1 {
+			salt = salt[:i]
+		}
+		expected = apr1(password, salt)
+	default:
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(expected)) == 1
+}
+
+// apr1 returns the Apache variant of the MD5 crypt hash of a password, which
+// htpasswd uses by default.
+func apr1(password, salt string) string {
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+	pw := []byte(password)
+
+	alt := md5.Sum([]byte(password + salt + password))
+	h := md5.New()
+	h.Write([]byte(password + apr1Magic + salt))
+	for i := len(pw); i > 0; i -= 16 {
+		if i > 16 {
+			h.Write(alt[:])
+		} else {
+			h.Write(alt[:i])
+		}
+	}
+	for i := len(pw); i > 0; i >>= 1 {
+		if i&1 == 1 {
+			h.Write([]byte{0})
+		} else {
+			h.Write(pw[:1])
+		}
+	}
+	sum := h.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		h := md5.New()
+		if i&1 == 1 {
+			h.Write(pw)
+		} else {
+			h.Write(sum)
+		}
+		if i%3 != 0 {
+			h.Write([]byte(salt))
+		}
+		if i%7 != 0 {
+			h.Write(pw)
+		}
+		if i&1 == 1 {
+			h.Write(sum)
+		} else {
+			h.Write(pw)
+		}
+		sum = h.Sum(nil)
+	}
+
+	const itoa64 = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	out := make([]byte, 0, 22)
+	encode := func(a, b, c byte, n int) {
+		v := uint(a)<<16 | uint(b)<<8 | uint(c)
+		for ; n > 0; n-- {
+			out = append(out, itoa64[v&0x3f])
+			v >>= 6
+		}
+	}
+	encode(sum[0], sum[6], sum[12], 4)
+	encode(sum[1], sum[7], sum[13], 4)
+	encode(sum[2], sum[8], sum[14], 4)
+	encode(sum[3], sum[9], sum[15], 4)
+	encode(sum[4], sum[10], sum[5], 4)
+	encode(0, 0, sum[11], 2)
+	return apr1Magic + salt + "$" + string(out)
+}
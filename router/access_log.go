@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"log/syslog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// accessLogEntry is the access log record of a single request, latencies are
+// in milliseconds.
+type accessLogEntry struct {
+	Time            time.Time `json:"time"`
+	RouteID         string    `json:"route_id,omitempty"`
+	Domain          string    `json:"domain"`
+	Method          string    `json:"method"`
+	Path            string    `json:"path"`
+	Status          int       `json:"status"`
+	Bytes           int64     `json:"bytes"`
+	Upstream        string    `json:"upstream,omitempty"`
+	UpstreamLatency float64   `json:"upstream_latency,omitempty"`
+	Latency         float64   `json:"latency"`
+	RequestID       string    `json:"request_id,omitempty"`
+	RemoteAddr      string    `json:"remote_addr"`
+}
+
+// accessLogger writes access log entries as lines of JSON.
+type accessLogger struct {
+	mtx sync.Mutex
+	w   io.Writer
+}
+
+// newAccessLogger returns a logger writing to dest, which is either stdout,
+// syslog for the local syslog daemon, or a remote syslog server given as
+// syslog+udp://host:port or syslog+tcp://host:port.
+func newAccessLogger(dest string) (*accessLogger, error) {
+	const priority = syslog.LOG_INFO | syslog.LOG_LOCAL0
+	switch dest {
+	case "stdout":
+		return &accessLogger{w: os.Stdout}, nil
+	case "syslog":
+		w, err := syslog.New(priority, "router")
+		if err != nil {
+			return nil, err
+		}
+		return &accessLogger{w: w}, nil
+	}
+	u, err := url.Parse(dest)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "syslog+udp", "syslog+tcp":
+		w, err := syslog.Dial(u.Scheme[len("syslog+"):], u.Host, priority, "router")
+		if err != nil {
+			return nil, err
+		}
+		return &accessLogger{w: w}, nil
+	default:
+		return nil, fmt.Errorf("router: unknown access log destination %q", dest)
+	}
+}
+
+func (l *accessLogger) Log(e *accessLogEntry) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		log.Println("access log error:", err)
+		return
+	}
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if _, err := l.w.Write(append(data, '\n')); err != nil {
+		log.Println("access log error:", err)
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// responseRecorder records the status and size of a response for the access
+// log, along with the backend the request was forwarded to.
+type responseRecorder struct {
+	http.ResponseWriter
+
+	status          int
+	bytes           int64
+	upstream        string
+	upstreamLatency time.Duration
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = 200
+	}
+	n, err := r.ResponseWriter.Write(p)
+	r.bytes += int64(n)
+	return n, err
+}
+
+func (r *responseRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("router: response does not support hijacking")
+	}
+	return h.Hijack()
+}
+
+// setUpstream records the backend a request was forwarded to and how long it
+// took to respond, if the response is being recorded for the access log.
+func setUpstream(w http.ResponseWriter, addr string, latency time.Duration) {
+	if r, ok := w.(*responseRecorder); ok {
+		r.upstream = addr
+		r.upstreamLatency = latency
+	}
+}
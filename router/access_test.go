@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+
+	. "github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-check"
+	"github.com/flynn/flynn/router/types"
+)
+
+func (s *S) TestAccessControlIPs(c *C) {
+	a, err := newAccessControl(&router.HTTPRoute{})
+	c.Assert(err, IsNil)
+	c.Assert(a, IsNil)
+
+	_, err = newAccessControl(&router.HTTPRoute{AllowIPs: []string{"10.0.0.0/33"}})
+	c.Assert(err, Equals, ErrInvalidIPList)
+
+	a, err = newAccessControl(&router.HTTPRoute{
+		AllowIPs: []string{"10.0.0.0/8", "192.168.1.1", "2001:db8::/32"},
+		DenyIPs:  []string{"10.1.0.0/16"},
+	})
+	c.Assert(err, IsNil)
+	for addr, allowed := range map[string]bool{
+		"10.0.0.1:1234":       true,
+		"10.1.0.1:1234":       false,
+		"192.168.1.1:1234":    true,
+		"192.168.1.2:1234":    false,
+		"[2001:db8::1]:1234":  true,
+		"[2001:db9::1]:1234":  false,
+		"invalid-address:123": false,
+	} {
+		c.Assert(a.AllowIP(addr), Equals, allowed, Commentf("addr = %s", addr))
+	}
+
+	a, err = newAccessControl(&router.HTTPRoute{DenyIPs: []string{"1.2.3.4"}})
+	c.Assert(err, IsNil)
+	c.Assert(a.AllowIP("1.2.3.4:1234"), Equals, false)
+	c.Assert(a.AllowIP("1.2.3.5:1234"), Equals, true)
+}
+
+func (s *S) TestAccessControlBasicAuth(c *C) {
+	_, err := newAccessControl(&router.HTTPRoute{BasicAuth: "user:plaintext"})
+	c.Assert(err, Equals, ErrInvalidBasicAuth)
+
+	a, err := newAccessControl(&router.HTTPRoute{BasicAuth: `
+# generated with htpasswd
+alice:$apr1$abcdefgh$FBwExRW4dCc8aL.OvjpIE1
+bob:$apr1$Xy1$38Tqoyai3tqsNl1B/d338/
+carol:{SHA}5en6G6MezRroT3XKqkdPOmY/BfQ=
+`})
+	c.Assert(err, IsNil)
+	c.Assert(a.AllowIP("1.2.3.4:1234"), Equals, true)
+
+	for _, t := range []struct {
+		user, password string
+		ok             bool
+	}{
+		{"alice", "password", true},
+		{"alice", "passwore", false},
+		{"bob", "a much longer password than sixteen bytes", true},
+		{"carol", "secret", true},
+		{"carol", "password", false},
+		{"dave", "password", false},
+	} {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.SetBasicAuth(t.user, t.password)
+		c.Assert(a.Authenticate(req), Equals, t.ok, Commentf("user = %s", t.user))
+	}
+	req, _ := http.NewRequest("GET", "/", nil)
+	c.Assert(a.Authenticate(req), Equals, false)
+}
@@ -0,0 +1,438 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// acmeClient obtains certificates from an ACME (RFC 8555) directory using
+// HTTP-01 challenges.
+type acmeClient struct {
+	directoryURL string
+	email        string
+	http         *http.Client
+
+	// pollInterval is how often pending authorizations and orders are
+	// checked, and pollTimeout is how long to wait for them.
+	pollInterval time.Duration
+	pollTimeout  time.Duration
+
+	mtx    sync.Mutex
+	key    *ecdsa.PrivateKey
+	kid    string // the account URL
+	dir    *acmeDirectory
+	nonces []string
+}
+
+type acmeDirectory struct {
+	NewNonce   string `json:"newNonce"`
+	NewAccount string `json:"newAccount"`
+	NewOrder   string `json:"newOrder"`
+}
+
+type acmeOrder struct {
+	Status         string       `json:"status"`
+	Authorizations []string     `json:"authorizations"`
+	Finalize       string       `json:"finalize"`
+	Certificate    string       `json:"certificate"`
+	Error          *acmeProblem `json:"error"`
+}
+
+type acmeAuthorization struct {
+	Status     string          `json:"status"`
+	Identifier acmeIdentifier  `json:"identifier"`
+	Challenges []acmeChallenge `json:"challenges"`
+}
+
+type acmeIdentifier struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type acmeChallenge struct {
+	Type   string       `json:"type"`
+	URL    string       `json:"url"`
+	Token  string       `json:"token"`
+	Status string       `json:"status"`
+	Error  *acmeProblem `json:"error"`
+}
+
+// acmeProblem is an error returned by an ACME server.
+type acmeProblem struct {
+	Type   string `json:"type"`
+	Detail string `json:"detail"`
+}
+
+func (p *acmeProblem) Error() string {
+	return fmt.Sprintf("acme: %s: %s", p.Type, p.Detail)
+}
+
+const acmeBadNonce = "urn:ietf:params:acme:error:badNonce"
+
+// acmeSolver makes the responses to HTTP-01 challenges available.
+type acmeSolver interface {
+	Present(token, keyAuth string) error
+	CleanUp(token string) error
+}
+
+func newACMEClient(directoryURL, email string, key *ecdsa.PrivateKey, client *http.Client) *acmeClient {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &acmeClient{
+		directoryURL: directoryURL,
+		email:        email,
+		http:         client,
+		key:          key,
+		pollInterval: time.Second,
+		pollTimeout:  2 * time.Minute,
+	}
+}
+
+func generateACMEKey() (*ecdsa.PrivateKey, error) {
+	return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+}
+
+// Register creates an account for the key of the client, or finds the existing
+// one, returning its URL.
+func (c *acmeClient) Register() (string, error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if err := c.discover(); err != nil {
+		return "", err
+	}
+	req := map[string]interface{}{"termsOfServiceAgreed": true}
+	if c.email != "" {
+		req["contact"] = []string{"mailto:" + c.email}
+	}
+	header, err := c.post(c.dir.NewAccount, req, nil)
+	if err != nil {
+		return "", err
+	}
+	c.kid = header.Get("Location")
+	if c.kid == "" {
+		return "", errors.New("acme: account has no URL")
+	}
+	return c.kid, nil
+}
+
+// Obtain returns a new certificate chain for domain and its private key, both
+// PEM encoded.
+func (c *acmeClient) Obtain(domain string, solver acmeSolver) (certPEM, keyPEM []byte, err error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if err := c.discover(); err != nil {
+		return nil, nil, err
+	}
+	if c.kid == "" {
+		return nil, nil, errors.New("acme: account is not registered")
+	}
+
+	var order acmeOrder
+	header, err := c.post(c.dir.NewOrder, map[string]interface{}{
+		"identifiers": []acmeIdentifier{{Type: "dns", Value: domain}},
+	}, &order)
+	if err != nil {
+		return nil, nil, err
+	}
+	orderURL := header.Get("Location")
+
+	for _, url := range order.Authorizations {
+		if err := c.authorize(url, solver); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := c.waitOrder(orderURL, &order, "ready", "valid"); err != nil {
+		return nil, nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: domain},
+		DNSNames: []string{domain},
+	}, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := c.post(order.Finalize, map[string]string{"csr": b64(csr)}, &order); err != nil {
+		return nil, nil, err
+	}
+	if err := c.waitOrder(orderURL, &order, "valid"); err != nil {
+		return nil, nil, err
+	}
+
+	if _, err := c.post(order.Certificate, nil, &certPEM); err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
+
+// waitOrder polls an order until it has one of the given statuses.
+func (c *acmeClient) waitOrder(url string, order *acmeOrder, statuses ...string) error {
+	return c.poll(url, order, func() (bool, error) {
+		for _, status := range statuses {
+			if order.Status == status {
+				return true, nil
+			}
+		}
+		if order.Status != "invalid" {
+			return false, nil
+		}
+		if order.Error != nil {
+			return false, order.Error
+		}
+		return false, errors.New("acme: order is invalid")
+	})
+}
+
+// authorize completes the HTTP-01 challenge of an authorization unless it is
+// already valid.
+func (c *acmeClient) authorize(url string, solver acmeSolver) error {
+	var authz acmeAuthorization
+	if _, err := c.post(url, nil, &authz); err != nil {
+		return err
+	}
+	if authz.Status == "valid" {
+		return nil
+	}
+	var challenge *acmeChallenge
+	for i, ch := range authz.Challenges {
+		if ch.Type == "http-01" {
+			challenge = &authz.Challenges[i]
+			break
+		}
+	}
+	if challenge == nil {
+		return fmt.Errorf("acme: no http-01 challenge for %s", authz.Identifier.Value)
+	}
+
+	if err := solver.Present(challenge.Token, challenge.Token+"."+c.thumbprint()); err != nil {
+		return err
+	}
+	defer solver.CleanUp(challenge.Token)
+
+	if _, err := c.post(challenge.URL, struct{}{}, nil); err != nil {
+		return err
+	}
+	return c.poll(url, &authz, func() (bool, error) {
+		switch authz.Status {
+		case "valid":
+			return true, nil
+		case "pending", "processing":
+			return false, nil
+		}
+		for _, ch := range authz.Challenges {
+			if ch.Error != nil {
+				return false, ch.Error
+			}
+		}
+		return false, fmt.Errorf("acme: authorization for %s is %s", authz.Identifier.Value, authz.Status)
+	})
+}
+
+// poll fetches url into out until done returns true or an error.
+func (c *acmeClient) poll(url string, out interface{}, done func() (bool, error)) error {
+	deadline := time.Now().Add(c.pollTimeout)
+	for {
+		if ok, err := done(); ok || err != nil {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("acme: timed out waiting for %s", url)
+		}
+		time.Sleep(c.pollInterval)
+		if _, err := c.post(url, nil, out); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *acmeClient) discover() error {
+	if c.dir != nil {
+		return nil
+	}
+	res, err := c.http.Get(c.directoryURL)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return fmt.Errorf("acme: unexpected status %d getting directory", res.StatusCode)
+	}
+	dir := &acmeDirectory{}
+	if err := json.NewDecoder(res.Body).Decode(dir); err != nil {
+		return err
+	}
+	c.dir = dir
+	return nil
+}
+
+func (c *acmeClient) nonce() (string, error) {
+	if n := len(c.nonces); n > 0 {
+		nonce := c.nonces[n-1]
+		c.nonces = c.nonces[:n-1]
+		return nonce, nil
+	}
+	res, err := c.http.Head(c.dir.NewNonce)
+	if err != nil {
+		return "", err
+	}
+	res.Body.Close()
+	nonce := res.Header.Get("Replay-Nonce")
+	if nonce == "" {
+		return "", errors.New("acme: server did not return a nonce")
+	}
+	return nonce, nil
+}
+
+// post sends a JWS signed request with payload, or a POST-as-GET request if
+// payload is nil, returning the response headers. A JSON response is decoded
+// into out unless it is nil or a *[]byte, which is set to the raw response.
+// Requests rejected because of a bad nonce are retried once.
+func (c *acmeClient) post(url string, payload, out interface{}) (http.Header, error) {
+	header, data, err := c.postOnce(url, payload)
+	if p, ok := err.(*acmeProblem); ok && p.Type == acmeBadNonce {
+		header, data, err = c.postOnce(url, payload)
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch out := out.(type) {
+	case nil:
+	case *[]byte:
+		*out = data
+	default:
+		err = json.Unmarshal(data, out)
+	}
+	return header, err
+}
+
+func (c *acmeClient) postOnce(url string, payload interface{}) (http.Header, []byte, error) {
+	body, err := c.sign(url, payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	res, err := c.http.Post(url, "application/jose+json", bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+	if nonce := res.Header.Get("Replay-Nonce"); nonce != "" {
+		c.nonces = append(c.nonces, nonce)
+	}
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	if res.StatusCode >= 400 {
+		p := &acmeProblem{}
+		if err := json.Unmarshal(data, p); err != nil || p.Type == "" {
+			return nil, nil, fmt.Errorf("acme: unexpected status %d from %s", res.StatusCode, url)
+		}
+		return nil, nil, p
+	}
+	return res.Header, data, nil
+}
+
+// sign returns a flattened JWS of payload signed with ES256.
+func (c *acmeClient) sign(url string, payload interface{}) ([]byte, error) {
+	nonce, err := c.nonce()
+	if err != nil {
+		return nil, err
+	}
+	protected := map[string]interface{}{
+		"alg":   "ES256",
+		"nonce": nonce,
+		"url":   url,
+	}
+	if c.kid != "" {
+		protected["kid"] = c.kid
+	} else {
+		protected["jwk"] = c.jwk()
+	}
+	header, err := json.Marshal(protected)
+	if err != nil {
+		return nil, err
+	}
+	var data []byte
+	if payload != nil {
+		if data, err = json.Marshal(payload); err != nil {
+			return nil, err
+		}
+	}
+
+	signingInput := b64(header) + "." + b64(data)
+	digest := sha256.Sum256([]byte(signingInput))
+	r, s, err := ecdsa.Sign(rand.Reader, c.key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	sig := make([]byte, 64)
+	copyPadded(sig[:32], r)
+	copyPadded(sig[32:], s)
+
+	return json.Marshal(map[string]string{
+		"protected": b64(header),
+		"payload":   b64(data),
+		"signature": b64(sig),
+	})
+}
+
+func copyPadded(dst []byte, n *big.Int) {
+	b := n.Bytes()
+	copy(dst[len(dst)-len(b):], b)
+}
+
+// jwk returns the JSON web key of the account key, with its members in the
+// lexical order needed for its thumbprint.
+func (c *acmeClient) jwk() map[string]string {
+	size := (c.key.Curve.Params().BitSize + 7) / 8
+	x, y := make([]byte, size), make([]byte, size)
+	copyPadded(x, c.key.X)
+	copyPadded(y, c.key.Y)
+	return map[string]string{
+		"crv": "P-256",
+		"kty": "EC",
+		"x":   b64(x),
+		"y":   b64(y),
+	}
+}
+
+// thumbprint returns the RFC 7638 thumbprint of the account key, which is part
+// of challenge responses.
+func (c *acmeClient) thumbprint() string {
+	data, _ := json.Marshal(c.jwk())
+	h := crypto.SHA256.New()
+	h.Write(data)
+	return b64(h.Sum(nil))
+}
+
+// b64 encodes data with unpadded base64url, as used by JWS.
+func b64(data []byte) string {
+	return strings.TrimRight(base64.URLEncoding.EncodeToString(data), "=")
+}
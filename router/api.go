@@ -30,6 +30,7 @@ func apiHandler(rtr *Router) http.Handler {
 	r.Get("/routes", getRoutes)
 	r.Get("/routes/:route_type/:route_id", getRoute)
 	r.Delete("/routes/:route_type/:route_id", deleteRoute)
+	r.Get("/metrics", getMetrics)
 	return m
 }
 
@@ -44,7 +45,10 @@ func createRoute(req *http.Request, route router.Route, router *Router, r render
 		return
 	}
 
-	if err := l.AddRoute(&route); err != nil {
+	if err := l.AddRoute(&route); isInvalidRouteErr(err) {
+		r.JSON(400, err.Error())
+		return
+	} else if err != nil {
 		log.Println(err)
 		r.JSON(500, "unknown error")
 		return
@@ -64,7 +68,10 @@ func createOrReplaceRoute(req *http.Request, route router.Route, router *Router,
 		return
 	}
 
-	if err := l.SetRoute(&route); err != nil {
+	if err := l.SetRoute(&route); isInvalidRouteErr(err) {
+		r.JSON(400, err.Error())
+		return
+	} else if err != nil {
 		log.Println(err)
 		r.JSON(500, "unknown error")
 		return
@@ -73,6 +80,16 @@ func createOrReplaceRoute(req *http.Request, route router.Route, router *Router,
 	r.JSON(200, res)
 }
 
+// isInvalidRouteErr returns whether err is due to an invalid route config.
+func isInvalidRouteErr(err error) bool {
+	switch err {
+	case ErrInvalidServiceWeights, ErrInvalidProxyProtocol, ErrInvalidLimits,
+		ErrInvalidIPList, ErrInvalidBasicAuth, ErrAutoTLSWildcard:
+		return true
+	}
+	return false
+}
+
 func listenerFor(router *Router, typ string) Listener {
 	switch typ {
 	case "http":
@@ -177,3 +194,11 @@ func deleteRoute(params martini.Params, router *Router, r render.Render) {
 
 	r.JSON(200, "unknown error")
 }
+
+func getMetrics(w http.ResponseWriter, req *http.Request, rtr *Router) {
+	if rtr.metrics == nil {
+		http.NotFound(w, req)
+		return
+	}
+	rtr.metrics.ServeHTTP(w, req)
+}
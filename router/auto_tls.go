@@ -0,0 +1,391 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flynn/flynn/router/types"
+)
+
+var ErrAutoTLSWildcard = errors.New("router: automatic TLS is not supported for wildcard domains")
+
+const (
+	// certRenewBefore is how long before they expire certificates are
+	// renewed.
+	certRenewBefore = 30 * 24 * time.Hour
+
+	// autoTLSCheckInterval is how often certificates are checked for
+	// renewal.
+	autoTLSCheckInterval = time.Hour
+
+	// autoTLSLockTimeout is how long a router instance may spend obtaining
+	// a certificate before other instances assume it has gone and try
+	// themselves.
+	autoTLSLockTimeout = 10 * time.Minute
+
+	// autoTLSMinBackoff and autoTLSMaxBackoff bound how long to wait before
+	// trying to obtain a certificate for a domain again after a failure, so
+	// that misconfigured domains don't hit the rate limits of the ACME
+	// server. The back off doubles after each consecutive failure.
+	autoTLSMinBackoff = 10 * time.Minute
+	autoTLSMaxBackoff = 24 * time.Hour
+
+	acmeChallengePath = "/.well-known/acme-challenge/"
+)
+
+// The ACME account and pending challenges are stored as routes with these
+// types in the ACME data store.
+const (
+	acmeAccountType   = "acme-account"
+	acmeChallengeType = "acme-challenge"
+
+	acmeAccountID = "account"
+)
+
+type acmeAccountRecord struct {
+	Key string `json:"key"`
+	URL string `json:"url"`
+}
+
+type acmeChallengeRecord struct {
+	KeyAuthorization string `json:"key_authorization"`
+}
+
+// autoTLS obtains and renews certificates from an ACME directory for HTTP
+// routes with AutoTLS set. The ACME account and challenge responses are shared
+// by all router instances through a data store, so that any instance can answer
+// a challenge, and a lock for each domain ensures only one obtains each
+// certificate. Certificates are stored in the routes themselves, so every
+// instance serves them.
+type autoTLS struct {
+	client *acmeClient
+	ds     DataStore
+	locks  *etcdLocker
+	routes DataStore
+
+	// failures counts the consecutive failures to obtain a certificate for
+	// each domain, it is only used by the run goroutine
+	failures map[string]int
+
+	mtx        sync.RWMutex
+	challenges map[string]string // key authorizations by record ID
+
+	trigger chan struct{}
+	stop    chan struct{}
+}
+
+func newAutoTLS(client *acmeClient, ds DataStore, locks *etcdLocker) *autoTLS {
+	return &autoTLS{
+		client:     client,
+		ds:         ds,
+		locks:      locks,
+		failures:   make(map[string]int),
+		challenges: make(map[string]string),
+		trigger:    make(chan struct{}, 1),
+		stop:       make(chan struct{}),
+	}
+}
+
+// Start syncs the shared challenges and starts checking the certificates of
+// the routes in routes.
+func (a *autoTLS) Start(routes DataStore) error {
+	a.routes = routes
+	started := make(chan error)
+	go a.ds.Sync(&acmeSyncHandler{a: a}, started)
+	if err := <-started; err != nil {
+		return err
+	}
+	go a.run()
+	return nil
+}
+
+func (a *autoTLS) Close() {
+	close(a.stop)
+	a.ds.StopSync()
+}
+
+// Trigger checks the certificates of routes without waiting for the next
+// periodic check.
+func (a *autoTLS) Trigger() {
+	select {
+	case a.trigger <- struct{}{}:
+	default:
+	}
+}
+
+func (a *autoTLS) run() {
+	ticker := time.NewTicker(autoTLSCheckInterval)
+	defer ticker.Stop()
+	for {
+		a.renewAll()
+		select {
+		case <-a.trigger:
+		case <-ticker.C:
+		case <-a.stop:
+			return
+		}
+	}
+}
+
+// renewAll obtains certificates for routes which have none or whose
+// certificates are about to expire. Routes for the same domain with different
+// paths share a certificate.
+func (a *autoTLS) renewAll() {
+	routes, err := a.routes.List()
+	if err != nil {
+		log.Println("auto tls: error listing routes:", err)
+		return
+	}
+	domains := make(map[string][]string)
+	for _, route := range routes {
+		hr := route.HTTPRoute()
+		if hr.AutoTLS && certNeedsRenewal(hr.TLSCert) {
+			domain := strings.ToLower(hr.Domain)
+			domains[domain] = append(domains[domain], route.ID)
+		}
+	}
+	for domain, ids := range domains {
+		// the lock is held by another instance obtaining the certificate,
+		// or until the back off after a failure has passed
+		lock, err := a.locks.Lock(md5sum(domain), autoTLSLockTimeout)
+		if err != nil {
+			log.Println("auto tls: error taking lock:", err)
+			continue
+		} else if lock == nil {
+			continue
+		}
+		if err := a.obtain(domain, ids); err != nil {
+			backoff := a.backoff(domain)
+			log.Printf("auto tls: error obtaining certificate for %s, retrying in %s: %s", domain, backoff, err)
+			err = lock.Hold(backoff)
+		} else {
+			delete(a.failures, domain)
+			err = lock.Unlock()
+		}
+		if err != nil {
+			log.Println("auto tls: error releasing lock:", err)
+		}
+	}
+}
+
+// backoff records a failure to obtain a certificate for domain and returns how
+// long to wait before trying again.
+func (a *autoTLS) backoff(domain string) time.Duration {
+	a.failures[domain]++
+	backoff := autoTLSMinBackoff
+	for i := 1; i < a.failures[domain] && backoff < autoTLSMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > autoTLSMaxBackoff {
+		backoff = autoTLSMaxBackoff
+	}
+	return backoff
+}
+
+// certNeedsRenewal returns whether a PEM encoded certificate is missing,
+// invalid or about to expire.
+func certNeedsRenewal(certPEM string) bool {
+	block, _ := pem.Decode([]byte(certPEM))
+	if block == nil {
+		return true
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return true
+	}
+	return time.Now().Add(certRenewBefore).After(cert.NotAfter)
+}
+
+// obtain gets a certificate for domain and stores it in the routes with the
+// given IDs. The lock for the domain must be held.
+func (a *autoTLS) obtain(domain string, ids []string) error {
+	// another instance may have obtained the certificate since the routes
+	// were listed
+	var needed []string
+	for _, id := range ids {
+		hr, err := a.autoTLSRoute(id, domain)
+		if err != nil {
+			return err
+		}
+		if hr != nil && certNeedsRenewal(hr.TLSCert) {
+			needed = append(needed, id)
+		}
+	}
+	if len(needed) == 0 {
+		return nil
+	}
+
+	if err := a.account(); err != nil {
+		return err
+	}
+	certPEM, keyPEM, err := a.client.Obtain(domain, a)
+	if err != nil {
+		return err
+	}
+
+	// obtaining the certificate can take minutes, so get the routes again
+	// to keep any changes made meanwhile
+	for _, id := range needed {
+		hr, err := a.autoTLSRoute(id, domain)
+		if err != nil {
+			return err
+		}
+		if hr == nil {
+			continue
+		}
+		hr.TLSCert = string(certPEM)
+		hr.TLSKey = string(keyPEM)
+		if err := a.routes.Set(hr.ToRoute()); err != nil {
+			return err
+		}
+	}
+	log.Println("auto tls: obtained certificate for", domain)
+	return nil
+}
+
+// autoTLSRoute returns the route with the given ID, or nil if it has been
+// removed, no longer has AutoTLS set or is no longer for domain.
+func (a *autoTLS) autoTLSRoute(id, domain string) (*router.HTTPRoute, error) {
+	route, err := a.routes.Get(id)
+	if err == ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	hr := route.HTTPRoute()
+	if !hr.AutoTLS || !strings.EqualFold(hr.Domain, domain) {
+		return nil, nil
+	}
+	return hr, nil
+}
+
+// account loads the shared ACME account, registering one if there is none.
+func (a *autoTLS) account() error {
+	if a.client.kid != "" {
+		return nil
+	}
+	record, err := a.ds.Get(acmeAccountID)
+	if err == ErrNotFound {
+		return a.register()
+	} else if err != nil {
+		return err
+	}
+	var account acmeAccountRecord
+	if err := json.Unmarshal(*record.Config, &account); err != nil {
+		return err
+	}
+	block, _ := pem.Decode([]byte(account.Key))
+	if block == nil {
+		return errors.New("auto tls: invalid account key")
+	}
+	key, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		return err
+	}
+	a.client.key = key
+	a.client.kid = account.URL
+	return nil
+}
+
+func (a *autoTLS) register() error {
+	key, err := generateACMEKey()
+	if err != nil {
+		return err
+	}
+	a.client.key = key
+	url, err := a.client.Register()
+	if err != nil {
+		a.client.key = nil
+		return err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	err = a.ds.Add(acmeRecord(acmeAccountID, acmeAccountType, acmeAccountRecord{
+		Key: string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})),
+		URL: url,
+	}))
+	if err == ErrExists {
+		// another instance registered at the same time, use its account
+		a.client.key = nil
+		a.client.kid = ""
+		return a.account()
+	}
+	return err
+}
+
+// Present stores the response to a challenge so that every router instance
+// can answer it.
+func (a *autoTLS) Present(token, keyAuth string) error {
+	id := "challenge-" + token
+	a.mtx.Lock()
+	a.challenges[id] = keyAuth
+	a.mtx.Unlock()
+	return a.ds.Set(acmeRecord(id, acmeChallengeType, acmeChallengeRecord{KeyAuthorization: keyAuth}))
+}
+
+func (a *autoTLS) CleanUp(token string) error {
+	id := "challenge-" + token
+	a.mtx.Lock()
+	delete(a.challenges, id)
+	a.mtx.Unlock()
+	return a.ds.Remove(id)
+}
+
+// ServeChallenge answers a request for a pending challenge, returning false
+// if the request is not for one.
+func (a *autoTLS) ServeChallenge(w http.ResponseWriter, req *http.Request) bool {
+	if !strings.HasPrefix(req.URL.Path, acmeChallengePath) {
+		return false
+	}
+	a.mtx.RLock()
+	keyAuth, ok := a.challenges["challenge-"+strings.TrimPrefix(req.URL.Path, acmeChallengePath)]
+	a.mtx.RUnlock()
+	if !ok {
+		return false
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte(keyAuth))
+	return true
+}
+
+func acmeRecord(id, typ string, v interface{}) *router.Route {
+	data, _ := json.Marshal(v)
+	config := json.RawMessage(data)
+	return &router.Route{ID: id, Type: typ, Config: &config}
+}
+
+// acmeSyncHandler keeps the challenges of an autoTLS in sync with those
+// stored by other router instances.
+type acmeSyncHandler struct {
+	a *autoTLS
+}
+
+func (h *acmeSyncHandler) Set(r *router.Route) error {
+	if r.Type != acmeChallengeType || r.Config == nil {
+		return nil
+	}
+	var challenge acmeChallengeRecord
+	if err := json.Unmarshal(*r.Config, &challenge); err != nil {
+		return err
+	}
+	h.a.mtx.Lock()
+	defer h.a.mtx.Unlock()
+	h.a.challenges[r.ID] = challenge.KeyAuthorization
+	return nil
+}
+
+func (h *acmeSyncHandler) Remove(id string) error {
+	h.a.mtx.Lock()
+	defer h.a.mtx.Unlock()
+	delete(h.a.challenges, id)
+	return nil
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"time"
+
+	. "github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-check"
+	"github.com/flynn/flynn/pkg/random"
+	"github.com/flynn/flynn/router/types"
+)
+
+func generateTestCert(c *C, notAfter time.Time) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	c.Assert(err, IsNil)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func (s *S) TestCertNeedsRenewal(c *C) {
+	c.Assert(certNeedsRenewal(""), Equals, true)
+	c.Assert(certNeedsRenewal("not a certificate"), Equals, true)
+	c.Assert(certNeedsRenewal(string(localhostCert)), Equals, false)
+	c.Assert(certNeedsRenewal(generateTestCert(c, time.Now().Add(10*24*time.Hour))), Equals, true)
+	c.Assert(certNeedsRenewal(generateTestCert(c, time.Now().Add(60*24*time.Hour))), Equals, false)
+}
+
+func (s *S) TestAutoTLSServeChallenge(c *C) {
+	a := newAutoTLS(nil, nil, nil)
+	h := &acmeSyncHandler{a: a}
+
+	get := func(path string) (bool, string) {
+		req, _ := http.NewRequest("GET", "http://example.com"+path, nil)
+		res := httptest.NewRecorder()
+		return a.ServeChallenge(res, req), res.Body.String()
+	}
+
+	// challenges stored by any router instance are answered
+	c.Assert(h.Set(acmeRecord("challenge-token1", acmeChallengeType, acmeChallengeRecord{KeyAuthorization: "token1.thumbprint"})), IsNil)
+	ok, body := get(acmeChallengePath + "token1")
+	c.Assert(ok, Equals, true)
+	c.Assert(body, Equals, "token1.thumbprint")
+
+	ok, _ = get(acmeChallengePath + "token2")
+	c.Assert(ok, Equals, false)
+	ok, _ = get("/token1")
+	c.Assert(ok, Equals, false)
+
+	c.Assert(h.Remove("challenge-token1"), IsNil)
+	ok, _ = get(acmeChallengePath + "token1")
+	c.Assert(ok, Equals, false)
+}
+
+func (s *S) TestEtcdLocker(c *C) {
+	_, etcd, cleanup := setup(c, nil, nil)
+	defer cleanup()
+	locks := newEtcdLocker(etcd, "/router/test-locks/")
+
+	lock, err := locks.Lock("a", time.Minute)
+	c.Assert(err, IsNil)
+	c.Assert(lock, NotNil)
+
+	// the lock can't be taken again while it is held
+	other, err := locks.Lock("a", time.Minute)
+	c.Assert(err, IsNil)
+	c.Assert(other, IsNil)
+
+	// only the owner of the lock releases it
+	stale := &etcdLock{etcd: etcd, key: lock.key, token: "stale"}
+	c.Assert(stale.Unlock(), IsNil)
+	c.Assert(stale.Hold(time.Minute), IsNil)
+	other, err = locks.Lock("a", time.Minute)
+	c.Assert(err, IsNil)
+	c.Assert(other, IsNil)
+
+	c.Assert(lock.Hold(time.Minute), IsNil)
+	c.Assert(lock.Unlock(), IsNil)
+	other, err = locks.Lock("a", time.Minute)
+	c.Assert(err, IsNil)
+	c.Assert(other, NotNil)
+	c.Assert(other.Unlock(), IsNil)
+
+	// locks expire after their TTL
+	lock, err = locks.Lock("b", time.Second)
+	c.Assert(err, IsNil)
+	c.Assert(lock, NotNil)
+	time.Sleep(2 * time.Second)
+	other, err = locks.Lock("b", time.Minute)
+	c.Assert(err, IsNil)
+	c.Assert(other, NotNil)
+	// the expired lock no longer releases it
+	c.Assert(lock.Unlock(), IsNil)
+	lock, err = locks.Lock("b", time.Minute)
+	c.Assert(err, IsNil)
+	c.Assert(lock, IsNil)
+}
+
+func (s *S) TestAutoTLSBackoff(c *C) {
+	a := newAutoTLS(nil, nil, nil)
+	c.Assert(a.backoff("example.com"), Equals, autoTLSMinBackoff)
+	c.Assert(a.backoff("example.com"), Equals, 2*autoTLSMinBackoff)
+	c.Assert(a.backoff("example.org"), Equals, autoTLSMinBackoff)
+	for i := 0; i < 20; i++ {
+		a.backoff("example.com")
+	}
+	c.Assert(a.backoff("example.com"), Equals, autoTLSMaxBackoff)
+}
+
+// TestAutoTLSChallengeSharing checks that a challenge presented by one router
+// instance is answered over HTTP by another instance using the same etcd
+// prefix, as the ACME server may connect to either of them.
+func (s *S) TestAutoTLSChallengeSharing(c *C) {
+	dc, etcd, cleanup := setup(c, nil, nil)
+	defer cleanup()
+	pair, err := tls.X509KeyPair(localhostCert, localhostKey)
+	c.Assert(err, IsNil)
+	newListener := func() *HTTPListener {
+		l := &HTTPListener{
+			Addr:      "127.0.0.1:0",
+			TLSAddr:   "127.0.0.1:0",
+			keypair:   pair,
+			ds:        NewEtcdDataStore(etcd, "/router/http/"),
+			discoverd: dc,
+			autoTLS: newAutoTLS(
+				nil,
+				NewEtcdDataStore(etcd, "/router/acme/"),
+				newEtcdLocker(etcd, "/router/acme-locks/"),
+			),
+		}
+		c.Assert(l.Start(), IsNil)
+		return l
+	}
+	l1 := newListener()
+	defer l1.Close()
+	l2 := newListener()
+	defer l2.Close()
+
+	get := func() (int, string) {
+		req, err := http.NewRequest("GET", "http://"+l2.Addr+acmeChallengePath+"token1", nil)
+		c.Assert(err, IsNil)
+		req.Host = "example.com"
+		res, err := http.DefaultClient.Do(req)
+		c.Assert(err, IsNil)
+		defer res.Body.Close()
+		data, err := ioutil.ReadAll(res.Body)
+		c.Assert(err, IsNil)
+		return res.StatusCode, string(data)
+	}
+	waitFor := func(status int) string {
+		timeout := time.After(10 * time.Second)
+		for {
+			code, body := get()
+			if code == status {
+				return body
+			}
+			select {
+			case <-timeout:
+				c.Fatalf("timed out waiting for status %d, got %d", status, code)
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+	}
+
+	c.Assert(l1.autoTLS.Present("token1", "token1.thumbprint"), IsNil)
+	c.Assert(waitFor(200), Equals, "token1.thumbprint")
+
+	c.Assert(l1.autoTLS.CleanUp("token1"), IsNil)
+	waitFor(404)
+}
+
+// TestAutoTLS obtains a certificate from a local ACME test server such as
+// pebble, whose directory URL is given by ACME_DIRECTORY and whose CA cert file
+// is given by ACME_CA_CERT. As the test domain does not resolve to the router,
+// pebble must be run with PEBBLE_VA_ALWAYS_VALID=1.
+func (s *S) TestAutoTLS(c *C) {
+	directory := os.Getenv("ACME_DIRECTORY")
+	if directory == "" {
+		c.Skip("ACME_DIRECTORY not set")
+	}
+	client := http.DefaultClient
+	if caCert := os.Getenv("ACME_CA_CERT"); caCert != "" {
+		data, err := ioutil.ReadFile(caCert)
+		c.Assert(err, IsNil)
+		pool := x509.NewCertPool()
+		c.Assert(pool.AppendCertsFromPEM(data), Equals, true)
+		client = &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	}
+
+	dc, etcd, cleanup := setup(c, nil, nil)
+	defer cleanup()
+	pair, err := tls.X509KeyPair(localhostCert, localhostKey)
+	c.Assert(err, IsNil)
+	l := &HTTPListener{
+		Addr:      "127.0.0.1:0",
+		TLSAddr:   "127.0.0.1:0",
+		keypair:   pair,
+		ds:        NewEtcdDataStore(etcd, "/router/http/"),
+		discoverd: dc,
+		autoTLS: newAutoTLS(
+			newACMEClient(directory, "", nil, client),
+			NewEtcdDataStore(etcd, "/router/acme/"),
+			newEtcdLocker(etcd, "/router/acme-locks/"),
+		),
+	}
+	c.Assert(l.Start(), IsNil)
+	defer l.Close()
+
+	domain := random.String(8) + ".example.com"
+	r := (&router.HTTPRoute{Domain: domain, Service: "test", AutoTLS: true}).ToRoute()
+	c.Assert(l.AddRoute(r), IsNil)
+
+	// wait for the certificate to be stored in the route
+	timeout := time.After(time.Minute)
+	for {
+		route, err := l.ds.Get(r.ID)
+		c.Assert(err, IsNil)
+		if hr := route.HTTPRoute(); hr.TLSCert != "" {
+			c.Assert(certNeedsRenewal(hr.TLSCert), Equals, false)
+			break
+		}
+		select {
+		case <-timeout:
+			c.Fatal("timed out waiting for certificate")
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	// the listener serves the certificate once it has synced the route
+	timeout = time.After(10 * time.Second)
+	for {
+		conn, err := tls.Dial("tcp", l.TLSAddr, &tls.Config{ServerName: domain, InsecureSkipVerify: true})
+		c.Assert(err, IsNil)
+		certs := conn.ConnectionState().PeerCertificates
+		conn.Close()
+		if len(certs) > 0 && len(certs[0].DNSNames) == 1 && certs[0].DNSNames[0] == domain {
+			break
+		}
+		select {
+		case <-timeout:
+			c.Fatal("timed out waiting for certificate to be served")
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/flynn/flynn/Godeps/_workspace/src/github.com/coreos/go-etcd/etcd"
+	"github.com/flynn/flynn/pkg/random"
 	"github.com/flynn/flynn/router/types"
 )
 
@@ -16,6 +17,8 @@ type EtcdClient interface {
 	Set(key string, value string, ttl uint64) (*etcd.Response, error)
 	Get(key string, sort, recursive bool) (*etcd.Response, error)
 	Delete(key string, recursive bool) (*etcd.Response, error)
+	CompareAndSwap(key string, value string, ttl uint64, prevValue string, prevIndex uint64) (*etcd.Response, error)
+	CompareAndDelete(key string, prevValue string, prevIndex uint64) (*etcd.Response, error)
 	Watch(prefix string, waitIndex uint64, recursive bool, receiver chan *etcd.Response, stop chan bool) (*etcd.Response, error)
 }
 
@@ -232,3 +235,56 @@ watch:
 func (s *etcdDataStore) StopSync() {
 	close(s.stopSync)
 }
+
+// etcdLocker takes locks in etcd which expire after a TTL, so that the locks of
+// router instances which have gone are released.
+type etcdLocker struct {
+	etcd   EtcdClient
+	prefix string
+}
+
+func newEtcdLocker(etcd EtcdClient, prefix string) *etcdLocker {
+	return &etcdLocker{etcd: etcd, prefix: prefix}
+}
+
+// Lock takes the lock with the given name for ttl, returning nil if it is held
+// by another owner.
+func (l *etcdLocker) Lock(name string, ttl time.Duration) (*etcdLock, error) {
+	lock := &etcdLock{etcd: l.etcd, key: path.Join(l.prefix, name), token: random.UUID()}
+	_, err := l.etcd.Create(lock.key, lock.token, uint64(ttl/time.Second))
+	if e, ok := err.(*etcd.EtcdError); ok && e.ErrorCode == 105 {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return lock, nil
+}
+
+// etcdLock is a lock taken by an etcdLocker, its key holds a random token so
+// that it is only released by its owner.
+type etcdLock struct {
+	etcd  EtcdClient
+	key   string
+	token string
+}
+
+// Unlock releases the lock, unless it has expired.
+func (l *etcdLock) Unlock() error {
+	_, err := l.etcd.CompareAndDelete(l.key, l.token, 0)
+	return ignoreLockLost(err)
+}
+
+// Hold keeps the lock for ttl from now, unless it has expired.
+func (l *etcdLock) Hold(ttl time.Duration) error {
+	_, err := l.etcd.CompareAndSwap(l.key, l.token, uint64(ttl/time.Second), l.token, 0)
+	return ignoreLockLost(err)
+}
+
+// ignoreLockLost ignores the errors returned when a lock has expired and has
+// been deleted or taken by another owner.
+func ignoreLockLost(err error) error {
+	if e, ok := err.(*etcd.EtcdError); ok && (e.ErrorCode == 100 || e.ErrorCode == 101) {
+		return nil
+	}
+	return err
+}
@@ -14,13 +14,16 @@ type DiscoverdServiceCache interface {
 	Close() error
 }
 
-func NewDiscoverdServiceCache(s discoverd.Service) (DiscoverdServiceCache, error) {
-	d := &discoverdServiceCache{addrs: make(map[string]struct{})}
+// NewDiscoverdServiceCache returns a cache of the addresses of the instances
+// of s, calling removed if it is not nil when an instance goes down.
+func NewDiscoverdServiceCache(s discoverd.Service, removed func(addr string)) (DiscoverdServiceCache, error) {
+	d := &discoverdServiceCache{addrs: make(map[string]struct{}), removed: removed}
 	return d, d.start(s)
 }
 
 type discoverdServiceCache struct {
-	stream stream.Stream
+	stream  stream.Stream
+	removed func(addr string)
 
 	sync.RWMutex
 	addrs map[string]struct{}
@@ -47,6 +50,9 @@ func (d *discoverdServiceCache) start(s discoverd.Service) (err error) {
 				d.Lock()
 				delete(d.addrs, event.Instance.Addr)
 				d.Unlock()
+				if d.removed != nil {
+					d.removed(event.Instance.Addr)
+				}
 			case discoverd.EventKindCurrent:
 				if current != nil {
 					current <- nil
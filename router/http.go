@@ -12,6 +12,8 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"path"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -34,7 +36,7 @@ type HTTPListener struct {
 	TLSAddr string
 
 	mtx      sync.RWMutex
-	domains  map[string]*httpRoute
+	domains  map[string][]*httpRoute // sorted by descending path length
 	routes   map[string]*httpRoute
 	services map[string]*httpService
 
@@ -47,6 +49,17 @@ type HTTPListener struct {
 	closed      bool
 	cookieKey   *[32]byte
 	keypair     tls.Certificate
+	accessLog   *accessLogger
+	metrics     *routerMetrics
+
+	// proxyProtocol requires PROXY protocol headers on the HTTP and HTTPS
+	// listeners if set, for when the router is behind a load balancer which
+	// sends them.
+	proxyProtocol *proxyProtoConfig
+
+	// autoTLS obtains certificates for routes with AutoTLS set, if the
+	// router is configured with an ACME directory.
+	autoTLS *autoTLS
 }
 
 type DiscoverdClient interface {
@@ -57,11 +70,14 @@ func (s *HTTPListener) Close() error {
 	s.mtx.Lock()
 	defer s.mtx.Unlock()
 	for _, service := range s.services {
-		service.sc.Close()
+		service.close()
 	}
 	s.listener.Close()
 	s.tlsListener.Close()
 	s.ds.StopSync()
+	if s.autoTLS != nil {
+		s.autoTLS.Close()
+	}
 	s.closed = true
 	return nil
 }
@@ -81,12 +97,15 @@ func (s *HTTPListener) Start() error {
 	s.DataStoreReader = s.ds
 
 	s.routes = make(map[string]*httpRoute)
-	s.domains = make(map[string]*httpRoute)
+	s.domains = make(map[string][]*httpRoute)
 	s.services = make(map[string]*httpService)
 
 	if s.cookieKey == nil {
 		s.cookieKey = &[32]byte{}
 	}
+	if s.metrics == nil {
+		s.metrics = newRouterMetrics()
+	}
 
 	started := make(chan error)
 
@@ -110,6 +129,15 @@ func (s *HTTPListener) Start() error {
 	}
 	s.TLSAddr = s.tlsListener.Addr().String()
 
+	if s.autoTLS != nil {
+		if err := s.autoTLS.Start(s.ds); err != nil {
+			s.ds.StopSync()
+			s.listener.Close()
+			s.tlsListener.Close()
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -121,7 +149,9 @@ func (s *HTTPListener) AddRoute(r *router.Route) error {
 	if s.closed {
 		return ErrClosed
 	}
-	r.ID = md5sum(r.HTTPRoute().Domain)
+	if err := normalizeHTTPRoute(r); err != nil {
+		return err
+	}
 	return s.ds.Add(r)
 }
 
@@ -131,10 +161,74 @@ func (s *HTTPListener) SetRoute(r *router.Route) error {
 	if s.closed {
 		return ErrClosed
 	}
-	r.ID = md5sum(r.HTTPRoute().Domain)
+	if err := normalizeHTTPRoute(r); err != nil {
+		return err
+	}
+	// the API doesn't return TLS keys, so keep the key of an existing route
+	// which is updated with the same certificate, and keep the certificate
+	// of a route with automatic TLS
+	if hr := r.HTTPRoute(); hr.TLSKey == "" && (hr.TLSCert != "" || hr.AutoTLS) {
+		if existing, err := s.ds.Get(r.ID); err == nil {
+			prev := existing.HTTPRoute()
+			if hr.TLSCert == prev.TLSCert || hr.AutoTLS && hr.TLSCert == "" {
+				hr.TLSCert, hr.TLSKey = prev.TLSCert, prev.TLSKey
+				*r = *hr.ToRoute()
+			}
+		}
+	}
 	return s.ds.Set(r)
 }
 
+var ErrInvalidServiceWeights = errors.New("router: service weights must not be negative and must not all be zero")
+
+// normalizeHTTPRoute validates a route, cleans its path and sets its ID, which
+// is derived from the domain and path so that each is only routed once.
+// Routes for the root path keep the ID of a route for the whole domain.
+func normalizeHTTPRoute(r *router.Route) error {
+	hr := r.HTTPRoute()
+	if err := validateServiceWeights(hr.Services); err != nil {
+		return err
+	}
+	if err := validateLimits(hr.Limits); err != nil {
+		return err
+	}
+	if _, err := newAccessControl(hr); err != nil {
+		return err
+	}
+	if hr.AutoTLS && strings.HasPrefix(hr.Domain, "*.") {
+		return ErrAutoTLSWildcard
+	}
+	hr.Path = cleanRoutePath(hr.Path)
+	id := hr.Domain
+	if hr.Path != "/" {
+		id += hr.Path
+	}
+	*r = *hr.ToRoute()
+	r.ID = md5sum(id)
+	return nil
+}
+
+func validateServiceWeights(services []router.WeightedService) error {
+	if len(services) == 0 {
+		return nil
+	}
+	total := 0
+	for _, s := range services {
+		if s.Weight < 0 {
+			return ErrInvalidServiceWeights
+		}
+		total += s.Weight
+	}
+	if total == 0 {
+		return ErrInvalidServiceWeights
+	}
+	return nil
+}
+
+func cleanRoutePath(p string) string {
+	return path.Clean("/" + p)
+}
+
 func md5sum(data string) string {
 	digest := md5.Sum([]byte(data))
 	return hex.EncodeToString(digest[:])
@@ -155,7 +249,20 @@ type httpSyncHandler struct {
 
 func (h *httpSyncHandler) Set(data *router.Route) error {
 	route := data.HTTPRoute()
-	r := &httpRoute{HTTPRoute: route}
+	if err := validateServiceWeights(route.Services); err != nil {
+		return err
+	}
+	if err := validateLimits(route.Limits); err != nil {
+		return err
+	}
+	access, err := newAccessControl(route)
+	if err != nil {
+		return err
+	}
+	r := &httpRoute{HTTPRoute: route, limiter: newLimiter(route.Limits), access: access}
+	// routes created before paths were supported don't have one
+	r.Path = cleanRoutePath(r.Path)
+	needsCert := r.AutoTLS && certNeedsRenewal(r.TLSCert)
 
 	if r.TLSCert != "" && r.TLSKey != "" {
 		kp, err := tls.X509KeyPair([]byte(r.TLSCert), []byte(r.TLSKey))
@@ -173,27 +280,28 @@ func (h *httpSyncHandler) Set(data *router.Route) error {
 		return nil
 	}
 
-	service := h.l.services[r.Service]
-	if service != nil && service.name != r.Service {
-		service.refs--
-		if service.refs <= 0 {
-			service.sc.Close()
-			delete(h.l.services, service.name)
-		}
-		service = nil
+	weights := r.Services
+	if len(weights) == 0 {
+		weights = []router.WeightedService{{Service: r.Service, Weight: 1}}
 	}
-	if service == nil {
-		sc, err := NewDiscoverdServiceCache(h.l.discoverd.Service(r.Service))
+	for _, w := range weights {
+		service, err := h.l.getService(w.Service)
 		if err != nil {
+			h.l.releaseServices(r)
 			return err
 		}
-		service = &httpService{name: r.Service, sc: sc, cookieKey: h.l.cookieKey}
-		h.l.services[r.Service] = service
+		r.services = append(r.services, weightedService{httpService: service, weight: w.Weight})
+		r.totalWeight += w.Weight
+	}
+	if old, ok := h.l.routes[data.ID]; ok {
+		h.l.releaseServices(old)
+		h.l.removeDomainRoute(old)
 	}
-	service.refs++
-	r.service = service
 	h.l.routes[data.ID] = r
-	h.l.domains[strings.ToLower(r.Domain)] = r
+	h.l.addDomainRoute(r)
+	if needsCert && h.l.autoTLS != nil {
+		h.l.autoTLS.Trigger()
+	}
 
 	go h.l.wm.Send(&router.Event{Event: "set", ID: r.Domain})
 	return nil
@@ -210,14 +318,9 @@ func (h *httpSyncHandler) Remove(id string) error {
 		return ErrNotFound
 	}
 
-	r.service.refs--
-	if r.service.refs <= 0 {
-		r.service.sc.Close()
-		delete(h.l.services, r.service.name)
-	}
-
+	h.l.releaseServices(r)
 	delete(h.l.routes, id)
-	delete(h.l.domains, r.Domain)
+	h.l.removeDomainRoute(r)
 	go h.l.wm.Send(&router.Event{Event: "remove", ID: id})
 	return nil
 }
@@ -225,6 +328,9 @@ func (h *httpSyncHandler) Remove(id string) error {
 func (s *HTTPListener) listenAndServe(started chan<- error) {
 	var err error
 	s.listener, err = reuseport.NewReusablePortListener("tcp4", s.Addr)
+	if err == nil && s.proxyProtocol != nil {
+		s.listener = proxyProtoListener{s.listener, s.proxyProtocol}
+	}
 	started <- err
 	if err != nil {
 		return
@@ -236,6 +342,7 @@ func (s *HTTPListener) listenAndServe(started chan<- error) {
 			Proto:   "http",
 			Port:    mustPortFromAddr(s.listener.Addr().String()),
 		},
+		ConnState: s.trackConnections("http"),
 	}
 
 	// TODO: log error
@@ -259,6 +366,9 @@ func (s *HTTPListener) listenAndServeTLS(started chan<- error) {
 
 	l, err := reuseport.NewReusablePortListener("tcp4", s.TLSAddr)
 	if err == nil {
+		if s.proxyProtocol != nil {
+			l = proxyProtoListener{l, s.proxyProtocol}
+		}
 		s.tlsListener = tls.NewListener(l, tlsConfig)
 	}
 	started <- err
@@ -273,31 +383,143 @@ func (s *HTTPListener) listenAndServeTLS(started chan<- error) {
 			Proto:   "https",
 			Port:    mustPortFromAddr(s.tlsListener.Addr().String()),
 		},
+		ConnState: s.trackConnections("https"),
 	}
 
 	// TODO: log error
 	_ = server.Serve(s.tlsListener)
 }
 
+// getService returns the service with the given name, starting to watch its
+// backends if no other route uses it, and takes a reference to it.
+func (s *HTTPListener) getService(name string) (*httpService, error) {
+	service := s.services[name]
+	if service == nil {
+		sc, err := NewDiscoverdServiceCache(s.discoverd.Service(name), func(addr string) {
+			s.metrics.RemoveBackend(name, addr)
+		})
+		if err != nil {
+			return nil, err
+		}
+		service = &httpService{
+			name:       name,
+			sc:         sc,
+			quarantine: newQuarantine(name, sc.Addrs, s.metrics),
+			cookieKey:  s.cookieKey,
+			metrics:    s.metrics,
+		}
+		s.services[name] = service
+	}
+	service.refs++
+	return service, nil
+}
+
+// releaseServices drops the references a route holds to its services,
+// closing those which are no longer used.
+func (s *HTTPListener) releaseServices(r *httpRoute) {
+	for _, service := range r.services {
+		service.refs--
+		if service.refs <= 0 {
+			service.close()
+			delete(s.services, service.name)
+		}
+	}
+}
+
+// addDomainRoute adds a route to the routes of its domain, which are kept
+// sorted so that the first route matching a path has the longest prefix.
+func (s *HTTPListener) addDomainRoute(r *httpRoute) {
+	domain := strings.ToLower(r.Domain)
+	routes := append(s.domains[domain], r)
+	sort.Sort(httpRoutesByPath(routes))
+	s.domains[domain] = routes
+}
+
+func (s *HTTPListener) removeDomainRoute(r *httpRoute) {
+	domain := strings.ToLower(r.Domain)
+	routes := s.domains[domain]
+	for i, dr := range routes {
+		if dr == r {
+			routes = append(routes[:i:i], routes[i+1:]...)
+			break
+		}
+	}
+	if len(routes) == 0 {
+		delete(s.domains, domain)
+		return
+	}
+	s.domains[domain] = routes
+}
+
+type httpRoutesByPath []*httpRoute
+
+func (p httpRoutesByPath) Len() int           { return len(p) }
+func (p httpRoutesByPath) Less(i, j int) bool { return len(p[i].Path) > len(p[j].Path) }
+func (p httpRoutesByPath) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+
+// trackConnections returns a connection state hook which counts the open
+// client connections of a listener, hijacked connections are counted as
+// upgraded connections once they have been proxied.
+func (s *HTTPListener) trackConnections(listener string) func(net.Conn, http.ConnState) {
+	return func(conn net.Conn, state http.ConnState) {
+		switch state {
+		case http.StateNew:
+			s.metrics.httpConnections.Add(1, listener)
+		case http.StateHijacked, http.StateClosed:
+			s.metrics.httpConnections.Add(-1, listener)
+		}
+	}
+}
+
+// findRoute returns the route with the longest path prefix matching path in
+// the most specific domain matching host which has one.
+func (s *HTTPListener) findRoute(host, path string) *httpRoute {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	for _, domain := range matchingDomains(host) {
+		for _, r := range s.domains[domain] {
+			if r.matchPath(path) {
+				return r
+			}
+		}
+	}
+	return nil
+}
+
+// findRouteForHost returns a route of the most specific domain matching host
+// for TLS handshakes, preferring one which has a keypair.
 func (s *HTTPListener) findRouteForHost(host string) *httpRoute {
+	s.mtx.RLock()
+	defer s.mtx.RUnlock()
+	for _, domain := range matchingDomains(host) {
+		routes := s.domains[domain]
+		if len(routes) == 0 {
+			continue
+		}
+		for _, r := range routes {
+			if r.keypair != nil {
+				return r
+			}
+		}
+		return routes[0]
+	}
+	return nil
+}
+
+// matchingDomains returns the domains which match host, from most-specific
+// to least-specific. Wildcard domains are matched up to 5 subdomains deep.
+func matchingDomains(host string) []string {
 	host = strings.ToLower(host)
 	if strings.Contains(host, ":") {
 		host, _, _ = net.SplitHostPort(host)
 	}
-	s.mtx.RLock()
-	defer s.mtx.RUnlock()
-	if backend, ok := s.domains[host]; ok {
-		return backend
-	}
-	// handle wildcard domains up to 5 subdomains deep, from most-specific to
-	// least-specific
 	d := strings.SplitN(host, ".", 5)
+	domains := make([]string, 0, len(d)+1)
+	domains = append(domains, host)
 	for i := len(d); i > 0; i-- {
-		if backend, ok := s.domains["*."+strings.Join(d[len(d)-i:], ".")]; ok {
-			return backend
-		}
+		domains = append(domains, "*."+strings.Join(d[len(d)-i:], "."))
 	}
-	return nil
+	return domains
 }
 
 func failAndClose(w http.ResponseWriter, code int) {
@@ -315,11 +537,45 @@ func fail(w http.ResponseWriter, code int) {
 const hdrUseStickySessions = "Flynn-Use-Sticky-Sessions"
 
 func (s *HTTPListener) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	r := s.findRouteForHost(req.Host)
+	r := s.findRoute(req.Host, req.URL.Path)
+	rec := &responseRecorder{ResponseWriter: w}
+	w = rec
+	defer s.requestDone(rec, req, r, req.URL.Path, time.Now())
+	// challenges are answered before access controls are applied so that
+	// routes restricted to some clients can still get certificates
+	if s.autoTLS != nil && s.autoTLS.ServeChallenge(w, req) {
+		return
+	}
 	if r == nil {
 		fail(w, 404)
 		return
 	}
+	if r.access != nil && !r.access.AllowIP(req.RemoteAddr) {
+		fail(w, 403)
+		return
+	}
+	if r.limiter != nil {
+		key := r.limiter.requestKey(req)
+		if !r.limiter.Acquire(key) {
+			s.metrics.limitedRequests.Add(1, "http/"+r.ID)
+			w.Header().Set("Retry-After", "1")
+			fail(w, 429)
+			return
+		}
+		defer r.limiter.Release(key)
+	}
+	if r.access != nil && r.access.users != nil {
+		if !r.access.Authenticate(req) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="`+basicAuthRealm+`"`)
+			fail(w, 401)
+			return
+		}
+		// the credentials are for the router, not the backend
+		req.Header.Del("Authorization")
+	}
+	if r.StripPath && r.Path != "/" {
+		stripPathPrefix(req, r.Path)
+	}
 
 	// TODO(bgentry): find a better way to access this setting in the service
 	// where it's needed.
@@ -329,7 +585,61 @@ func (s *HTTPListener) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	}
 	req.Header.Set(hdrUseStickySessions, stickyValue)
 
-	r.service.ServeHTTP(w, req)
+	r.pickService(req).ServeHTTP(w, req)
+}
+
+// requestDone records the metrics and writes the access log entry of a
+// request once it has been served, path is the request path before any prefix
+// was stripped.
+func (s *HTTPListener) requestDone(rec *responseRecorder, req *http.Request, r *httpRoute, path string, start time.Time) {
+	duration := time.Since(start)
+	var routeID string
+	if r != nil {
+		routeID = "http/" + r.ID
+	}
+	s.metrics.ObserveRequest(routeID, rec.upstream, rec.status, duration)
+	if s.accessLog == nil {
+		return
+	}
+
+	domain := strings.ToLower(req.Host)
+	if host, _, err := net.SplitHostPort(domain); err == nil {
+		domain = host
+	}
+	s.accessLog.Log(&accessLogEntry{
+		Time:            start.UTC(),
+		RouteID:         routeID,
+		Domain:          domain,
+		Method:          req.Method,
+		Path:            path,
+		Status:          rec.status,
+		Bytes:           rec.bytes,
+		Upstream:        rec.upstream,
+		UpstreamLatency: milliseconds(rec.upstreamLatency),
+		Latency:         milliseconds(duration),
+		RequestID:       req.Header.Get("X-Request-Id"),
+		RemoteAddr:      req.RemoteAddr,
+	})
+}
+
+// stripPathPrefix removes prefix from the path of req. The request URI is
+// forwarded verbatim, so the prefix is removed from it directly if it has
+// the same escaping and it is rebuilt otherwise.
+func stripPathPrefix(req *http.Request, prefix string) {
+	req.URL.Path = trimPathPrefix(req.URL.Path, prefix)
+	if strings.HasPrefix(req.RequestURI, prefix) {
+		req.RequestURI = trimPathPrefix(req.RequestURI, prefix)
+	} else {
+		req.RequestURI = req.URL.RequestURI()
+	}
+}
+
+func trimPathPrefix(p, prefix string) string {
+	p = p[len(prefix):]
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	return p
 }
 
 // A domain served by a listener, associated TLS certs,
@@ -338,16 +648,64 @@ type httpRoute struct {
 	*router.HTTPRoute
 
 	keypair *tls.Certificate
-	service *httpService
+	limiter *limiter
+	access  *accessControl
+
+	services    []weightedService
+	totalWeight int
+}
+
+type weightedService struct {
+	*httpService
+	weight int
+}
+
+// pickService returns the service to forward a request to. Sticky requests
+// which were sent to a backend of one of the services stay on that service,
+// other requests are split between the services by weight.
+func (r *httpRoute) pickService(req *http.Request) *httpService {
+	if len(r.services) == 1 {
+		return r.services[0].httpService
+	}
+	if r.Sticky {
+		for _, s := range r.services {
+			if s.stickyCookieAddr(req) != "" {
+				return s.httpService
+			}
+		}
+	}
+	n := random.Math.Intn(r.totalWeight)
+	for _, s := range r.services {
+		if n < s.weight {
+			return s.httpService
+		}
+		n -= s.weight
+	}
+	return r.services[len(r.services)-1].httpService
+}
+
+// matchPath returns whether path is under the path prefix of the route.
+func (r *httpRoute) matchPath(path string) bool {
+	return r.Path == "/" || path == r.Path || strings.HasPrefix(path, r.Path+"/")
 }
 
 // A service definition: name, and set of backends.
 type httpService struct {
-	name string
-	sc   DiscoverdServiceCache
-	refs int
+	name       string
+	sc         DiscoverdServiceCache
+	quarantine *quarantine
+	refs       int
 
 	cookieKey *[32]byte
+	metrics   *routerMetrics
+}
+
+func (s *httpService) close() {
+	for _, addr := range s.sc.Addrs() {
+		s.metrics.RemoveBackend(s.name, addr)
+	}
+	s.sc.Close()
+	s.quarantine.Close()
 }
 
 const stickyCookie = "_backend"
@@ -404,7 +762,7 @@ func (s *httpService) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	req.Header.Set("X-Request-Start", strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10))
 	req.Header.Set("X-Request-Id", random.UUID())
 
-	addrs := shuffle(s.sc.Addrs())
+	addrs := shuffle(s.quarantine.Filter(s.sc.Addrs()))
 	if len(addrs) == 0 {
 		log.Println("no backends found")
 		fail(w, 503)
@@ -481,19 +839,24 @@ func (s *httpService) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 
 	for _, backend = range addrs {
 		// TODO: limit number of backends tried
-		// TODO: temporarily quarantine failing backends
 
 		outreq.URL.Host = backend
+		start := time.Now()
 		res, err = transport.RoundTrip(outreq)
 		if err != nil {
+			s.quarantine.Failure(backend)
 			if _, ok := err.(dialErr); ok {
 				// retry, maybe log a message about it
+				s.metrics.dialErrors.Add(1, s.name, backend)
 				continue
 			}
+			setUpstream(w, backend, time.Since(start))
 			log.Println("http: proxy error:", err)
 			fail(w, 503)
 			return
 		}
+		s.quarantine.Success(backend)
+		setUpstream(w, backend, time.Since(start))
 		defer res.Body.Close()
 		break
 	}
@@ -577,6 +940,8 @@ func (s *httpService) forwardAndProxyTCP(w http.ResponseWriter, req *http.Reques
 		upconn, err = dialer.Dial("tcp", req.URL.Host)
 		if err != nil {
 			// retry, maybe log a message about it
+			s.metrics.dialErrors.Add(1, s.name, backend)
+			s.quarantine.Failure(backend)
 			continue
 		}
 		defer upconn.Close()
@@ -588,6 +953,7 @@ func (s *httpService) forwardAndProxyTCP(w http.ResponseWriter, req *http.Reques
 		return
 	}
 
+	start := time.Now()
 	err = req.Write(upconn)
 	if err != nil {
 		log.Println("error copying request to target:", err)
@@ -599,11 +965,14 @@ func (s *httpService) forwardAndProxyTCP(w http.ResponseWriter, req *http.Reques
 	// websocket reconnections won't go to the right backend
 	upconnbr := bufio.NewReader(upconn)
 	res, err := http.ReadResponse(upconnbr, req)
+	setUpstream(w, backend, time.Since(start))
 	if err != nil {
+		s.quarantine.Failure(backend)
 		log.Println("http: proxy error:", err)
 		failAndClose(w, 503)
 		return
 	}
+	s.quarantine.Success(backend)
 	defer res.Body.Close()
 
 	respConnHdrOpts := parseConnHeader(res.Header.Get("Connection"))
@@ -641,6 +1010,8 @@ func (s *httpService) forwardAndProxyTCP(w http.ResponseWriter, req *http.Reques
 		return
 	}
 	defer downconn.Close()
+	s.metrics.upgradedConnections.Add(1, s.name)
+	defer s.metrics.upgradedConnections.Add(-1, s.name)
 
 	errc := make(chan error, 2)
 	cp := func(dst io.Writer, src io.Reader) {
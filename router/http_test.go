@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net"
@@ -250,6 +251,90 @@ func (s *S) TestWildcardRouting(c *C) {
 	assertGet(c, "http://"+l.Addr, "dev.foo.bar", "3")
 }
 
+func (s *S) TestPathRouting(c *C) {
+	srv := func(id string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Write([]byte(id + ":" + req.RequestURI))
+		}))
+	}
+	srv1, srv2, srv3 := srv("1"), srv("2"), srv("3")
+	defer srv1.Close()
+	defer srv2.Close()
+	defer srv3.Close()
+
+	l := newHTTPListener(c)
+	defer l.Close()
+
+	addRoute(c, l, (&router.HTTPRoute{
+		Domain:  "example.com",
+		Service: "1",
+	}).ToRoute())
+	addRoute(c, l, (&router.HTTPRoute{
+		Domain:  "example.com",
+		Path:    "/api/",
+		Service: "2",
+	}).ToRoute())
+	r := addRoute(c, l, (&router.HTTPRoute{
+		Domain:    "example.com",
+		Path:      "/api/v2",
+		StripPath: true,
+		Service:   "3",
+	}).ToRoute())
+
+	discoverdRegisterHTTPService(c, l, "1", srv1.Listener.Addr().String())
+	discoverdRegisterHTTPService(c, l, "2", srv2.Listener.Addr().String())
+	discoverdRegisterHTTPService(c, l, "3", srv3.Listener.Addr().String())
+
+	assertGet(c, "http://"+l.Addr+"/", "example.com", "1:/")
+	assertGet(c, "http://"+l.Addr+"/apis", "example.com", "1:/apis")
+	assertGet(c, "http://"+l.Addr+"/api", "example.com", "2:/api")
+	assertGet(c, "http://"+l.Addr+"/api/v1/users", "example.com", "2:/api/v1/users")
+	assertGet(c, "http://"+l.Addr+"/api/v2", "example.com", "3:/")
+	assertGet(c, "http://"+l.Addr+"/api/v2/users?page=2", "example.com", "3:/users?page=2")
+
+	wait := waitForEvent(c, l, "remove", r.ID)
+	c.Assert(l.RemoveRoute(r.ID), IsNil)
+	wait()
+	assertGet(c, "http://"+l.Addr+"/api/v2/users", "example.com", "2:/api/v2/users")
+}
+
+type chanWriter chan []byte
+
+func (w chanWriter) Write(p []byte) (int, error) {
+	w <- append([]byte{}, p...)
+	return len(p), nil
+}
+
+func (s *S) TestAccessLog(c *C) {
+	srv := httptest.NewServer(httpTestHandler("1"))
+	defer srv.Close()
+
+	l := newHTTPListener(c)
+	defer l.Close()
+	lines := make(chanWriter, 1)
+	l.accessLog = &accessLogger{w: lines}
+
+	r := addHTTPRoute(c, l)
+	discoverdRegisterHTTP(c, l, srv.Listener.Addr().String())
+
+	assertGet(c, "http://"+l.Addr+"/foo", "example.com:80", "1")
+	var entry accessLogEntry
+	select {
+	case line := <-lines:
+		c.Assert(json.Unmarshal(line, &entry), IsNil)
+	case <-time.After(time.Second):
+		c.Fatal("timed out waiting for access log entry")
+	}
+	c.Assert(entry.RouteID, Equals, "http/"+r.ID)
+	c.Assert(entry.Domain, Equals, "example.com")
+	c.Assert(entry.Method, Equals, "GET")
+	c.Assert(entry.Path, Equals, "/foo")
+	c.Assert(entry.Status, Equals, 200)
+	c.Assert(entry.Bytes, Equals, int64(1))
+	c.Assert(entry.Upstream, Equals, srv.Listener.Addr().String())
+	c.Assert(entry.RequestID, HasLen, 32)
+}
+
 func (s *S) TestHTTPInitialSync(c *C) {
 	etcd, _, cleanup := newEtcd(c)
 	defer cleanup()
@@ -613,6 +698,139 @@ func (s *S) TestStickyHTTPRoute(c *C) {
 	}
 }
 
+func (s *S) TestWeightedHTTPRoute(c *C) {
+	srv1 := httptest.NewServer(httpTestHandler("1"))
+	srv2 := httptest.NewServer(httpTestHandler("2"))
+	defer srv1.Close()
+	defer srv2.Close()
+
+	l := newHTTPListener(c)
+	defer l.Close()
+
+	route := &router.HTTPRoute{
+		Domain:   "example.com",
+		Sticky:   true,
+		Services: []router.WeightedService{{Service: "1", Weight: 0}, {Service: "2", Weight: 1}},
+	}
+	addRoute(c, l, route.ToRoute())
+	discoverdRegisterHTTPService(c, l, "1", srv1.Listener.Addr().String())
+	discoverdRegisterHTTPService(c, l, "2", srv2.Listener.Addr().String())
+
+	cookie := assertGet(c, "http://"+l.Addr, "example.com", "2")
+	c.Assert(cookie, Not(IsNil))
+
+	// new requests move to the first service, sticky ones stay on the second
+	route.Services = []router.WeightedService{{Service: "1", Weight: 1}, {Service: "2", Weight: 0}}
+	wait := waitForEvent(c, l, "set", "")
+	c.Assert(l.SetRoute(route.ToRoute()), IsNil)
+	wait()
+	for i := 0; i < 10; i++ {
+		assertGet(c, "http://"+l.Addr, "example.com", "1")
+		assertGetCookie(c, "http://"+l.Addr, "example.com", "2", cookie)
+	}
+
+	route.Services[1].Weight = -1
+	c.Assert(l.SetRoute(route.ToRoute()), Equals, ErrInvalidServiceWeights)
+}
+
+func (s *S) TestHTTPRouteLimits(c *C) {
+	srv := httptest.NewServer(httpTestHandler("1"))
+	defer srv.Close()
+
+	l := newHTTPListener(c)
+	defer l.Close()
+
+	addRoute(c, l, (&router.HTTPRoute{
+		Domain:  "example.com",
+		Service: "test",
+		Limits:  &router.Limits{Rate: 0.01, Burst: 2, Header: "X-Client"},
+	}).ToRoute())
+	discoverdRegisterHTTP(c, l, srv.Listener.Addr().String())
+
+	get := func(client string) int {
+		req := newReq("http://"+l.Addr, "example.com")
+		req.Header.Set("X-Client", client)
+		res, err := httpClient.Do(req)
+		c.Assert(err, IsNil)
+		res.Body.Close()
+		return res.StatusCode
+	}
+	c.Assert(get("a"), Equals, 200)
+	c.Assert(get("a"), Equals, 200)
+	c.Assert(get("a"), Equals, 429)
+	c.Assert(get("b"), Equals, 200)
+}
+
+func (s *S) TestHTTPRouteAccessControl(c *C) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("1:" + req.Header.Get("Authorization")))
+	}))
+	defer srv.Close()
+
+	l := newHTTPListener(c)
+	defer l.Close()
+
+	discoverdRegisterHTTP(c, l, srv.Listener.Addr().String())
+	addRoute(c, l, (&router.HTTPRoute{
+		Domain:  "denied.example.com",
+		Service: "test",
+		DenyIPs: []string{"127.0.0.0/8"},
+	}).ToRoute())
+	addRoute(c, l, (&router.HTTPRoute{
+		Domain:    "auth.example.com",
+		Service:   "test",
+		AllowIPs:  []string{"127.0.0.1"},
+		BasicAuth: "alice:$apr1$abcdefgh$FBwExRW4dCc8aL.OvjpIE1\n",
+	}).ToRoute())
+	addRoute(c, l, (&router.HTTPRoute{
+		Domain:   "allowed.example.com",
+		Service:  "test",
+		AllowIPs: []string{"127.0.0.1"},
+	}).ToRoute())
+
+	get := func(host, user, password string) *http.Response {
+		req := newReq("http://"+l.Addr, host)
+		if user != "" {
+			req.SetBasicAuth(user, password)
+		}
+		res, err := httpClient.Do(req)
+		c.Assert(err, IsNil)
+		return res
+	}
+
+	res := get("denied.example.com", "", "")
+	res.Body.Close()
+	c.Assert(res.StatusCode, Equals, 403)
+
+	res = get("auth.example.com", "", "")
+	res.Body.Close()
+	c.Assert(res.StatusCode, Equals, 401)
+	c.Assert(res.Header.Get("WWW-Authenticate"), Equals, `Basic realm="Restricted"`)
+
+	res = get("auth.example.com", "alice", "wrong")
+	res.Body.Close()
+	c.Assert(res.StatusCode, Equals, 401)
+
+	// the credentials are not passed on to the backend
+	res = get("auth.example.com", "alice", "password")
+	data, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	c.Assert(err, IsNil)
+	c.Assert(res.StatusCode, Equals, 200)
+	c.Assert(string(data), Equals, "1:")
+
+	// routes without basic auth pass the credentials on to the backend
+	req := newReq("http://"+l.Addr, "allowed.example.com")
+	req.Header.Set("Authorization", "Bearer token")
+	res, err = httpClient.Do(req)
+	c.Assert(err, IsNil)
+	data, err = ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	c.Assert(err, IsNil)
+	c.Assert(res.StatusCode, Equals, 200)
+	c.Assert(string(data), Equals, "1:Bearer token")
+}
+
 func (s *S) TestStickyHTTPRouteWebsocket(c *C) {
 	srv1 := httptest.NewServer(httpTestHandler("1"))
 	srv2 := httptest.NewServer(httpTestHandler("2"))
@@ -784,7 +1002,7 @@ func (s *S) TestClosedBackendRetriesAnotherBackend(c *C) {
 
 	req := newReq("http://"+l.Addr, "example.com")
 	// add a cookie to stick to srv1
-	stickyCookie := l.findRouteForHost("example.com").service.newStickyCookie(srv1.Listener.Addr().String())
+	stickyCookie := l.findRouteForHost("example.com").services[0].newStickyCookie(srv1.Listener.Addr().String())
 	req.AddCookie(stickyCookie)
 	res, err := newHTTPClient("example.com").Do(req)
 	c.Assert(err, IsNil)
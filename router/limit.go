@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/flynn/flynn/router/types"
+)
+
+var ErrInvalidLimits = errors.New("router: limits must not be negative")
+
+func validateLimits(l *router.Limits) error {
+	if l != nil && (l.Rate < 0 || l.Burst < 0 || l.MaxConns < 0) {
+		return ErrInvalidLimits
+	}
+	return nil
+}
+
+// limiterSweepInterval is how often clients which are no longer limited are
+// forgotten.
+const limiterSweepInterval = time.Minute
+
+// limiter enforces the limits of a route on each of its clients, using a token
+// bucket for the rate limit.
+type limiter struct {
+	rate     float64
+	burst    float64
+	maxConns int
+	header   string
+
+	mtx       sync.Mutex
+	clients   map[string]*clientLimit
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type clientLimit struct {
+	tokens  float64
+	updated time.Time
+	conns   int
+}
+
+// newLimiter returns a limiter for limits, or nil if there are none.
+func newLimiter(l *router.Limits) *limiter {
+	if l == nil || (l.Rate == 0 && l.MaxConns == 0) {
+		return nil
+	}
+	burst := float64(l.Burst)
+	if burst == 0 {
+		burst = math.Max(1, math.Ceil(l.Rate))
+	}
+	return &limiter{
+		rate:     l.Rate,
+		burst:    burst,
+		maxConns: l.MaxConns,
+		header:   l.Header,
+		clients:  make(map[string]*clientLimit),
+		now:      time.Now,
+	}
+}
+
+// requestKey returns the key identifying the client of a request.
+func (l *limiter) requestKey(req *http.Request) string {
+	if l.header != "" {
+		if v := req.Header.Get(l.header); v != "" {
+			return l.header + ":" + v
+		}
+	}
+	return addrKey(req.RemoteAddr)
+}
+
+// addrKey returns the key identifying a client by its IP address.
+func addrKey(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// Acquire takes a request or connection from the allowance of a client,
+// returning false if the client is over its limits. Release must be called
+// once an acquired request or connection is done.
+func (l *limiter) Acquire(key string) bool {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) > limiterSweepInterval {
+		l.sweep(now)
+	}
+	c, ok := l.clients[key]
+	if !ok {
+		c = &clientLimit{tokens: l.burst, updated: now}
+		l.clients[key] = c
+	}
+	if l.maxConns > 0 && c.conns >= l.maxConns {
+		return false
+	}
+	if l.rate > 0 {
+		l.refill(c, now)
+		if c.tokens < 1 {
+			return false
+		}
+		c.tokens--
+	}
+	c.conns++
+	return true
+}
+
+// Release returns a request or connection taken with Acquire.
+func (l *limiter) Release(key string) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if c, ok := l.clients[key]; ok && c.conns > 0 {
+		c.conns--
+	}
+}
+
+func (l *limiter) refill(c *clientLimit, now time.Time) {
+	c.tokens = math.Min(l.burst, c.tokens+now.Sub(c.updated).Seconds()*l.rate)
+	c.updated = now
+}
+
+// sweep forgets clients which have no open requests or connections and whose
+// buckets have refilled, so they would be tracked from scratch anyway.
+func (l *limiter) sweep(now time.Time) {
+	for key, c := range l.clients {
+		if c.conns > 0 {
+			continue
+		}
+		if l.rate > 0 {
+			l.refill(c, now)
+			if c.tokens < l.burst {
+				continue
+			}
+		}
+		delete(l.clients, key)
+	}
+	l.lastSweep = now
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	. "github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-check"
+	"github.com/flynn/flynn/router/types"
+)
+
+func (s *S) TestLimiter(c *C) {
+	c.Assert(newLimiter(nil), IsNil)
+	c.Assert(newLimiter(&router.Limits{Header: "X-Client"}), IsNil)
+
+	now := time.Unix(0, 0)
+	l := newLimiter(&router.Limits{Rate: 2, Burst: 3})
+	l.now = func() time.Time { return now }
+
+	// the burst is allowed at once, then requests are limited to the rate
+	for i := 0; i < 3; i++ {
+		c.Assert(l.Acquire("a"), Equals, true)
+		l.Release("a")
+	}
+	c.Assert(l.Acquire("a"), Equals, false)
+	c.Assert(l.Acquire("b"), Equals, true)
+	l.Release("b")
+	now = now.Add(500 * time.Millisecond)
+	c.Assert(l.Acquire("a"), Equals, true)
+	l.Release("a")
+	c.Assert(l.Acquire("a"), Equals, false)
+
+	// idle clients are forgotten once their buckets have refilled
+	now = now.Add(2 * limiterSweepInterval)
+	c.Assert(l.Acquire("c"), Equals, true)
+	c.Assert(l.clients, HasLen, 1)
+
+	// concurrent requests are limited until they are released
+	l = newLimiter(&router.Limits{MaxConns: 2})
+	c.Assert(l.Acquire("a"), Equals, true)
+	c.Assert(l.Acquire("a"), Equals, true)
+	c.Assert(l.Acquire("a"), Equals, false)
+	l.Release("a")
+	c.Assert(l.Acquire("a"), Equals, true)
+}
+
+func (s *S) TestLimiterRequestKey(c *C) {
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "1.2.3.4:5678"
+
+	l := newLimiter(&router.Limits{Rate: 1})
+	c.Assert(l.requestKey(req), Equals, "1.2.3.4")
+
+	l = newLimiter(&router.Limits{Rate: 1, Header: "Authorization"})
+	c.Assert(l.requestKey(req), Equals, "1.2.3.4")
+	req.Header.Set("Authorization", "Bearer token")
+	c.Assert(l.requestKey(req), Equals, "Authorization:Bearer token")
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// routerMetrics are the metrics of the HTTP and TCP listeners, which are
+// served in the Prometheus text format.
+type routerMetrics struct {
+	httpRequests        *metricVec
+	httpRequestDuration *metricVec
+	httpConnections     *metricVec
+	upgradedConnections *metricVec
+	tcpConnections      *metricVec
+	tcpConnectionsTotal *metricVec
+	dialErrors          *metricVec
+	quarantinedBackends *metricVec
+	limitedRequests     *metricVec
+}
+
+// requestDurationBuckets are the upper bounds of the request duration
+// histogram buckets, in seconds.
+var requestDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+func newRouterMetrics() *routerMetrics {
+	return &routerMetrics{
+		httpRequests: newMetricVec("router_http_requests_total", "counter",
+			"Number of HTTP requests by route, backend and status class.", "route", "backend", "status"),
+		httpRequestDuration: newHistogramVec("router_http_request_duration_seconds",
+			"Duration of HTTP requests by route.", requestDurationBuckets, "route"),
+		httpConnections: newMetricVec("router_http_connections", "gauge",
+			"Number of open client connections by HTTP listener.", "listener"),
+		upgradedConnections: newMetricVec("router_http_upgraded_connections", "gauge",
+			"Number of open upgraded connections, such as websockets, by service.", "service"),
+		tcpConnections: newMetricVec("router_tcp_connections", "gauge",
+			"Number of open TCP connections by route.", "route"),
+		tcpConnectionsTotal: newMetricVec("router_tcp_connections_total", "counter",
+			"Number of TCP connections by route.", "route"),
+		dialErrors: newMetricVec("router_backend_dial_errors_total", "counter",
+			"Number of failed connection attempts to backends by service and backend.", "service", "backend"),
+		quarantinedBackends: newMetricVec("router_quarantined_backends", "gauge",
+			"Number of backends ejected after repeated failures by service.", "service"),
+		limitedRequests: newMetricVec("router_limited_requests_total", "counter",
+			"Number of HTTP requests and TCP connections rejected by the limits of their route.", "route"),
+	}
+}
+
+func (m *routerMetrics) vecs() []*metricVec {
+	return []*metricVec{
+		m.httpRequests,
+		m.httpRequestDuration,
+		m.httpConnections,
+		m.upgradedConnections,
+		m.tcpConnections,
+		m.tcpConnectionsTotal,
+		m.dialErrors,
+		m.quarantinedBackends,
+		m.limitedRequests,
+	}
+}
+
+// ObserveRequest records a served HTTP request.
+func (m *routerMetrics) ObserveRequest(route, backend string, status int, duration time.Duration) {
+	m.httpRequests.Add(1, route, backend, statusClass(status))
+	m.httpRequestDuration.Observe(duration.Seconds(), route)
+}
+
+// RemoveBackend deletes the series of a backend which has left service, so
+// that the series of backends which have gone don't accumulate.
+func (m *routerMetrics) RemoveBackend(service, addr string) {
+	m.httpRequests.Delete(map[string]string{"backend": addr})
+	m.dialErrors.Delete(map[string]string{"service": service, "backend": addr})
+}
+
+func statusClass(status int) string {
+	if status < 100 || status > 599 {
+		return "unknown"
+	}
+	return strconv.Itoa(status/100) + "xx"
+}
+
+func (m *routerMetrics) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	bw := bufio.NewWriter(w)
+	for _, v := range m.vecs() {
+		v.writeTo(bw)
+	}
+	bw.Flush()
+}
+
+// metricVec is a counter, gauge or histogram partitioned by label values.
+type metricVec struct {
+	name    string
+	typ     string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mtx    sync.Mutex
+	values map[string]*metricValue
+}
+
+type metricValue struct {
+	labels []string
+	value  float64
+
+	// histograms count observations in each bucket, and in total
+	buckets []uint64
+	count   uint64
+}
+
+func newMetricVec(name, typ, help string, labels ...string) *metricVec {
+	return &metricVec{
+		name:   name,
+		typ:    typ,
+		help:   help,
+		labels: labels,
+		values: make(map[string]*metricValue),
+	}
+}
+
+func newHistogramVec(name, help string, buckets []float64, labels ...string) *metricVec {
+	v := newMetricVec(name, "histogram", help, labels...)
+	v.buckets = buckets
+	return v
+}
+
+func (v *metricVec) get(labels []string) *metricValue {
+	key := strings.Join(labels, "\xff")
+	val, ok := v.values[key]
+	if !ok {
+		val = &metricValue{labels: labels}
+		if v.buckets != nil {
+			val.buckets = make([]uint64, len(v.buckets))
+		}
+		v.values[key] = val
+	}
+	return val
+}
+
+// Add adds n to a counter or gauge, a negative n decrements a gauge.
+func (v *metricVec) Add(n float64, labels ...string) {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+	v.get(labels).value += n
+}
+
+// Observe records an observation in a histogram.
+func (v *metricVec) Observe(n float64, labels ...string) {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+	val := v.get(labels)
+	for i, upper := range v.buckets {
+		if n <= upper {
+			val.buckets[i]++
+		}
+	}
+	val.count++
+	val.value += n
+}
+
+// Delete removes the series whose labels have the given values.
+func (v *metricVec) Delete(match map[string]string) {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+outer:
+	for key, val := range v.values {
+		for i, name := range v.labels {
+			if value, ok := match[name]; ok && val.labels[i] != value {
+				continue outer
+			}
+		}
+		delete(v.values, key)
+	}
+}
+
+// Value returns the value of a counter or gauge, or the sum of a histogram.
+func (v *metricVec) Value(labels ...string) float64 {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+	if val, ok := v.values[strings.Join(labels, "\xff")]; ok {
+		return val.value
+	}
+	return 0
+}
+
+func (v *metricVec) writeTo(w io.Writer) {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n", v.name, v.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.name, v.typ)
+	keys := make([]string, 0, len(v.values))
+	for k := range v.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		val := v.values[k]
+		if v.typ != "histogram" {
+			fmt.Fprintf(w, "%s%s %s\n", v.name, v.formatLabels(val.labels, "", ""), formatFloat(val.value))
+			continue
+		}
+		for i, upper := range v.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", v.name, v.formatLabels(val.labels, "le", formatFloat(upper)), val.buckets[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", v.name, v.formatLabels(val.labels, "le", "+Inf"), val.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", v.name, v.formatLabels(val.labels, "", ""), formatFloat(val.value))
+		fmt.Fprintf(w, "%s_count%s %d\n", v.name, v.formatLabels(val.labels, "", ""), val.count)
+	}
+}
+
+// formatLabels formats label values along with an optional extra label, such
+// as the upper bound of a histogram bucket.
+func (v *metricVec) formatLabels(values []string, extraName, extraValue string) string {
+	pairs := make([]string, 0, len(values)+1)
+	for i, name := range v.labels {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, name, labelEscaper.Replace(values[i])))
+	}
+	if extraName != "" {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extraName, extraValue))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	. "github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-check"
+)
+
+func (s *S) TestMetrics(c *C) {
+	m := newRouterMetrics()
+	m.ObserveRequest("http/1", "10.0.0.1:80", 200, 20*time.Millisecond)
+	m.ObserveRequest("http/1", "10.0.0.1:80", 204, 2*time.Second)
+	m.ObserveRequest("http/1", "10.0.0.2:80", 503, time.Millisecond)
+	m.tcpConnections.Add(1, "tcp/2")
+	m.dialErrors.Add(1, `a"b`, "10.0.0.3:80")
+
+	rec := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/metrics", nil)
+	m.ServeHTTP(rec, req)
+	c.Assert(rec.Code, Equals, 200)
+
+	lines := make(map[string]bool)
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		lines[line] = true
+	}
+	for _, line := range []string{
+		"# TYPE router_http_requests_total counter",
+		`router_http_requests_total{route="http/1",backend="10.0.0.1:80",status="2xx"} 2`,
+		`router_http_requests_total{route="http/1",backend="10.0.0.2:80",status="5xx"} 1`,
+		"# TYPE router_http_request_duration_seconds histogram",
+		`router_http_request_duration_seconds_bucket{route="http/1",le="0.005"} 1`,
+		`router_http_request_duration_seconds_bucket{route="http/1",le="0.025"} 2`,
+		`router_http_request_duration_seconds_bucket{route="http/1",le="+Inf"} 3`,
+		`router_http_request_duration_seconds_count{route="http/1"} 3`,
+		`router_tcp_connections{route="tcp/2"} 1`,
+		`router_backend_dial_errors_total{service="a\"b",backend="10.0.0.3:80"} 1`,
+	} {
+		c.Assert(lines[line], Equals, true, Commentf("missing %q", line))
+	}
+}
+
+func (s *S) TestMetricsRemoveBackend(c *C) {
+	m := newRouterMetrics()
+	m.ObserveRequest("http/1", "10.0.0.1:80", 200, time.Millisecond)
+	m.ObserveRequest("http/2", "10.0.0.1:80", 200, time.Millisecond)
+	m.ObserveRequest("http/1", "10.0.0.2:80", 200, time.Millisecond)
+	m.dialErrors.Add(1, "a", "10.0.0.1:80")
+	m.dialErrors.Add(1, "b", "10.0.0.1:80")
+
+	m.RemoveBackend("a", "10.0.0.1:80")
+	c.Assert(m.httpRequests.Value("http/1", "10.0.0.1:80", "2xx"), Equals, float64(0))
+	c.Assert(m.httpRequests.Value("http/2", "10.0.0.1:80", "2xx"), Equals, float64(0))
+	c.Assert(m.httpRequests.Value("http/1", "10.0.0.2:80", "2xx"), Equals, float64(1))
+	c.Assert(m.dialErrors.Value("a", "10.0.0.1:80"), Equals, float64(0))
+	c.Assert(m.dialErrors.Value("b", "10.0.0.1:80"), Equals, float64(1))
+	c.Assert(m.httpRequests.values, HasLen, 1)
+}
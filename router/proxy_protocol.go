@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Support for the HAProxy PROXY protocol, which passes the addresses of the
+// client connection through a proxy:
+// http://www.haproxy.org/download/1.5/doc/proxy-protocol.txt
+
+var ErrInvalidProxyProtocol = errors.New("router: proxy protocol version must be 1 or 2")
+
+var errInvalidProxyHeader = errors.New("router: missing or invalid PROXY protocol header")
+
+// proxyProtoV2Sig is the signature which starts a version 2 header.
+var proxyProtoV2Sig = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+const (
+	// proxyHeaderTimeout is how long to wait for a PROXY header before
+	// closing a connection.
+	proxyHeaderTimeout = 5 * time.Second
+
+	// proxyV1MaxLen is the maximum length of a version 1 header.
+	proxyV1MaxLen = 107
+)
+
+func validateProxyProtocol(version int) error {
+	if version != 0 && version != 1 && version != 2 {
+		return ErrInvalidProxyProtocol
+	}
+	return nil
+}
+
+// writeProxyHeader writes a PROXY protocol header for a connection from src to
+// dst. If the addresses are not TCP addresses of the same family, the header
+// tells the receiver to use the addresses of its own connection.
+func writeProxyHeader(w io.Writer, version int, src, dst net.Addr) error {
+	srcAddr, srcOK := src.(*net.TCPAddr)
+	dstAddr, dstOK := dst.(*net.TCPAddr)
+	var srcIP, dstIP net.IP
+	if srcOK && dstOK {
+		if srcIP, dstIP = srcAddr.IP.To4(), dstAddr.IP.To4(); srcIP == nil || dstIP == nil {
+			srcIP, dstIP = srcAddr.IP.To16(), dstAddr.IP.To16()
+		}
+	}
+	known := srcIP != nil && dstIP != nil
+
+	switch version {
+	case 1:
+		if !known {
+			_, err := io.WriteString(w, "PROXY UNKNOWN\r\n")
+			return err
+		}
+		proto := "TCP4"
+		if len(srcIP) == net.IPv6len {
+			proto = "TCP6"
+		}
+		_, err := fmt.Fprintf(w, "PROXY %s %s %s %d %d\r\n", proto, srcIP, dstIP, srcAddr.Port, dstAddr.Port)
+		return err
+	case 2:
+		var buf bytes.Buffer
+		buf.Write(proxyProtoV2Sig)
+		if !known {
+			// LOCAL command with an unspecified address family
+			buf.Write([]byte{0x20, 0x00, 0, 0})
+			_, err := w.Write(buf.Bytes())
+			return err
+		}
+		family := byte(0x11) // TCP over IPv4
+		if len(srcIP) == net.IPv6len {
+			family = 0x21 // TCP over IPv6
+		}
+		buf.Write([]byte{0x21, family})
+		binary.Write(&buf, binary.BigEndian, uint16(2*len(srcIP)+4))
+		buf.Write(srcIP)
+		buf.Write(dstIP)
+		binary.Write(&buf, binary.BigEndian, uint16(srcAddr.Port))
+		binary.Write(&buf, binary.BigEndian, uint16(dstAddr.Port))
+		_, err := w.Write(buf.Bytes())
+		return err
+	default:
+		return ErrInvalidProxyProtocol
+	}
+}
+
+// proxyProtoConfig configures which connections must start with a PROXY
+// protocol header.
+type proxyProtoConfig struct {
+	// trusted is the list of networks of the load balancers which send
+	// PROXY headers. Connections from other addresses are treated as coming
+	// directly from clients, and any header they send is not parsed. If it is
+	// empty, every connection must send a header.
+	trusted []*net.IPNet
+}
+
+func newProxyProtoConfig(trusted []string) (*proxyProtoConfig, error) {
+	nets, err := parseIPList(trusted)
+	if err != nil {
+		return nil, err
+	}
+	return &proxyProtoConfig{trusted: nets}, nil
+}
+
+// wrap returns conn wrapped to read a PROXY header if it is from a trusted
+// address.
+func (p *proxyProtoConfig) wrap(conn net.Conn) net.Conn {
+	if len(p.trusted) > 0 {
+		addr, ok := conn.RemoteAddr().(*net.TCPAddr)
+		if !ok || !containsIP(p.trusted, addr.IP) {
+			return conn
+		}
+	}
+	return newProxyProtoConn(conn)
+}
+
+// proxyProtoListener accepts connections which must start with a PROXY
+// protocol header of either version.
+type proxyProtoListener struct {
+	net.Listener
+	config *proxyProtoConfig
+}
+
+func (l proxyProtoListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return l.config.wrap(conn), nil
+}
+
+// proxyProtoConn reads a PROXY protocol header from the start of a connection
+// when it is first used, reporting the addresses from the header as its own.
+// Connections which do not start with a valid header are closed, as the
+// protocol does not allow guessing whether a header is present.
+type proxyProtoConn struct {
+	net.Conn
+	r *bufio.Reader
+
+	once   sync.Once
+	remote net.Addr
+	local  net.Addr
+	err    error
+}
+
+func newProxyProtoConn(conn net.Conn) *proxyProtoConn {
+	return &proxyProtoConn{Conn: conn, r: bufio.NewReader(conn)}
+}
+
+// Header reads the PROXY header if it has not been read yet, returning an
+// error if it is missing or invalid.
+func (c *proxyProtoConn) Header() error {
+	c.once.Do(c.readHeader)
+	return c.err
+}
+
+func (c *proxyProtoConn) Read(p []byte) (int, error) {
+	if err := c.Header(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+func (c *proxyProtoConn) RemoteAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+func (c *proxyProtoConn) LocalAddr() net.Addr {
+	c.once.Do(c.readHeader)
+	if c.local != nil {
+		return c.local
+	}
+	return c.Conn.LocalAddr()
+}
+
+func (c *proxyProtoConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface {
+		CloseWrite() error
+	}); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
+
+func (c *proxyProtoConn) readHeader() {
+	c.Conn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout))
+	defer c.Conn.SetReadDeadline(time.Time{})
+
+	b, err := c.r.Peek(1)
+	switch {
+	case err != nil:
+		c.err = err
+		if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+			c.err = errInvalidProxyHeader
+		}
+	case b[0] == 'P':
+		c.err = c.readV1Header()
+	case b[0] == '\r':
+		c.err = c.readV2Header()
+	default:
+		c.err = errInvalidProxyHeader
+	}
+	if c.err != nil {
+		c.Conn.Close()
+	}
+}
+
+func (c *proxyProtoConn) readV1Header() error {
+	if b, err := c.r.Peek(6); err != nil {
+		return errInvalidProxyHeader
+	} else if string(b) != "PROXY " {
+		return errInvalidProxyHeader
+	}
+	line, err := c.r.ReadSlice('\n')
+	if err != nil {
+		if err == bufio.ErrBufferFull {
+			return errInvalidProxyHeader
+		}
+		return err
+	}
+	if len(line) > proxyV1MaxLen || !bytes.HasSuffix(line, []byte("\r\n")) {
+		return errInvalidProxyHeader
+	}
+	fields := strings.Fields(string(line))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return errInvalidProxyHeader
+	}
+	if c.remote, err = parseProxyAddr(fields[2], fields[4]); err != nil {
+		return err
+	}
+	c.local, err = parseProxyAddr(fields[3], fields[5])
+	return err
+}
+
+func parseProxyAddr(ip, port string) (*net.TCPAddr, error) {
+	addr := &net.TCPAddr{IP: net.ParseIP(ip)}
+	if addr.IP == nil {
+		return nil, errInvalidProxyHeader
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, errInvalidProxyHeader
+	}
+	addr.Port = int(p)
+	return addr, nil
+}
+
+func (c *proxyProtoConn) readV2Header() error {
+	hdr, err := c.r.Peek(16)
+	if err != nil || !bytes.Equal(hdr[:12], proxyProtoV2Sig) {
+		return errInvalidProxyHeader
+	}
+	if hdr[12]>>4 != 2 {
+		return errInvalidProxyHeader
+	}
+	command, family := hdr[12]&0xf, hdr[13]
+	data := make([]byte, 16+int(binary.BigEndian.Uint16(hdr[14:16])))
+	if _, err := io.ReadFull(c.r, data); err != nil {
+		return err
+	}
+	data = data[16:]
+
+	// the LOCAL command, and families other than TCP, use the addresses
+	// of the connection itself
+	if command != 1 {
+		return nil
+	}
+	var ipLen int
+	switch family {
+	case 0x11:
+		ipLen = net.IPv4len
+	case 0x21:
+		ipLen = net.IPv6len
+	default:
+		return nil
+	}
+	if len(data) < 2*ipLen+4 {
+		return errInvalidProxyHeader
+	}
+	ports := data[2*ipLen:]
+	c.remote = &net.TCPAddr{
+		IP:   net.IP(data[:ipLen]),
+		Port: int(binary.BigEndian.Uint16(ports[0:2])),
+	}
+	c.local = &net.TCPAddr{
+		IP:   net.IP(data[ipLen : 2*ipLen]),
+		Port: int(binary.BigEndian.Uint16(ports[2:4])),
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+
+	. "github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-check"
+)
+
+type proxyProtoResult struct {
+	remote, local string
+	data          string
+}
+
+func newProxyProtoTestListener(c *C, config *proxyProtoConfig) (net.Listener, <-chan proxyProtoResult) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	l = proxyProtoListener{l, config}
+	results := make(chan proxyProtoResult)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			data, _ := ioutil.ReadAll(conn)
+			results <- proxyProtoResult{conn.RemoteAddr().String(), conn.LocalAddr().String(), string(data)}
+			conn.Close()
+		}
+	}()
+	return l, results
+}
+
+func (s *S) TestProxyProtocol(c *C) {
+	l, results := newProxyProtoTestListener(c, &proxyProtoConfig{})
+	defer l.Close()
+
+	for _, t := range []struct {
+		version        int
+		src, dst       string
+		expectedHeader string
+	}{
+		{
+			version:        1,
+			src:            "1.2.3.4:5678",
+			dst:            "10.0.0.1:80",
+			expectedHeader: "PROXY TCP4 1.2.3.4 10.0.0.1 5678 80\r\n",
+		},
+		{
+			version:        1,
+			src:            "[2001:db8::1]:5678",
+			dst:            "[2001:db8::2]:443",
+			expectedHeader: "PROXY TCP6 2001:db8::1 2001:db8::2 5678 443\r\n",
+		},
+		{
+			version: 2,
+			src:     "1.2.3.4:5678",
+			dst:     "10.0.0.1:80",
+		},
+		{
+			version: 2,
+			src:     "[2001:db8::1]:5678",
+			dst:     "[2001:db8::2]:443",
+		},
+	} {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		c.Assert(err, IsNil)
+		src, _ := net.ResolveTCPAddr("tcp", t.src)
+		dst, _ := net.ResolveTCPAddr("tcp", t.dst)
+		var buf bytes.Buffer
+		c.Assert(writeProxyHeader(&buf, t.version, src, dst), IsNil)
+		if t.expectedHeader != "" {
+			c.Assert(buf.String(), Equals, t.expectedHeader)
+		}
+		conn.Write(buf.Bytes())
+		conn.Write([]byte("data"))
+		conn.(*net.TCPConn).CloseWrite()
+
+		res := <-results
+		conn.Close()
+		c.Assert(res.remote, Equals, t.src)
+		c.Assert(res.local, Equals, t.dst)
+		c.Assert(res.data, Equals, "data")
+	}
+}
+
+func (s *S) TestProxyProtocolMissingHeader(c *C) {
+	l, results := newProxyProtoTestListener(c, &proxyProtoConfig{})
+	defer l.Close()
+
+	// connections without a valid header are closed without being read
+	for _, data := range []string{"data", "PROXY TCP4 1.2.3.4\r\ndata", "\r\ndata"} {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		c.Assert(err, IsNil)
+		conn.Write([]byte(data))
+		conn.(*net.TCPConn).CloseWrite()
+
+		res := <-results
+		conn.Close()
+		c.Assert(res.data, Equals, "", Commentf("data = %q", data))
+	}
+}
+
+func (s *S) TestProxyProtocolTrusted(c *C) {
+	config, err := newProxyProtoConfig([]string{"10.0.0.0/8"})
+	c.Assert(err, IsNil)
+	l, results := newProxyProtoTestListener(c, config)
+	defer l.Close()
+
+	// headers from untrusted addresses are not parsed, so they cannot
+	// spoof the address of the client
+	conn, err := net.Dial("tcp", l.Addr().String())
+	c.Assert(err, IsNil)
+	header := "PROXY TCP4 1.2.3.4 10.0.0.1 5678 80\r\n"
+	conn.Write([]byte(header + "data"))
+	conn.(*net.TCPConn).CloseWrite()
+
+	res := <-results
+	c.Assert(res.remote, Equals, conn.LocalAddr().String())
+	c.Assert(res.data, Equals, header+"data")
+	conn.Close()
+
+	_, err = newProxyProtoConfig([]string{"10.0.0.0/33"})
+	c.Assert(err, Equals, ErrInvalidIPList)
+}
+
+func (s *S) TestProxyProtocolUnknownAddrs(c *C) {
+	src := &net.UnixAddr{Name: "/tmp/a.sock", Net: "unix"}
+	var buf bytes.Buffer
+	c.Assert(writeProxyHeader(&buf, 1, src, src), IsNil)
+	c.Assert(buf.String(), Equals, "PROXY UNKNOWN\r\n")
+
+	buf.Reset()
+	c.Assert(writeProxyHeader(&buf, 2, src, src), IsNil)
+	c.Assert(buf.Bytes(), DeepEquals, append(append([]byte{}, proxyProtoV2Sig...), 0x20, 0x00, 0, 0))
+
+	c.Assert(writeProxyHeader(&buf, 3, src, src), Equals, ErrInvalidProxyProtocol)
+}
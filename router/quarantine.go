@@ -0,0 +1,171 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// quarantineThreshold is the number of consecutive failures after
+	// which a backend is ejected.
+	quarantineThreshold = 3
+
+	minQuarantineBackoff = 5 * time.Second
+	maxQuarantineBackoff = 2 * time.Minute
+)
+
+// quarantine passively checks the health of the backends of a service. A
+// backend is ejected once connecting to it or proxying to it fails
+// quarantineThreshold times in a row, and is probed with a TCP connection
+// after a back-off period which doubles each time a probe fails. It is
+// readmitted once a probe succeeds.
+type quarantine struct {
+	service string
+	addrs   func() []string
+	metrics *routerMetrics
+
+	threshold  int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	probe      func(addr string) error
+
+	mtx      sync.Mutex
+	backends map[string]*backendHealth
+	closed   bool
+}
+
+type backendHealth struct {
+	failures int
+	ejected  bool
+	backoff  time.Duration
+}
+
+// newQuarantine returns a quarantine for the backends of service, addrs
+// returns the current backends so that probes stop once a backend has gone.
+func newQuarantine(service string, addrs func() []string, metrics *routerMetrics) *quarantine {
+	return &quarantine{
+		service:    service,
+		addrs:      addrs,
+		metrics:    metrics,
+		threshold:  quarantineThreshold,
+		minBackoff: minQuarantineBackoff,
+		maxBackoff: maxQuarantineBackoff,
+		probe:      probeBackend,
+		backends:   make(map[string]*backendHealth),
+	}
+}
+
+func probeBackend(addr string) error {
+	conn, err := dialer.Dial("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// Filter returns the backends in addrs which are not ejected. If all of the
+// backends are ejected they are all returned, as an ejected backend may still
+// be better than none at all.
+func (q *quarantine) Filter(addrs []string) []string {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	if len(q.backends) == 0 {
+		return addrs
+	}
+	res := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		if b, ok := q.backends[addr]; !ok || !b.ejected {
+			res = append(res, addr)
+		}
+	}
+	if len(res) == 0 {
+		return addrs
+	}
+	return res
+}
+
+// Success resets the failure count of a backend.
+func (q *quarantine) Success(addr string) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	if b, ok := q.backends[addr]; ok && !b.ejected {
+		delete(q.backends, addr)
+	}
+}
+
+// Failure records a failed connection to a backend, ejecting it once it has
+// failed too many times in a row.
+func (q *quarantine) Failure(addr string) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	b, ok := q.backends[addr]
+	if !ok {
+		b = &backendHealth{}
+		q.backends[addr] = b
+	}
+	if b.ejected {
+		return
+	}
+	b.failures++
+	if b.failures < q.threshold || q.closed {
+		return
+	}
+	b.ejected = true
+	b.backoff = q.minBackoff
+	q.metrics.quarantinedBackends.Add(1, q.service)
+	time.AfterFunc(b.backoff, func() { q.probeEjected(addr) })
+}
+
+func (q *quarantine) probeEjected(addr string) {
+	if !q.stillExists(addr) {
+		q.readmit(addr)
+		return
+	}
+	if err := q.probe(addr); err == nil {
+		q.readmit(addr)
+		return
+	}
+
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	b, ok := q.backends[addr]
+	if !ok || q.closed {
+		return
+	}
+	b.backoff *= 2
+	if b.backoff > q.maxBackoff {
+		b.backoff = q.maxBackoff
+	}
+	time.AfterFunc(b.backoff, func() { q.probeEjected(addr) })
+}
+
+func (q *quarantine) stillExists(addr string) bool {
+	for _, a := range q.addrs() {
+		if a == addr {
+			return true
+		}
+	}
+	return false
+}
+
+func (q *quarantine) readmit(addr string) {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	if b, ok := q.backends[addr]; ok && b.ejected {
+		delete(q.backends, addr)
+		q.metrics.quarantinedBackends.Add(-1, q.service)
+	}
+}
+
+// Close stops probing ejected backends.
+func (q *quarantine) Close() {
+	q.mtx.Lock()
+	defer q.mtx.Unlock()
+	q.closed = true
+	for addr, b := range q.backends {
+		if b.ejected {
+			q.metrics.quarantinedBackends.Add(-1, q.service)
+		}
+		delete(q.backends, addr)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	. "github.com/flynn/flynn/Godeps/_workspace/src/github.com/flynn/go-check"
+)
+
+func (s *S) TestQuarantine(c *C) {
+	addrs := []string{"10.0.0.1:80", "10.0.0.2:80"}
+	var mtx sync.Mutex
+	current := addrs
+	healthy := false
+	probed := make(chan string, 10)
+
+	metrics := newRouterMetrics()
+	q := newQuarantine("test", func() []string {
+		mtx.Lock()
+		defer mtx.Unlock()
+		return current
+	}, metrics)
+	defer q.Close()
+	q.minBackoff = 10 * time.Millisecond
+	q.maxBackoff = 20 * time.Millisecond
+	q.probe = func(addr string) error {
+		defer func() { probed <- addr }()
+		mtx.Lock()
+		defer mtx.Unlock()
+		if !healthy {
+			return errors.New("connection refused")
+		}
+		return nil
+	}
+
+	// a success resets the consecutive failure count
+	q.Failure(addrs[0])
+	q.Failure(addrs[0])
+	q.Success(addrs[0])
+	q.Failure(addrs[0])
+	c.Assert(q.Filter(addrs), DeepEquals, addrs)
+
+	q.Failure(addrs[0])
+	q.Failure(addrs[0])
+	c.Assert(q.Filter(addrs), DeepEquals, addrs[1:])
+	c.Assert(metrics.quarantinedBackends.Value("test"), Equals, float64(1))
+
+	// all backends are returned when all of them are ejected
+	mtx.Lock()
+	current = addrs[:1]
+	mtx.Unlock()
+	for i := 0; i < quarantineThreshold; i++ {
+		q.Failure(addrs[1])
+	}
+	c.Assert(q.Filter(addrs), DeepEquals, addrs)
+
+	// the backend stays ejected while probes fail
+	for i := 0; i < 2; i++ {
+		select {
+		case addr := <-probed:
+			c.Assert(addr, Equals, addrs[0])
+		case <-time.After(time.Second):
+			c.Fatal("timed out waiting for probe")
+		}
+	}
+	c.Assert(q.Filter([]string{addrs[0], "10.0.0.3:80"}), DeepEquals, []string{"10.0.0.3:80"})
+
+	mtx.Lock()
+	healthy = true
+	mtx.Unlock()
+	select {
+	case <-probed:
+	case <-time.After(time.Second):
+		c.Fatal("timed out waiting for probe")
+	}
+
+	// the backend which has gone is forgotten without being probed, and the
+	// healthy one is readmitted
+	for start := time.Now(); metrics.quarantinedBackends.Value("test") != 0; time.Sleep(time.Millisecond) {
+		if time.Since(start) > time.Second {
+			c.Fatal("timed out waiting for backends to be readmitted")
+		}
+	}
+	c.Assert(q.Filter([]string{addrs[0], "10.0.0.3:80"}), DeepEquals, []string{addrs[0], "10.0.0.3:80"})
+}
@@ -2,9 +2,11 @@ package main
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/base64"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"path"
@@ -30,6 +32,9 @@ type Listener interface {
 type Router struct {
 	HTTP Listener
 	TCP  Listener
+
+	// metrics are shared by the listeners and served by the API
+	metrics *routerMetrics
 }
 
 func (s *Router) ListenAndServe(quit <-chan struct{}) error {
@@ -72,6 +77,12 @@ func main() {
 	certFile := flag.String("tlscert", "", "TLS (SSL) cert file in pem format")
 	keyFile := flag.String("tlskey", "", "TLS (SSL) key file in pem format")
 	apiAddr := flag.String("apiaddr", ":"+apiPort, "api listen address")
+	proxyProtocol := flag.Bool("proxyprotocol", false, "require PROXY protocol headers on the http, https and tcp listeners")
+	proxyTrusted := flag.String("proxyprotocol-trusted", "", "comma separated list of the CIDR blocks of load balancers which send PROXY protocol headers, connections from other addresses are treated as direct (requires -proxyprotocol)")
+	accessLogDest := flag.String("accesslog", "", "write http access logs to stdout, syslog, syslog+udp://host:port or syslog+tcp://host:port")
+	acmeDirectory := flag.String("acme-directory", "", "ACME directory URL to obtain certificates for auto_tls routes from")
+	acmeEmail := flag.String("acme-email", "", "contact email for the ACME account")
+	acmeCACert := flag.String("acme-ca-cert", "", "CA cert file in pem format to trust for the ACME directory, for testing against a local ACME server")
 	flag.Parse()
 
 	keypair := tls.Certificate{}
@@ -89,6 +100,26 @@ func main() {
 		}
 	}
 
+	var proxyConfig *proxyProtoConfig
+	if *proxyProtocol {
+		var trusted []string
+		if *proxyTrusted != "" {
+			trusted = strings.Split(*proxyTrusted, ",")
+		}
+		if proxyConfig, err = newProxyProtoConfig(trusted); err != nil {
+			shutdown.Fatal("router: -proxyprotocol-trusted must be a list of IP addresses or CIDR blocks")
+		}
+	} else if *proxyTrusted != "" {
+		shutdown.Fatal("router: -proxyprotocol-trusted requires -proxyprotocol")
+	}
+
+	var accessLog *accessLogger
+	if *accessLogDest != "" {
+		if accessLog, err = newAccessLogger(*accessLogDest); err != nil {
+			shutdown.Fatal(err)
+		}
+	}
+
 	services := map[string]string{
 		"router-api":  *apiAddr,
 		"router-http": *httpAddr,
@@ -116,21 +147,51 @@ func main() {
 	if prefix == "" {
 		prefix = "/router"
 	}
+
+	var autoTLS *autoTLS
+	if *acmeDirectory != "" {
+		client := http.DefaultClient
+		if *acmeCACert != "" {
+			pem, err := ioutil.ReadFile(*acmeCACert)
+			if err != nil {
+				shutdown.Fatal(err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				shutdown.Fatal(fmt.Errorf("router: no certificates in %s", *acmeCACert))
+			}
+			client = &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+		}
+		autoTLS = newAutoTLS(
+			newACMEClient(*acmeDirectory, *acmeEmail, nil, client),
+			NewEtcdDataStore(etcdc, path.Join(prefix, "acme/")),
+			newEtcdLocker(etcdc, path.Join(prefix, "acme-locks/")),
+		)
+	}
+
+	metrics := newRouterMetrics()
 	r := Router{
+		metrics: metrics,
 		TCP: &TCPListener{
-			IP:        *tcpIP,
-			startPort: *tcpRangeStart,
-			endPort:   *tcpRangeEnd,
-			ds:        NewEtcdDataStore(etcdc, path.Join(prefix, "tcp/")),
-			discoverd: discoverd.DefaultClient,
+			IP:            *tcpIP,
+			startPort:     *tcpRangeStart,
+			endPort:       *tcpRangeEnd,
+			proxyProtocol: proxyConfig,
+			ds:            NewEtcdDataStore(etcdc, path.Join(prefix, "tcp/")),
+			discoverd:     discoverd.DefaultClient,
+			metrics:       metrics,
 		},
 		HTTP: &HTTPListener{
-			Addr:      *httpAddr,
-			TLSAddr:   *httpsAddr,
-			cookieKey: cookieKey,
-			keypair:   keypair,
-			ds:        NewEtcdDataStore(etcdc, path.Join(prefix, "http/")),
-			discoverd: discoverd.DefaultClient,
+			Addr:          *httpAddr,
+			TLSAddr:       *httpsAddr,
+			cookieKey:     cookieKey,
+			keypair:       keypair,
+			accessLog:     accessLog,
+			proxyProtocol: proxyConfig,
+			ds:            NewEtcdDataStore(etcdc, path.Join(prefix, "http/")),
+			discoverd:     discoverd.DefaultClient,
+			metrics:       metrics,
+			autoTLS:       autoTLS,
 		},
 	}
 
@@ -19,9 +19,15 @@ type TCPListener struct {
 
 	IP string
 
+	// proxyProtocol requires PROXY protocol headers on the listeners of TCP
+	// routes if set, for when the router is behind a load balancer which
+	// sends them.
+	proxyProtocol *proxyProtoConfig
+
 	discoverd DiscoverdClient
 	ds        DataStore
 	wm        *WatchManager
+	metrics   *routerMetrics
 
 	startPort int
 	endPort   int
@@ -41,6 +47,12 @@ func (l *TCPListener) AddRoute(route *router.Route) error {
 	if l.closed {
 		return ErrClosed
 	}
+	if err := validateProxyProtocol(r.ProxyProtocol); err != nil {
+		return err
+	}
+	if err := validateLimits(r.Limits); err != nil {
+		return err
+	}
 	if r.Port == 0 {
 		return l.addWithAllocatedPort(route)
 	}
@@ -58,6 +70,12 @@ func (l *TCPListener) SetRoute(route *router.Route) error {
 	if r.Port == 0 {
 		return errors.New("router: a port number needs to be specified")
 	}
+	if err := validateProxyProtocol(r.ProxyProtocol); err != nil {
+		return err
+	}
+	if err := validateLimits(r.Limits); err != nil {
+		return err
+	}
 	route.ID = md5sum(strconv.Itoa(r.Port))
 	return l.ds.Set(route)
 }
@@ -102,6 +120,10 @@ func (l *TCPListener) Start() error {
 	}
 	l.DataStoreReader = l.ds
 
+	if l.metrics == nil {
+		l.metrics = newRouterMetrics()
+	}
+
 	l.services = make(map[string]*tcpService)
 	l.routes = make(map[string]*tcpRoute)
 	l.ports = make(map[int]*tcpRoute)
@@ -131,6 +153,9 @@ func (l *TCPListener) Close() error {
 	for _, s := range l.routes {
 		s.Close()
 	}
+	for _, s := range l.services {
+		s.close()
+	}
 	for _, listener := range l.listeners {
 		listener.Close()
 	}
@@ -148,6 +173,7 @@ func (h *tcpSyncHandler) Set(data *router.Route) error {
 		TCPRoute: route,
 		addr:     h.l.IP + ":" + strconv.Itoa(route.Port),
 		parent:   h.l,
+		limiter:  newLimiter(route.Limits),
 	}
 
 	h.l.mtx.Lock()
@@ -160,19 +186,23 @@ func (h *tcpSyncHandler) Set(data *router.Route) error {
 	if service != nil && service.name != r.Service {
 		service.refs--
 		if service.refs <= 0 {
-			service.sc.Close()
+			service.close()
 			delete(h.l.services, service.name)
 		}
 		service = nil
 	}
 	if service == nil {
-		sc, err := NewDiscoverdServiceCache(h.l.discoverd.Service(r.Service))
+		sc, err := NewDiscoverdServiceCache(h.l.discoverd.Service(r.Service), func(addr string) {
+			h.l.metrics.RemoveBackend(r.Service, addr)
+		})
 		if err != nil {
 			return err
 		}
 		service = &tcpService{
-			name: r.Service,
-			sc:   sc,
+			name:       r.Service,
+			sc:         sc,
+			quarantine: newQuarantine(r.Service, sc.Addrs, h.l.metrics),
+			metrics:    h.l.metrics,
 		}
 		h.l.services[r.Service] = service
 	}
@@ -211,7 +241,7 @@ func (h *tcpSyncHandler) Remove(id string) error {
 
 	r.service.refs--
 	if r.service.refs <= 0 {
-		r.service.sc.Close()
+		r.service.close()
 		delete(h.l.services, r.service.name)
 	}
 
@@ -227,6 +257,7 @@ type tcpRoute struct {
 	l       net.Listener
 	addr    string
 	service *tcpService
+	limiter *limiter
 	mtx     sync.RWMutex
 }
 
@@ -245,12 +276,36 @@ func (r *tcpRoute) Serve(started chan<- error) {
 		if err != nil {
 			break
 		}
+		if r.parent.proxyProtocol != nil {
+			conn = r.parent.proxyProtocol.wrap(conn)
+		}
 		r.mtx.RLock()
-		go r.service.handle(conn)
+		go r.handle(conn, r.service)
 		r.mtx.RUnlock()
 	}
 }
 
+func (r *tcpRoute) handle(conn net.Conn, service *tcpService) {
+	id := "tcp/" + r.ID
+	metrics := r.parent.metrics
+	metrics.tcpConnectionsTotal.Add(1, id)
+	if pc, ok := conn.(*proxyProtoConn); ok && pc.Header() != nil {
+		return
+	}
+	if r.limiter != nil {
+		key := addrKey(conn.RemoteAddr().String())
+		if !r.limiter.Acquire(key) {
+			metrics.limitedRequests.Add(1, id)
+			conn.Close()
+			return
+		}
+		defer r.limiter.Release(key)
+	}
+	metrics.tcpConnections.Add(1, id)
+	defer metrics.tcpConnections.Add(-1, id)
+	service.handle(conn, r.ProxyProtocol)
+}
+
 func (r *tcpRoute) Close() {
 	if r.Port >= r.parent.startPort && r.Port <= r.parent.endPort {
 		// make a copy of the fd and create a new listener with it
@@ -270,22 +325,34 @@ func (r *tcpRoute) Close() {
 }
 
 type tcpService struct {
-	name string
-	sc   DiscoverdServiceCache
-	refs int
+	name       string
+	sc         DiscoverdServiceCache
+	quarantine *quarantine
+	refs       int
+	metrics    *routerMetrics
+}
+
+func (s *tcpService) close() {
+	for _, addr := range s.sc.Addrs() {
+		s.metrics.RemoveBackend(s.name, addr)
+	}
+	s.sc.Close()
+	s.quarantine.Close()
 }
 
 func (s *tcpService) getBackend() (conn net.Conn) {
 	var err error
-	for _, addr := range shuffle(s.sc.Addrs()) {
+	for _, addr := range shuffle(s.quarantine.Filter(s.sc.Addrs())) {
 		// TODO: set deadlines
 		conn, err = net.Dial("tcp", addr)
 		if err != nil {
 			log.Println("Error connecting to TCP backend:", err)
+			s.metrics.dialErrors.Add(1, s.name, addr)
+			s.quarantine.Failure(addr)
 			// TODO: limit number of backends tried
-			// TODO: temporarily quarantine failing backends
 			continue
 		}
+		s.quarantine.Success(addr)
 		return
 	}
 	if err == nil {
@@ -296,7 +363,9 @@ func (s *tcpService) getBackend() (conn net.Conn) {
 	return
 }
 
-func (s *tcpService) handle(conn net.Conn) {
+// handle proxies a connection to a backend, first sending a PROXY protocol
+// header of the given version unless it is zero.
+func (s *tcpService) handle(conn net.Conn, proxyProtocol int) {
 	defer conn.Close()
 	backend := s.getBackend()
 	if backend == nil {
@@ -304,7 +373,12 @@ func (s *tcpService) handle(conn net.Conn) {
 	}
 	defer backend.Close()
 
-	// TODO: PROXY protocol
+	if proxyProtocol != 0 {
+		if err := writeProxyHeader(backend, proxyProtocol, conn.RemoteAddr(), conn.LocalAddr()); err != nil {
+			log.Println("Error writing PROXY header to TCP backend:", err)
+			return
+		}
+	}
 
 	done := make(chan struct{})
 	go func() {
@@ -313,7 +387,11 @@ func (s *tcpService) handle(conn net.Conn) {
 		close(done)
 	}()
 	io.Copy(conn, backend)
-	conn.(*net.TCPConn).CloseWrite()
+	conn.(closeWriter).CloseWrite()
 	<-done
 	return
 }
+
+type closeWriter interface {
+	CloseWrite() error
+}
@@ -51,6 +51,43 @@ type HTTPRoute struct {
 	TLSCert string `json:"tls_cert,omitempty"`
 	TLSKey  string `json:"tls_key,omitempty"`
 	Sticky  bool   `json:"sticky,omitempty"`
+
+	// AutoTLS obtains and renews the certificate of the route from the
+	// ACME directory the router is configured with, replacing TLSCert and
+	// TLSKey.
+	AutoTLS bool `json:"auto_tls,omitempty"`
+
+	// Path limits the route to requests for paths under the given prefix,
+	// requests are routed using the longest matching prefix of a domain.
+	Path string `json:"path,omitempty"`
+	// StripPath removes Path from the request path before the request is
+	// forwarded to the service.
+	StripPath bool `json:"strip_path,omitempty"`
+
+	// Services splits requests between several services by weight, in
+	// which case Service is ignored. Sticky requests stay on the service
+	// they were first sent to.
+	Services []WeightedService `json:"services,omitempty"`
+
+	// Limits limits the requests of each client, which is identified by
+	// its IP address or by a request header.
+	Limits *Limits `json:"limits,omitempty"`
+
+	// AllowIPs and DenyIPs are lists of CIDR blocks or IP addresses which
+	// limit the clients of the route. Requests from denied addresses, or
+	// from addresses which are not allowed if AllowIPs is set, get a 403.
+	AllowIPs []string `json:"allow_ips,omitempty"`
+	DenyIPs  []string `json:"deny_ips,omitempty"`
+	// BasicAuth is a list of credentials in htpasswd format, one
+	// user:hash line per user, which requests must have one of.
+	BasicAuth string `json:"basic_auth,omitempty"`
+}
+
+// WeightedService is a service which receives a share of the requests of a
+// route, Weight divided by the sum of the weights of all of its services.
+type WeightedService struct {
+	Service string `json:"service"`
+	Weight  int    `json:"weight"`
 }
 
 func (r *HTTPRoute) ToRoute() *Route {
@@ -70,6 +107,34 @@ type TCPRoute struct {
 	*Route  `json:"-"`
 	Port    int    `json:"port"`
 	Service string `json:"service"`
+
+	// ProxyProtocol is the version of the PROXY protocol header, 1 or 2,
+	// which is sent to backends so that they see the address of the
+	// client. No header is sent if it is zero.
+	ProxyProtocol int `json:"proxy_protocol,omitempty"`
+
+	// Limits limits the connections of each client IP address, connections
+	// over the limits are closed as soon as they are accepted.
+	Limits *Limits `json:"limits,omitempty"`
+}
+
+// Limits limit the rate of requests, or of connections for TCP routes, and the
+// number of concurrent requests or connections of each client of a route.
+// Each router instance counts them separately.
+type Limits struct {
+	// Rate is the sustained number of requests per second, no rate limit
+	// applies if it is zero.
+	Rate float64 `json:"rate,omitempty"`
+	// Burst is the number of requests which may be made at once before the
+	// rate limit applies, it defaults to Rate rounded up.
+	Burst int `json:"burst,omitempty"`
+	// MaxConns is the maximum number of concurrent requests, no limit
+	// applies if it is zero.
+	MaxConns int `json:"max_conns,omitempty"`
+	// Header identifies clients of HTTP routes by the value of a request
+	// header rather than their IP address, requests without it are
+	// identified by IP address.
+	Header string `json:"header,omitempty"`
 }
 
 func (r *TCPRoute) ToRoute() *Route {
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -96,3 +97,60 @@ func (s *HostSuite) TestNetworkedPersistentJob(t *c.C) {
 
 	t.Assert(string(body), c.Equals, "echocococo\n")
 }
+
+func (s *HostSuite) TestVolumePersistence(t *c.C) {
+	cluster := s.clusterClient(t)
+	hosts, err := cluster.ListHosts()
+	t.Assert(err, c.IsNil)
+	hostID := hosts[0].ID
+	h := s.hostClient(t, hostID)
+
+	name := "test-volume-" + random.String(8)
+	vol, err := h.CreateVolume(name)
+	t.Assert(err, c.IsNil)
+	t.Assert(vol.Name, c.Equals, name)
+	defer h.DeleteVolume(name)
+
+	// creating a volume with the same name should fail
+	_, err = h.CreateVolume(name)
+	t.Assert(err, c.NotNil)
+
+	run := func(script string) string {
+		cmd := exec.JobUsingCluster(cluster, exec.DockerImage(imageURIs["test-apps"]), &host.Job{
+			Config: host.ContainerConfig{
+				Cmd:    []string{"sh", "-c", script},
+				Mounts: []host.Mount{{Location: "/data", Volume: name, Writeable: true}},
+			},
+		})
+		cmd.HostID = hostID
+		var out bytes.Buffer
+		cmd.Stdout = &out
+		t.Assert(cmd.Run(), c.IsNil)
+		return out.String()
+	}
+
+	// data written by one job should be visible to the next
+	run("echo foo > /data/foo")
+	t.Assert(run("cat /data/foo"), c.Equals, "foo\n")
+
+	snapshot, err := h.CreateSnapshot(name)
+	t.Assert(err, c.IsNil)
+	vol, err = h.GetVolume(name)
+	t.Assert(err, c.IsNil)
+	t.Assert(vol.Snapshots, c.HasLen, 1)
+	t.Assert(vol.Snapshots[0].ID, c.Equals, snapshot.ID)
+
+	volumes, err := h.ListVolumes()
+	t.Assert(err, c.IsNil)
+	var found bool
+	for _, v := range volumes {
+		if v.Name == name {
+			found = true
+		}
+	}
+	t.Assert(found, c.Equals, true)
+
+	t.Assert(h.DeleteVolume(name), c.IsNil)
+	_, err = h.GetVolume(name)
+	t.Assert(err, c.NotNil)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
@@ -535,3 +536,184 @@ func (s *SchedulerSuite) TestTCPApp(t *c.C) {
 		t.Fatal(err)
 	}
 }
+
+func (s *SchedulerSuite) TestSchedulerAPI(t *c.C) {
+	app, release := s.createApp(t)
+
+	events := make(chan *ct.JobEvent)
+	stream, err := s.controllerClient(t).StreamJobEvents(app.ID, 0, events)
+	t.Assert(err, c.IsNil)
+	defer stream.Close()
+
+	t.Assert(s.controllerClient(t).PutFormation(&ct.Formation{
+		AppID:     app.ID,
+		ReleaseID: release.ID,
+		Processes: map[string]int{"printer": 2},
+	}), c.IsNil)
+	waitForJobEvents(t, stream, events, jobEvents{"printer": {"up": 2}})
+
+	leader, err := s.discoverdClient(t).Service("flynn-controller-scheduler").Leader()
+	t.Assert(err, c.IsNil)
+	get := func(path string, v interface{}) {
+		res, err := http.Get("http://" + leader.Addr + path)
+		t.Assert(err, c.IsNil)
+		defer res.Body.Close()
+		t.Assert(res.StatusCode, c.Equals, http.StatusOK)
+		t.Assert(json.NewDecoder(res.Body).Decode(v), c.IsNil)
+	}
+
+	var formation struct {
+		Processes map[string]struct {
+			Expected int `json:"expected"`
+			Actual   int `json:"actual"`
+		} `json:"processes"`
+	}
+	get(fmt.Sprintf("/formations/%s/%s", app.ID, release.ID), &formation)
+	t.Assert(formation.Processes["printer"].Expected, c.Equals, 2)
+	t.Assert(formation.Processes["printer"].Actual, c.Equals, 2)
+
+	var decisions []struct {
+		AppID string `json:"app"`
+		Type  string `json:"type"`
+		Diff  int    `json:"diff"`
+	}
+	get("/rectify", &decisions)
+	var found bool
+	for _, d := range decisions {
+		if d.AppID == app.ID && d.Type == "printer" && d.Diff == 2 {
+			found = true
+			break
+		}
+	}
+	t.Assert(found, c.Equals, true)
+
+	var hosts []struct {
+		ID string `json:"id"`
+	}
+	get("/hosts", &hosts)
+	t.Assert(len(hosts) > 0, c.Equals, true)
+}
+
+func (s *SchedulerSuite) TestSchedulerFailover(t *c.C) {
+	app, release := s.createApp(t)
+	client := s.controllerClient(t)
+
+	events := make(chan *ct.JobEvent)
+	stream, err := client.StreamJobEvents(app.ID, 0, events)
+	t.Assert(err, c.IsNil)
+	defer stream.Close()
+	t.Assert(client.PutFormation(&ct.Formation{
+		AppID:     app.ID,
+		ReleaseID: release.ID,
+		Processes: map[string]int{"printer": 2},
+	}), c.IsNil)
+	waitForJobEvents(t, stream, events, jobEvents{"printer": {"up": 2}})
+	jobs, err := client.JobList(app.ID)
+	t.Assert(err, c.IsNil)
+	t.Assert(jobs, c.HasLen, 2)
+
+	// start a standby scheduler on each host
+	controllerRelease, err := client.GetAppRelease("controller")
+	t.Assert(err, c.IsNil)
+	formation, err := client.GetFormation("controller", controllerRelease.ID)
+	t.Assert(err, c.IsNil)
+	formation.Processes["scheduler"]++
+	t.Assert(client.PutFormation(formation), c.IsNil)
+	defer func() {
+		formation.Processes["scheduler"]--
+		client.PutFormation(formation)
+	}()
+
+	service := s.discoverdClient(t).Service("flynn-controller-scheduler")
+	t.Assert(Attempts.Run(func() error {
+		addrs, err := service.Addrs()
+		if err != nil {
+			return err
+		}
+		if len(addrs) < 2 {
+			return fmt.Errorf("expected at least 2 schedulers, got %d", len(addrs))
+		}
+		return nil
+	}), c.IsNil)
+
+	// stop the leader
+	leader, err := service.Leader()
+	t.Assert(err, c.IsNil)
+	debug(t, "current scheduler leader: ", leader.Addr)
+	hosts, err := s.clusterClient(t).ListHosts()
+	t.Assert(err, c.IsNil)
+	var stopped bool
+	for _, h := range hosts {
+		activeJobs, err := s.hostClient(t, h.ID).ListJobs()
+		t.Assert(err, c.IsNil)
+		for id, job := range activeJobs {
+			if job.Job.Metadata["flynn-controller.type"] == "scheduler" && job.Status == host.StatusRunning && job.InternalIP == leader.Host() {
+				debugf(t, "stopping scheduler job %s on host %s", id, h.ID)
+				t.Assert(s.hostClient(t, h.ID).StopJob(id), c.IsNil)
+				stopped = true
+			}
+		}
+	}
+	t.Assert(stopped, c.Equals, true)
+
+	// check a standby takes over
+	t.Assert(Attempts.Run(func() error {
+		newLeader, err := service.Leader()
+		if err != nil {
+			return err
+		}
+		if newLeader.Addr == leader.Addr {
+			return errors.New("scheduler leader has not changed")
+		}
+		res, err := http.Get("http://" + newLeader.Addr + "/status")
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		var status struct {
+			Leader bool `json:"leader"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&status); err != nil {
+			return err
+		}
+		if !status.Leader {
+			return errors.New("new scheduler is not yet the leader")
+		}
+		return nil
+	}), c.IsNil)
+
+	// check the new leader did not disrupt the running jobs
+	list, err := client.JobList(app.ID)
+	t.Assert(err, c.IsNil)
+	t.Assert(list, c.HasLen, 2)
+	for _, job := range list {
+		t.Assert(job.State, c.Equals, "up")
+	}
+}
+
+func (s *SchedulerSuite) TestJobRestartOnHostLoss(t *c.C) {
+	if args.ClusterAPI == "" {
+		t.Skip("cannot boot new hosts")
+	}
+
+	newHosts := s.addHosts(t, 1)
+	app, release := s.createApp(t)
+
+	events := make(chan *ct.JobEvent)
+	stream, err := s.controllerClient(t).StreamJobEvents(app.ID, 0, events)
+	t.Assert(err, c.IsNil)
+	defer stream.Close()
+
+	// spread the jobs so that there is one on each host, including the new one
+	size := testCluster.Size()
+	t.Assert(s.controllerClient(t).PutFormation(&ct.Formation{
+		AppID:     app.ID,
+		ReleaseID: release.ID,
+		Processes: map[string]int{"printer": size},
+	}), c.IsNil)
+	waitForJobEvents(t, stream, events, jobEvents{"printer": {"up": size}})
+
+	// the job on the lost host should be marked as down and replaced
+	s.removeHosts(t, newHosts)
+	waitForJobEvents(t, stream, events, jobEvents{"printer": {"down": 1, "up": 1}})
+}